@@ -0,0 +1,411 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BuildGraphWriter writes the build actions generated
+// by a Context in a format other than a Ninja
+// manifest. It is passed to Context.WriteBuildGraph,
+// which expands every Ninja variable reference before
+// handing the build graph to the writer.
+type BuildGraphWriter interface {
+	WriteBuildGraph(w io.Writer, graph *BuildGraph) error
+}
+
+// BuildGraph contains the fully expanded build actions
+// generated by a Context.
+type BuildGraph struct {
+	Pools   map[string]int `json:"pools,omitempty"` // The depth of each pool, by name.
+	Actions []*Action      `json:"actions"`
+}
+
+// Action describes a single build statement with all
+// of its Ninja variable references expanded. Command is
+// the command given by the RuleParams of the rule and
+// the arguments of the build statement. It doesn't
+// include any wrapper that the Context adds around rule
+// commands when it writes the Ninja file.
+type Action struct {
+	Module          string            `json:"module,omitempty"`    // The module that created the action.
+	Variant         string            `json:"variant,omitempty"`   // The variant of Module.
+	Singleton       string            `json:"singleton,omitempty"` // The singleton that created the action.
+	Rule            string            `json:"rule"`
+	Pool            string            `json:"pool,omitempty"`
+	Command         string            `json:"command,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	Outputs         []string          `json:"outputs"`
+	ImplicitOutputs []string          `json:"implicit_outputs,omitempty"`
+	Inputs          []string          `json:"inputs,omitempty"`
+	Implicits       []string          `json:"implicits,omitempty"`
+	OrderOnly       []string          `json:"order_only,omitempty"`
+	Validations     []string          `json:"validations,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`      // The other Ninja variables set for the action.
+	Compiler        bool              `json:"compiler,omitempty"` // The rule sets RuleParams.Compiler.
+}
+
+// WriteBuildGraph expands the generated build actions
+// and passes them to writer to be written to w. If this
+// is called before PrepareBuildActions successfully
+// completes then ErrBuildActionsNotReady is returned.
+func (c *Context) WriteBuildGraph(w io.Writer, writer BuildGraphWriter) error {
+	if !c.buildActionsReady {
+		return ErrBuildActionsNotReady
+	}
+
+	graph, err := c.buildGraph()
+	if err != nil {
+		return err
+	}
+
+	return writer.WriteBuildGraph(w, graph)
+}
+
+// ActionFilter selects a subset of the actions returned
+// by Context.Actions. An action matches the filter if it
+// matches all of the fields that are set.
+type ActionFilter struct {
+	Output string // An explicit or implicit output of the action.
+	Input  string // An explicit, implicit or order-only input of the action.
+	Rule   string // The full Ninja name of the rule used by the action.
+	Module string // The name of the module or singleton that created the action.
+}
+
+func (f ActionFilter) match(action *Action) bool {
+	if f.Output != "" &&
+		!inStringLists(f.Output, action.Outputs, action.ImplicitOutputs) {
+		return false
+	}
+
+	if f.Input != "" &&
+		!inStringLists(f.Input, action.Inputs, action.Implicits, action.OrderOnly) {
+		return false
+	}
+
+	if f.Rule != "" && f.Rule != action.Rule {
+		return false
+	}
+
+	if f.Module != "" && f.Module != action.Module && f.Module != action.Singleton {
+		return false
+	}
+
+	return true
+}
+
+// Actions returns the fully expanded build actions
+// generated by the modules and singletons that match
+// filter, in the order they are written to the Ninja
+// file. A zero ActionFilter matches every action. If
+// this is called before PrepareBuildActions
+// successfully completes then ErrBuildActionsNotReady
+// is returned.
+func (c *Context) Actions(filter ActionFilter) ([]*Action, error) {
+	if !c.buildActionsReady {
+		return nil, ErrBuildActionsNotReady
+	}
+
+	graph, err := c.buildGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []*Action
+	for _, action := range graph.Actions {
+		if filter.match(action) {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions, nil
+}
+
+func (c *Context) buildGraph() (*BuildGraph, error) {
+	graph := &BuildGraph{
+		Pools: make(map[string]int),
+	}
+
+	for pool, def := range c.globalPools {
+		graph.Pools[pool.fullName(c.pkgNames)] = def.Depth
+	}
+
+	e := newActionEvaluator(c, c.globalVariables)
+
+	addActions := func(defs []*buildDef, setOwner func(*Action)) error {
+		for _, def := range defs {
+			action, err := e.action(def)
+			if err != nil {
+				return err
+			}
+			setOwner(action)
+			graph.Actions = append(graph.Actions, action)
+		}
+		return nil
+	}
+
+	for _, module := range c.sortedModules() {
+		err := addActions(module.actionDefs.buildDefs, func(action *Action) {
+			action.Module = module.Name()
+			action.Variant = module.variantName
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", module, err)
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		err := addActions(info.actionDefs.buildDefs, func(action *Action) {
+			action.Singleton = info.name
+		})
+		if err != nil {
+			return nil, fmt.Errorf("singleton %s: %s", info.name, err)
+		}
+	}
+
+	return graph, nil
+}
+
+// actionEvaluator expands the Ninja strings that make
+// up build statements the same way Ninja would. The
+// values of global and local variables are cached, as
+// they don't depend on the build statement.
+type actionEvaluator struct {
+	context   *Context
+	variables map[Variable]*ninjaString // The live global variables.
+	values    map[Variable]string
+}
+
+func newActionEvaluator(c *Context, variables map[Variable]*ninjaString) *actionEvaluator {
+	return &actionEvaluator{
+		context:   c,
+		variables: variables,
+		values:    make(map[Variable]string),
+	}
+}
+
+func (e *actionEvaluator) lookup(v Variable) (string, error) {
+	if value, ok := e.values[v]; ok {
+		return value, nil
+	}
+
+	ninjaStr, ok := e.variables[v]
+	if !ok {
+		local, isLocal := v.(*localVariable)
+		if !isLocal {
+			return "", fmt.Errorf("no such variable: %s", v)
+		}
+		ninjaStr = local.value_
+	}
+
+	value, err := ninjaStr.EvalWith(e.lookup)
+	if err != nil {
+		return "", err
+	}
+
+	e.values[v] = value
+	return value, nil
+}
+
+func (e *actionEvaluator) evalList(list []*ninjaString) ([]string, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	result := make([]string, len(list))
+	for i, ninjaStr := range list {
+		value, err := ninjaStr.EvalWith(e.lookup)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+func (e *actionEvaluator) action(def *buildDef) (*Action, error) {
+	action := &Action{
+		Rule: def.Rule.fullName(e.context.pkgNames),
+	}
+
+	var commandDeps, commandOrderOnly []*ninjaString
+	if def.RuleDef != nil {
+		commandDeps = def.RuleDef.CommandDeps
+		commandOrderOnly = def.RuleDef.CommandOrderOnly
+		action.Compiler = def.RuleDef.Compiler
+		if def.RuleDef.Pool != nil {
+			action.Pool = def.RuleDef.Pool.fullName(e.context.pkgNames)
+		}
+	}
+
+	lists := []struct {
+		dest *[]string
+		src  []*ninjaString
+	}{
+		{&action.Outputs, def.Outputs},
+		{&action.ImplicitOutputs, def.ImplicitOutputs},
+		{&action.Inputs, def.Inputs},
+		{&action.Implicits, append(append([]*ninjaString(nil), commandDeps...), def.Implicits...)},
+		{&action.OrderOnly, append(append([]*ninjaString(nil), commandOrderOnly...), def.OrderOnly...)},
+		{&action.Validations, def.Validations},
+	}
+
+	for _, list := range lists {
+		values, err := e.evalList(list.src)
+		if err != nil {
+			return nil, err
+		}
+		*list.dest = values
+	}
+
+	env := make(map[string]string)
+
+	args := make(map[Variable]string)
+	for argVar, value := range def.Args {
+		argValue, err := value.EvalWith(e.lookup)
+		if err != nil {
+			return nil, err
+		}
+		args[argVar] = argValue
+		env[argVar.name()] = argValue
+	}
+
+	// Variables in the rule scope can refer to the rule arguments and the
+	// built-in $in and $out variables in addition to globals and locals.
+	ruleLookup := func(v Variable) (string, error) {
+		if value, ok := args[v]; ok {
+			return value, nil
+		}
+
+		if _, isArg := v.(*argVariable); isArg {
+			switch v.name() {
+			case "in":
+				return shellEscapeList(action.Inputs), nil
+			case "out":
+				return shellEscapeList(action.Outputs), nil
+			}
+			// Arguments that aren't set by the build statement are empty.
+			return "", nil
+		}
+
+		return e.lookup(v)
+	}
+
+	variables := make(map[string]*ninjaString)
+	if def.RuleDef != nil {
+		for name, value := range def.RuleDef.Variables {
+			variables[name] = value
+		}
+	}
+	for name, value := range def.Variables {
+		variables[name] = value
+	}
+
+	for name, value := range variables {
+		expanded, err := value.EvalWith(ruleLookup)
+		if err != nil {
+			return nil, fmt.Errorf("error expanding %s: %s", name, err)
+		}
+
+		switch name {
+		case "command":
+			action.Command = expanded
+		case "description":
+			action.Description = expanded
+		default:
+			env[name] = expanded
+		}
+	}
+
+	if len(env) > 0 {
+		action.Env = env
+	}
+
+	return action, nil
+}
+
+// shellEscapeList joins a list of paths with spaces,
+// quoting any that contain characters that are not
+// known to be safe, the same way Ninja does when
+// expanding $in and $out.
+func shellEscapeList(paths []string) string {
+	escaped := make([]string, len(paths))
+	for i, path := range paths {
+		escaped[i] = shellEscape(path)
+	}
+	return strings.Join(escaped, " ")
+}
+
+func shellEscape(path string) string {
+	safe := true
+	for _, r := range path {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') &&
+			!(r >= '0' && r <= '9') && !strings.ContainsRune("_+-./", r) {
+			safe = false
+			break
+		}
+	}
+
+	if safe {
+		return path
+	}
+
+	return "'" + strings.Replace(path, "'", `'\''`, -1) + "'"
+}
+
+// JSONBuildGraphWriter writes the expanded build graph
+// as a single JSON object.
+var JSONBuildGraphWriter BuildGraphWriter = jsonBuildGraphWriter{}
+
+type jsonBuildGraphWriter struct{}
+
+func (jsonBuildGraphWriter) WriteBuildGraph(w io.Writer, graph *BuildGraph) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(graph)
+}
+
+// CompileCommandsWriter returns a BuildGraphWriter that
+// writes a compile_commands.json compilation database
+// with an entry for each explicit input of each action
+// whose rule sets RuleParams.Compiler. The dir argument
+// is the directory that Ninja runs the commands in.
+func CompileCommandsWriter(dir string) BuildGraphWriter {
+	return compileCommandsWriter{dir}
+}
+
+type compileCommandsWriter struct {
+	dir string
+}
+
+type compileCommand struct {
+	Directory string `json:"directory"`
+	File      string `json:"file"`
+	Output    string `json:"output,omitempty"`
+	Command   string `json:"command"`
+}
+
+func (c compileCommandsWriter) WriteBuildGraph(w io.Writer, graph *BuildGraph) error {
+	commands := []compileCommand{}
+
+	for _, action := range graph.Actions {
+		if !action.Compiler {
+			continue
+		}
+
+		for _, input := range action.Inputs {
+			commands = append(commands, compileCommand{
+				Directory: c.dir,
+				File:      input,
+				Output:    action.Outputs[0],
+				Command:   action.Command,
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(commands)
+}
@@ -0,0 +1,245 @@
+package blueprint
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var (
+	testCC = pctx.StaticVariable("cc", "clang")
+
+	compileRule = pctx.StaticRule("cc", RuleParams{
+		Command:     "${cc} $flags -c $in -o $out",
+		Description: "cc $out",
+		Depfile:     "$out.d",
+		Compiler:    true,
+	}, "flags")
+)
+
+// compileParams makes testModule compile its sources.
+func compileParams(ctx ModuleContext, params *BuildParams) {
+	params.Rule = compileRule
+	params.Args = map[string]string{"flags": "-O2"}
+}
+
+func TestWriteBuildGraph(t *testing.T) {
+	ctx := runTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a b.c"],
+				outs: ["a.o"],
+			}
+		`,
+	}, testBuildParams(compileParams))
+
+	buf := &bytes.Buffer{}
+	err := ctx.WriteBuildGraph(buf, JSONBuildGraphWriter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var graph BuildGraph
+	err = json.Unmarshal(buf.Bytes(), &graph)
+	if err != nil {
+		t.Fatalf("unexpected error decoding %s: %s", buf, err)
+	}
+
+	expected := []*Action{
+		{
+			Module:      "a",
+			Rule:        "g.blueprint.cc",
+			Command:     "clang -O2 -c 'a b.c' -o a.o",
+			Description: "cc a.o",
+			Outputs:     []string{"a.o"},
+			Inputs:      []string{"a b.c"},
+			Env: map[string]string{
+				"depfile": "a.o.d",
+				"flags":   "-O2",
+			},
+			Compiler: true,
+		},
+	}
+
+	if !reflect.DeepEqual(graph.Actions, expected) {
+		t.Errorf("incorrect actions:\n  expected: %s\n       got: %s", jsonString(expected),
+			jsonString(graph.Actions))
+	}
+}
+
+func TestCompileCommandsWriter(t *testing.T) {
+	ctx := runTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.c", "b.c"],
+				outs: ["a.o"],
+			}
+
+			test {
+				name: "b",
+				srcs: ["a.o"],
+				outs: ["b.out"],
+			}
+		`,
+	}, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		if ctx.ModuleName() == "a" {
+			compileParams(ctx, params)
+		}
+	}))
+
+	buf := &bytes.Buffer{}
+	err := ctx.WriteBuildGraph(buf, CompileCommandsWriter("/src"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var commands []compileCommand
+	err = json.Unmarshal(buf.Bytes(), &commands)
+	if err != nil {
+		t.Fatalf("unexpected error decoding %s: %s", buf, err)
+	}
+
+	expected := []compileCommand{
+		{
+			Directory: "/src",
+			File:      "a.c",
+			Output:    "a.o",
+			Command:   "clang -O2 -c a.c b.c -o a.o",
+		},
+		{
+			Directory: "/src",
+			File:      "b.c",
+			Output:    "a.o",
+			Command:   "clang -O2 -c a.c b.c -o a.o",
+		},
+	}
+
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("incorrect compile commands:\n  expected: %s\n       got: %s", jsonString(expected),
+			jsonString(commands))
+	}
+}
+
+func TestWriteBuildGraphNotReady(t *testing.T) {
+	ctx := newTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+			}
+		`,
+	})
+
+	err := ctx.WriteBuildGraph(&bytes.Buffer{}, JSONBuildGraphWriter)
+	if err != ErrBuildActionsNotReady {
+		t.Errorf("expected ErrBuildActionsNotReady, got %v", err)
+	}
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func TestActions(t *testing.T) {
+	ctx := newTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.c"],
+				outs: ["a.o"],
+			}
+
+			test {
+				name: "b",
+				srcs: ["a.o"],
+				outs: ["b.out"],
+			}
+		`,
+	})
+	ctx.RegisterSingletonType("singleton", newTestSingleton(func(ctx SingletonContext) {
+		ctx.Build(pctx, BuildParams{
+			Rule:      copyRule,
+			Outputs:   []string{"s.out"},
+			Inputs:    []string{"b.out"},
+			Implicits: []string{"a.o"},
+		})
+	}))
+	errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		if ctx.ModuleName() == "a" {
+			compileParams(ctx, params)
+		}
+	}))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	testCases := []struct {
+		filter  ActionFilter
+		outputs []string // The first output of each expected action.
+	}{
+		{
+			filter:  ActionFilter{},
+			outputs: []string{"a.o", "b.out", "s.out"},
+		},
+		{
+			filter:  ActionFilter{Output: "b.out"},
+			outputs: []string{"b.out"},
+		},
+		{
+			filter:  ActionFilter{Input: "a.o"},
+			outputs: []string{"b.out", "s.out"},
+		},
+		{
+			filter:  ActionFilter{Rule: "g.blueprint.cp"},
+			outputs: []string{"b.out", "s.out"},
+		},
+		{
+			filter:  ActionFilter{Module: "a"},
+			outputs: []string{"a.o"},
+		},
+		{
+			filter:  ActionFilter{Module: "singleton"},
+			outputs: []string{"s.out"},
+		},
+		{
+			filter:  ActionFilter{Input: "a.o", Module: "b"},
+			outputs: []string{"b.out"},
+		},
+		{
+			filter:  ActionFilter{Output: "c.out"},
+			outputs: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		actions, err := ctx.Actions(testCase.filter)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var outputs []string
+		for _, action := range actions {
+			outputs = append(outputs, action.Outputs[0])
+		}
+
+		if !reflect.DeepEqual(outputs, testCase.outputs) {
+			t.Errorf("incorrect actions for %+v:\n  expected: %q\n       got: %q",
+				testCase.filter, testCase.outputs, outputs)
+		}
+	}
+
+	actions, err := ctx.Actions(ActionFilter{Module: "singleton"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(actions) != 1 || actions[0].Singleton != "singleton" || actions[0].Module != "" {
+		t.Errorf("expected the singleton action to be owned by the singleton, got %s",
+			jsonString(actions))
+	}
+}
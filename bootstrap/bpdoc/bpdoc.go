@@ -6,6 +6,7 @@ import (
 	"go/doc"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"html/template"
 	"reflect"
 	"sort"
@@ -129,6 +130,40 @@ func (p *Property) Clone() Property {
 	return ret
 }
 
+// Constraints returns descriptions of the constraints
+// on the value of the property that are declared in
+// its struct tags and checked when it is unpacked.
+func (p Property) Constraints() []string {
+	var constraints []string
+	if proptools.HasTag(reflect.StructField{Tag: p.Tag}, "blueprint", "required") {
+		constraints = append(constraints, "required")
+	}
+	if enum, ok := p.Tag.Lookup("enum"); ok {
+		values := strings.Split(enum, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		constraints = append(constraints, "one of "+strings.Join(values, ", "))
+	}
+	if bounds, ok := p.Tag.Lookup("range"); ok {
+		if parts := strings.Split(bounds, ","); len(parts) == 2 {
+			min, max := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			switch {
+			case min == "":
+				constraints = append(constraints, "at most "+max)
+			case max == "":
+				constraints = append(constraints, "at least "+min)
+			default:
+				constraints = append(constraints, "between "+min+" and "+max)
+			}
+		}
+	}
+	if pattern, ok := p.Tag.Lookup("pattern"); ok {
+		constraints = append(constraints, "matching "+pattern)
+	}
+	return constraints
+}
+
 func (p *Property) Equal(other Property) bool {
 	return p.Name == other.Name && p.Type == other.Type && p.Tag == other.Tag &&
 		p.Text == other.Text && p.Default == other.Default &&
@@ -287,7 +322,17 @@ func structProperties(structType *ast.StructType) (props []Property, err error)
 			}
 			switch a := t.(type) {
 			case *ast.ArrayType:
-				typ = "list of strings"
+				typ = "list of " + elementTypeName(a.Elt)
+				innerProps, err = elementProperties(a.Elt)
+				if err != nil {
+					return nil, err
+				}
+			case *ast.MapType:
+				typ = "map of " + elementTypeName(a.Value)
+				innerProps, err = elementProperties(a.Value)
+				if err != nil {
+					return nil, err
+				}
 			case *ast.InterfaceType:
 				typ = "interface"
 			case *ast.Ident:
@@ -298,7 +343,7 @@ func structProperties(structType *ast.StructType) (props []Property, err error)
 					return nil, err
 				}
 			default:
-				typ = fmt.Sprintf("%T", f.Type)
+				typ = types.ExprString(t)
 			}
 
 			var html template.HTML
@@ -333,6 +378,43 @@ func structProperties(structType *ast.StructType) (props []Property, err error)
 	return props, nil
 }
 
+// elementTypeName returns the plural name used in the
+// documentation for the elements of a list or map
+// property of type t.
+func elementTypeName(t ast.Expr) string {
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch a := t.(type) {
+	case *ast.Ident:
+		switch a.Name {
+		case "string", "bool", "int32", "int64", "uint64":
+			return a.Name + "s"
+		}
+		return a.Name
+	case *ast.ArrayType:
+		return "lists of " + elementTypeName(a.Elt)
+	case *ast.StructType:
+		return "maps"
+	}
+	// Render other types, such as a type from another package, the way
+	// they appear in the source.
+	return types.ExprString(t)
+}
+
+// elementProperties returns the properties of the
+// elements of a list or map property of type t if they
+// are anonymous structs.
+func elementProperties(t ast.Expr) ([]Property, error) {
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if s, ok := t.(*ast.StructType); ok {
+		return structProperties(s)
+	}
+	return nil, nil
+}
+
 func (ps *PropertyStruct) ExcludeByTag(key, value string) {
 	filterPropsByTag(&ps.Properties, key, value, true)
 }
@@ -501,7 +583,8 @@ func nestedPropertyStructs(s reflect.Value) map[string]reflect.Value {
 			fieldValue := structValue.Field(i)
 
 			switch fieldValue.Kind() {
-			case reflect.Bool, reflect.String, reflect.Slice, reflect.Int, reflect.Uint:
+			case reflect.Bool, reflect.String, reflect.Slice, reflect.Map, reflect.Int, reflect.Uint,
+				reflect.Int32, reflect.Int64, reflect.Uint64:
 				// Nothing
 			case reflect.Struct:
 				walk(fieldValue, prefix+proptools.PropertyNameForField(field.Name)+".")
@@ -0,0 +1,90 @@
+package bpdoc
+
+import (
+	"go/parser"
+	"reflect"
+	"testing"
+)
+
+func TestPropertyConstraints(t *testing.T) {
+	testCases := []struct {
+		tag         reflect.StructTag
+		constraints []string
+	}{
+		{
+			tag: "",
+		},
+		{
+			tag:         `blueprint:"required,mutated"`,
+			constraints: []string{"required"},
+		},
+		{
+			tag:         `enum:"a, b,c"`,
+			constraints: []string{"one of a, b, c"},
+		},
+		{
+			tag:         `range:"0,64"`,
+			constraints: []string{"between 0 and 64"},
+		},
+		{
+			tag:         `range:",64"`,
+			constraints: []string{"at most 64"},
+		},
+		{
+			tag:         `range:"1,"`,
+			constraints: []string{"at least 1"},
+		},
+		{
+			tag:         `blueprint:"required" pattern:"[a-z]+"`,
+			constraints: []string{"required", "matching [a-z]+"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		got := Property{Tag: testCase.tag}.Constraints()
+		if !reflect.DeepEqual(got, testCase.constraints) {
+			t.Errorf("%s: expected %q, got %q", testCase.tag, testCase.constraints, got)
+		}
+	}
+}
+
+func TestElementTypeName(t *testing.T) {
+	testCases := []struct {
+		expr     string
+		expected string
+	}{
+		{expr: "int32", expected: "int32s"},
+		{expr: "*uint64", expected: "uint64s"},
+		{expr: "[]int64", expected: "lists of int64s"},
+		{expr: "Arch", expected: "Arch"},
+	}
+
+	for _, testCase := range testCases {
+		expr, err := parser.ParseExpr(testCase.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := elementTypeName(expr); got != testCase.expected {
+			t.Errorf("%s: expected %q, got %q", testCase.expr, testCase.expected, got)
+		}
+	}
+}
+
+func TestNestedPropertyStructsIntegers(t *testing.T) {
+	type nestedProps struct {
+		Sizes []uint64
+	}
+	props := struct {
+		Small  int32
+		Big    *int64
+		Size   uint64
+		Nested *nestedProps
+	}{
+		Nested: &nestedProps{},
+	}
+
+	nested := nestedPropertyStructs(reflect.ValueOf(props))
+	if len(nested) != 1 || !nested["nested"].IsValid() {
+		t.Errorf("expected only the nested struct, got %v", nested)
+	}
+}
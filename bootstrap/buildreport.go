@@ -0,0 +1,426 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+const depsLogFileName = ".ninja_deps"
+
+// The number of actions listed in the slowest actions
+// section of a build report.
+const buildReportSlowestActions = 20
+
+// buildReport summarizes the time spent running the
+// actions of the most recent build, as recorded in the
+// Ninja log, by the modules and rules that own them.
+type buildReport struct {
+	TotalMs        int64                `json:"total_ms"`         // The sum of the durations of all actions.
+	Actions        int                  `json:"actions"`          // The number of actions in the Ninja log.
+	CriticalPathMs int64                `json:"critical_path_ms"` // The duration of the longest chain of dependent actions.
+	Modules        []*buildReportTotal  `json:"modules"`
+	Rules          []*buildReportTotal  `json:"rules"`
+	CriticalPath   []*buildReportAction `json:"critical_path"`
+	Slowest        []*buildReportAction `json:"slowest"`
+}
+
+type buildReportTotal struct {
+	Name    string `json:"name"`
+	Actions int    `json:"actions"`
+	TimeMs  int64  `json:"time_ms"`
+}
+
+type buildReportAction struct {
+	Output string `json:"output"`
+	Module string `json:"module,omitempty"` // The module or singleton that owns the action, if known.
+	Rule   string `json:"rule,omitempty"`
+	TimeMs int64  `json:"time_ms"`
+	Deps   int    `json:"deps,omitempty"` // The number of dependencies recorded in the Ninja deps log.
+
+	start, end int64
+	inputs     []string
+}
+
+// writeBuildReport writes a report on the most recent
+// build to filename, in JSON if format is "json" and as
+// text otherwise.
+func writeBuildReport(ctx *blueprint.Context, srcDir, filename, format string) error {
+	report, err := makeBuildReport(ctx, srcDir)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if format == "json" {
+		encoder := json.NewEncoder(buf)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		err = encoder.Encode(report)
+	} else {
+		err = report.writeText(buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, buf.Bytes(), 0666)
+}
+
+// makeBuildReport joins the Ninja log and the Ninja deps
+// log with the actions generated by ctx.
+func makeBuildReport(ctx *blueprint.Context, srcDir string) (*buildReport, error) {
+	ninjaBuildDir, err := ctx.NinjaBuildDir()
+	if err != nil {
+		return nil, err
+	}
+
+	replacer := strings.NewReplacer(
+		"@@SrcDir@@", srcDir,
+		"@@BuildDir@@", BuildDir)
+	ninjaBuildDir = replacer.Replace(ninjaBuildDir)
+
+	entries, err := readNinjaLog(ninjaBuildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := readNinjaDeps(ninjaBuildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	graphActions, err := ctx.Actions(blueprint.ActionFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	clean := func(path string) string {
+		return filepath.Clean(replacer.Replace(path))
+	}
+
+	owners := make(map[string]*blueprint.Action)
+	for _, action := range graphActions {
+		for _, output := range append(action.Outputs, action.ImplicitOutputs...) {
+			owners[clean(output)] = action
+		}
+	}
+
+	// Only the most recent build is reported on, as the times of
+	// entries written by different builds can't be compared. An output
+	// can still have several entries if it was built more than once
+	// in that build, so later entries replace earlier ones.
+	latest := make(map[string]ninjaLogEntry)
+	for _, entry := range lastBuildEntries(entries) {
+		latest[entry.output] = entry
+	}
+
+	// Each output of a command that has several outputs has its own
+	// entry in the Ninja log; only count the command once.
+	report := &buildReport{}
+	var actions []*buildReportAction
+	producers := make(map[string]*buildReportAction)
+	seen := make(map[*blueprint.Action]*buildReportAction)
+
+	outputs := make([]string, 0, len(latest))
+	for output := range latest {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+
+	for _, output := range outputs {
+		entry := latest[output]
+		owner := owners[output]
+
+		if action := seen[owner]; owner != nil && action != nil &&
+			action.start == entry.start && action.end == entry.end {
+			producers[output] = action
+			continue
+		}
+
+		action := &buildReportAction{
+			Output: output,
+			TimeMs: entry.end - entry.start,
+			Deps:   len(deps[output]),
+			start:  entry.start,
+			end:    entry.end,
+			inputs: deps[output],
+		}
+
+		if owner != nil {
+			if owner.Module != "" {
+				action.Module = owner.Module
+			} else {
+				action.Module = "singleton " + owner.Singleton
+			}
+			action.Rule = owner.Rule
+			for _, list := range [][]string{owner.Inputs, owner.Implicits, owner.OrderOnly} {
+				for _, input := range list {
+					action.inputs = append(action.inputs, clean(input))
+				}
+			}
+			seen[owner] = action
+		}
+
+		producers[output] = action
+		actions = append(actions, action)
+	}
+
+	report.Actions = len(actions)
+
+	modules := make(map[string]*buildReportTotal)
+	rules := make(map[string]*buildReportTotal)
+	addTotal := func(totals map[string]*buildReportTotal, name string, action *buildReportAction) {
+		if name == "" {
+			name = "<unknown>"
+		}
+		total := totals[name]
+		if total == nil {
+			total = &buildReportTotal{Name: name}
+			totals[name] = total
+		}
+		total.Actions++
+		total.TimeMs += action.TimeMs
+	}
+
+	for _, action := range actions {
+		report.TotalMs += action.TimeMs
+		addTotal(modules, action.Module, action)
+		addTotal(rules, action.Rule, action)
+	}
+
+	report.Modules = sortedTotals(modules)
+	report.Rules = sortedTotals(rules)
+	report.CriticalPath = criticalPath(actions, producers)
+	for _, action := range report.CriticalPath {
+		report.CriticalPathMs += action.TimeMs
+	}
+
+	slowest := append([]*buildReportAction(nil), actions...)
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].TimeMs > slowest[j].TimeMs
+	})
+	if len(slowest) > buildReportSlowestActions {
+		slowest = slowest[:buildReportSlowestActions]
+	}
+	report.Slowest = slowest
+
+	return report, nil
+}
+
+// lastBuildEntries returns the entries of the Ninja log
+// that were written by the most recent build. The times
+// in the Ninja log are relative to the start of the
+// build that wrote them, and entries are appended as
+// commands finish, so the end times only decrease where
+// a new build starts. Start times can't be used for
+// this, as a command that started early can finish
+// after one that started later.
+func lastBuildEntries(entries []ninjaLogEntry) []ninjaLogEntry {
+	for i := len(entries) - 1; i > 0; i-- {
+		if entries[i].end < entries[i-1].end {
+			return entries[i:]
+		}
+	}
+	return entries
+}
+
+func sortedTotals(totals map[string]*buildReportTotal) []*buildReportTotal {
+	sorted := make([]*buildReportTotal, 0, len(totals))
+	for _, total := range totals {
+		sorted = append(sorted, total)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TimeMs != sorted[j].TimeMs {
+			return sorted[i].TimeMs > sorted[j].TimeMs
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// criticalPath returns the chain of dependent actions
+// with the longest total duration, starting with the
+// action that ran first. Dependencies are taken from the
+// inputs of the actions generated by the Context and
+// from the Ninja deps log. Only dependencies that ran
+// before an action are followed, which also guarantees
+// that there are no cycles.
+func criticalPath(actions []*buildReportAction,
+	producers map[string]*buildReportAction) []*buildReportAction {
+
+	longest := make(map[*buildReportAction]int64)
+	next := make(map[*buildReportAction]*buildReportAction)
+
+	// Visit the actions in the order they finished, so that the longest
+	// paths to the dependencies of each action are already known.
+	sorted := append([]*buildReportAction(nil), actions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].end < sorted[j].end
+	})
+
+	var last *buildReportAction
+	for _, action := range sorted {
+		var prev *buildReportAction
+		for _, input := range action.inputs {
+			dep := producers[input]
+			if dep == nil || dep == action || dep.end > action.start {
+				continue
+			}
+			if prev == nil || longest[dep] > longest[prev] {
+				prev = dep
+			}
+		}
+
+		longest[action] = action.TimeMs
+		if prev != nil {
+			longest[action] += longest[prev]
+			next[action] = prev
+		}
+
+		if last == nil || longest[action] > longest[last] {
+			last = action
+		}
+	}
+
+	var path []*buildReportAction
+	for action := last; action != nil; action = next[action] {
+		path = append([]*buildReportAction{action}, path...)
+	}
+	return path
+}
+
+func (r *buildReport) writeText(w io.Writer) error {
+	seconds := func(ms int64) string {
+		return fmt.Sprintf("%8.3fs", float64(ms)/1000)
+	}
+
+	describe := func(action *buildReportAction) string {
+		if action.Module == "" {
+			return action.Output
+		}
+		return fmt.Sprintf("%s (%s, %s)", action.Output, action.Module, action.Rule)
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Total action time: %s in %d actions\n", strings.TrimSpace(seconds(r.TotalMs)), r.Actions)
+	fmt.Fprintf(&buf, "Critical path:     %s in %d actions\n", strings.TrimSpace(seconds(r.CriticalPathMs)), len(r.CriticalPath))
+
+	totals := []struct {
+		title  string
+		totals []*buildReportTotal
+	}{
+		{"Modules", r.Modules},
+		{"Rules", r.Rules},
+	}
+	for _, section := range totals {
+		fmt.Fprintf(&buf, "\n%s by action time:\n", section.title)
+		for _, total := range section.totals {
+			fmt.Fprintf(&buf, "  %s %6d  %s\n", seconds(total.TimeMs), total.Actions, total.Name)
+		}
+	}
+
+	actions := []struct {
+		title   string
+		actions []*buildReportAction
+	}{
+		{"Critical path", r.CriticalPath},
+		{"Slowest actions", r.Slowest},
+	}
+	for _, section := range actions {
+		fmt.Fprintf(&buf, "\n%s:\n", section.title)
+		for _, action := range section.actions {
+			fmt.Fprintf(&buf, "  %s  %s\n", seconds(action.TimeMs), describe(action))
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readNinjaDeps returns the dependencies recorded in the
+// Ninja deps log in ninjaBuildDir, by output, or nil if
+// there is no deps log.
+func readNinjaDeps(ninjaBuildDir string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(ninjaBuildDir, depsLogFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	const signature = "# ninjadeps\n"
+	if !bytes.HasPrefix(data, []byte(signature)) || len(data) < len(signature)+4 {
+		return nil, errors.New("unrecognized ninja deps log format")
+	}
+	data = data[len(signature):]
+
+	version := binary.LittleEndian.Uint32(data)
+	if version != 3 && version != 4 {
+		return nil, fmt.Errorf("unsupported ninja deps log version %d", version)
+	}
+	data = data[4:]
+
+	// Path records end with a checksum in both versions. Version 4
+	// records a 64-bit mtime in deps records instead of a 32-bit one.
+	const checksumSize = 4
+	mtimeSize := 4
+	if version == 4 {
+		mtimeSize = 8
+	}
+
+	var paths []string
+	deps := make(map[string][]string)
+
+	for len(data) >= 4 {
+		header := binary.LittleEndian.Uint32(data)
+		isDeps := header>>31 == 1
+		size := int(header & 0x7fffffff)
+		data = data[4:]
+
+		if size > len(data) {
+			// The last record was truncated by an interrupted build.
+			break
+		}
+		record := data[:size]
+		data = data[size:]
+
+		if !isDeps {
+			if size < checksumSize {
+				return nil, errors.New("invalid ninja deps log path record")
+			}
+			paths = append(paths, strings.TrimRight(string(record[:size-checksumSize]), "\x00"))
+			continue
+		}
+
+		if size < 4+mtimeSize {
+			return nil, errors.New("invalid ninja deps log deps record")
+		}
+		out := int(binary.LittleEndian.Uint32(record))
+		if out >= len(paths) {
+			continue
+		}
+
+		var inputs []string
+		for ids := record[4+mtimeSize:]; len(ids) >= 4; ids = ids[4:] {
+			if id := int(binary.LittleEndian.Uint32(ids)); id < len(paths) {
+				inputs = append(inputs, paths[id])
+			}
+		}
+		deps[paths[out]] = inputs
+	}
+
+	return deps, nil
+}
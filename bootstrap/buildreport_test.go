@@ -0,0 +1,245 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadNinjaLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries, err := readNinjaLog(dir)
+	if err != nil || entries != nil {
+		t.Errorf("expected no entries without a Ninja log, got %v, %v", entries, err)
+	}
+
+	log := "# ninja log v5\n" +
+		"0\t10\t100\ta.o\tabc\n" +
+		"5\t20\t100\tdir/b c.o\tdef\n"
+	err = ioutil.WriteFile(filepath.Join(dir, logFileName), []byte(log), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = readNinjaLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ninjaLogEntry{
+		{start: 0, end: 10, output: "a.o", hash: "abc"},
+		{start: 5, end: 20, output: "dir/b c.o", hash: "def"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("incorrect entries:\n  expected: %v\n       got: %v", expected, entries)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, logFileName), []byte("# ninja log v4\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNinjaLog(dir); err == nil {
+		t.Error("expected an error for an unsupported Ninja log version")
+	}
+}
+
+func TestLastBuildEntries(t *testing.T) {
+	entries := []ninjaLogEntry{
+		{start: 0, end: 10, output: "a"},
+		{start: 10, end: 30, output: "b"},
+		// A new build.
+		{start: 0, end: 5, output: "c"},
+		// Started before d but finished after it.
+		{start: 0, end: 9, output: "d"},
+		{start: 1, end: 9, output: "e"},
+	}
+
+	var outputs []string
+	for _, entry := range lastBuildEntries(entries) {
+		outputs = append(outputs, entry.output)
+	}
+	if expected := []string{"c", "d", "e"}; !reflect.DeepEqual(outputs, expected) {
+		t.Errorf("expected %q, got %q", expected, outputs)
+	}
+
+	if got := lastBuildEntries(entries[:2]); len(got) != 2 {
+		t.Errorf("expected a single build to be returned whole, got %v", got)
+	}
+}
+
+// ninjaDepsLog returns a version 4 Ninja deps log
+// recording deps for each output, in order.
+func ninjaDepsLog(deps [][]string) []byte {
+	buf := bytes.NewBufferString("# ninjadeps\n")
+	write := func(v uint32) {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	write(4)
+
+	ids := make(map[string]uint32)
+	id := func(path string) uint32 {
+		if id, ok := ids[path]; ok {
+			return id
+		}
+		padded := path + strings.Repeat("\x00", (4-len(path)%4)%4)
+		write(uint32(len(padded) + 4))
+		buf.WriteString(padded)
+		ids[path] = uint32(len(ids))
+		write(^ids[path])
+		return ids[path]
+	}
+
+	for _, record := range deps {
+		outID := id(record[0])
+		var inputIDs []uint32
+		for _, input := range record[1:] {
+			inputIDs = append(inputIDs, id(input))
+		}
+		write(1<<31 | uint32(4+8+4*len(inputIDs)))
+		write(outID)
+		binary.Write(buf, binary.LittleEndian, uint64(12345))
+		for _, inputID := range inputIDs {
+			write(inputID)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadNinjaDeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	deps, err := readNinjaDeps(dir)
+	if err != nil || deps != nil {
+		t.Errorf("expected no deps without a deps log, got %v, %v", deps, err)
+	}
+
+	log := ninjaDepsLog([][]string{
+		{"a.o", "a.c", "a.h"},
+		{"b.o", "b.c", "a.h"},
+		// A later record for the same output replaces the earlier one.
+		{"a.o", "a.c"},
+	})
+	// A truncated record is ignored.
+	log = append(log, 0x10, 0, 0)
+
+	err = ioutil.WriteFile(filepath.Join(dir, depsLogFileName), log, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err = readNinjaDeps(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"a.o": {"a.c"},
+		"b.o": {"b.c", "a.h"},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("incorrect deps:\n  expected: %q\n       got: %q", expected, deps)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, depsLogFileName), []byte("# ninjadeps\n\x02\x00\x00\x00"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNinjaDeps(dir); err == nil {
+		t.Error("expected an error for an unsupported deps log version")
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	action := func(output string, start, end int64, inputs ...string) *buildReportAction {
+		return &buildReportAction{
+			Output: output,
+			TimeMs: end - start,
+			start:  start,
+			end:    end,
+			inputs: inputs,
+		}
+	}
+
+	actions := []*buildReportAction{
+		action("a", 0, 10),
+		action("b", 0, 30),
+		action("c", 10, 20, "a"),
+		action("d", 30, 35, "b", "c"),
+		// e started before its input finished, so the input is
+		// not followed.
+		action("e", 25, 36, "c", "d"),
+		action("f", 40, 45, "e", "missing"),
+	}
+	producers := make(map[string]*buildReportAction)
+	for _, action := range actions {
+		producers[action.Output] = action
+	}
+
+	var outputs []string
+	for _, action := range criticalPath(actions, producers) {
+		outputs = append(outputs, action.Output)
+	}
+	if expected := []string{"a", "c", "e", "f"}; !reflect.DeepEqual(outputs, expected) {
+		t.Errorf("expected critical path %q, got %q", expected, outputs)
+	}
+}
+
+func TestBuildReportWriteText(t *testing.T) {
+	a := &buildReportAction{Output: "a.o", Module: "a", Rule: "cc", TimeMs: 1500}
+	b := &buildReportAction{Output: "b", TimeMs: 250}
+	report := &buildReport{
+		TotalMs:        1750,
+		Actions:        2,
+		CriticalPathMs: 1500,
+		Modules: []*buildReportTotal{
+			{Name: "a", Actions: 1, TimeMs: 1500},
+			{Name: "<unknown>", Actions: 1, TimeMs: 250},
+		},
+		Rules: []*buildReportTotal{
+			{Name: "cc", Actions: 1, TimeMs: 1500},
+			{Name: "<unknown>", Actions: 1, TimeMs: 250},
+		},
+		CriticalPath: []*buildReportAction{a},
+		Slowest:      []*buildReportAction{a, b},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.writeText(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Total action time: 1.750s in 2 actions
+Critical path:     1.500s in 1 actions
+
+Modules by action time:
+     1.500s      1  a
+     0.250s      1  <unknown>
+
+Rules by action time:
+     1.500s      1  cc
+     0.250s      1  <unknown>
+
+Critical path:
+     1.500s  a.o (a, cc)
+
+Slowest actions:
+     1.500s  a.o (a, cc)
+     0.250s  b
+`
+	if buf.String() != expected {
+		t.Errorf("incorrect report:\n  expected:\n%s\n  got:\n%s", expected, buf.String())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -17,7 +18,8 @@ const logFileName = ".ninja_log"
 // removeAbandonedFilesUnder removes any files that
 // appear in the Ninja log, and are prefixed with
 // one of the `under` entries, but that are not
-// currently build targets.
+// currently build targets, along with their
+// blueprint.HashStampSuffix stamp files.
 func removeAbandonedFilesUnder(ctx *blueprint.Context, config *Config,
 	srcDir string, under []string) error {
 
@@ -53,6 +55,10 @@ func removeAbandonedFilesUnder(ctx *blueprint.Context, config *Config,
 	for _, filePath := range filePaths {
 		isTarget := targets[filePath]
 		if !isTarget {
+			err = removeFileAndEmptyDirs(filePath + blueprint.HashStampSuffix)
+			if err != nil {
+				return err
+			}
 			err = removeFileAndEmptyDirs(filePath)
 			if err != nil {
 				return err
@@ -64,6 +70,37 @@ func removeAbandonedFilesUnder(ctx *blueprint.Context, config *Config,
 }
 
 func parseNinjaLog(ninjaBuildDir string, under []string) ([]string, error) {
+	entries, err := readNinjaLog(ninjaBuildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var filePaths []string
+	for _, entry := range entries {
+		for _, dir := range under {
+			if strings.HasPrefix(entry.output, dir) {
+				filePaths = append(filePaths, entry.output)
+				break
+			}
+		}
+	}
+
+	return filePaths, nil
+}
+
+// ninjaLogEntry is a line of the Ninja log, recording
+// when Ninja ran the command that generated an output.
+// Times are in milliseconds since the start of the
+// build.
+type ninjaLogEntry struct {
+	start, end int64
+	output     string
+	hash       string
+}
+
+// readNinjaLog returns the entries of the Ninja log in
+// ninjaBuildDir, or nil if there is no Ninja log.
+func readNinjaLog(ninjaBuildDir string) ([]ninjaLogEntry, error) {
 	logFilePath := filepath.Join(ninjaBuildDir, logFileName)
 	logFile, err := os.Open(logFilePath)
 	if err != nil {
@@ -82,7 +119,7 @@ func parseNinjaLog(ninjaBuildDir string, under []string) ([]string, error) {
 		return nil, errors.New("unrecognized ninja log format")
 	}
 
-	var filePaths []string
+	var entries []ninjaLogEntry
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasPrefix(line, "#") {
@@ -99,22 +136,27 @@ func parseNinjaLog(ninjaBuildDir string, under []string) ([]string, error) {
 			return nil, fmt.Errorf("log entry has too few fields: %q", line)
 		}
 
-		start := precedingFields
-		end := len(fields) - followingFields
-		filePath := strings.Join(fields[start:end], fieldSeperator)
-
-		for _, dir := range under {
-			if strings.HasPrefix(filePath, dir) {
-				filePaths = append(filePaths, filePath)
-				break
-			}
+		start, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time in log entry: %q", line)
 		}
+		end, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end time in log entry: %q", line)
+		}
+
+		entries = append(entries, ninjaLogEntry{
+			start:  start,
+			end:    end,
+			output: strings.Join(fields[precedingFields:len(fields)-followingFields], fieldSeperator),
+			hash:   fields[len(fields)-1],
+		})
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	return filePaths, nil
+	return entries, nil
 }
 
 func removeFileAndEmptyDirs(path string) error {
@@ -11,21 +11,35 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 	"runtime/trace"
+	"strings"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/deptools"
+	"github.com/google/blueprint/pathtools"
 )
 
 var (
-	outFile        string
-	depFile        string
-	docFile        string
-	cpuprofile     string
-	memprofile     string
-	traceFile      string
-	runGoTests     bool
-	noGC           bool
-	moduleListFile string
+	outFile         string
+	depFile         string
+	docFile         string
+	cpuprofile      string
+	memprofile      string
+	traceFile       string
+	runGoTests      bool
+	noGC            bool
+	moduleListFile  string
+	shardNinja      string
+	shardInclude    bool
+	graphFile       string
+	compdbFile      string
+	actionQuery     string
+	sandbox         string
+	remoteWrapper   string
+	moduleAliases   bool
+	defaultTags     string
+	buildReportFile string
+	reportFormat    string
+	strictDeprecate bool
 
 	BuildDir      string
 	NinjaBuildDir string
@@ -44,6 +58,23 @@ func init() {
 	flag.BoolVar(&noGC, "nogc", false, "turn off GC for debugging")
 	flag.BoolVar(&runGoTests, "t", false, "build and run go tests during bootstrap")
 	flag.StringVar(&moduleListFile, "l", "", "file that lists filepaths to parse")
+	flag.StringVar(&graphFile, "action_graph", "", "write the expanded build actions as JSON to file")
+	flag.StringVar(&compdbFile, "compdb", "", "write a compile_commands.json compilation database to file")
+	flag.StringVar(&actionQuery, "query_actions", "", "print the build actions matching a comma separated list of output=, input=, rule= and module= terms")
+	flag.StringVar(&sandbox, "sandbox", "", "wrap every rule command in the given sandbox launcher")
+	flag.StringVar(&remoteWrapper, "remote", "", "pass every rule command to the given remote execution wrapper")
+	flag.BoolVar(&moduleAliases, "module_aliases", false, "write a phony target for each module and module variant")
+	flag.StringVar(&defaultTags, "default_tags", "", "only build modules with one of a comma separated list of tags by default")
+	flag.StringVar(&shardNinja, "shard", "", "split module build actions into subninja files by \"dir\" or \"type\"")
+	flag.BoolVar(&shardInclude, "shard_include", false, "use include instead of subninja statements for the -shard files")
+	flag.StringVar(&buildReportFile, "build_report", "", "write a report on the time taken by the previous build to file")
+	flag.StringVar(&reportFormat, "build_report_format", "text", "the format of the -build_report file, \"text\" or \"json\"")
+	flag.BoolVar(&strictDeprecate, "strict_deprecated", false, "make the use of deprecated properties an error")
+}
+
+var ninjaShardModes = map[string]blueprint.NinjaShardMode{
+	"dir":  blueprint.NinjaShardByDirectory,
+	"type": blueprint.NinjaShardByModuleType,
 }
 
 func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...string) {
@@ -119,6 +150,8 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 
 	ctx.RegisterSingletonType("glob", globSingletonFactory(ctx))
 
+	ctx.SetStrictDeprecatedProperties(strictDeprecate)
+
 	deps, errs := ctx.ParseFileList(filepath.Dir(bootstrapConfig.topLevelBlueprintsFile), filesToParse)
 	if len(errs) > 0 {
 		fatalErrors(errs)
@@ -141,6 +174,13 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 		return
 	}
 
+	ctx.SetSandboxLauncher(sandbox)
+	ctx.SetRemoteWrapper(remoteWrapper)
+	ctx.SetModuleAliases(moduleAliases)
+	if defaultTags != "" {
+		ctx.SetDefaultTags(strings.Split(defaultTags, ","))
+	}
+
 	if c, ok := config.(ConfigStopBefore); ok {
 		if c.StopBefore() == StopBeforePrepareBuildActions {
 			return
@@ -152,9 +192,27 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 		fatalErrors(errs)
 	}
 	deps = append(deps, extraDeps...)
+	printWarnings(ctx.Warnings())
+
+	if actionQuery != "" {
+		err := queryActions(ctx, actionQuery, os.Stdout)
+		if err != nil {
+			fatalf("error querying actions: %s", err)
+		}
+		return
+	}
 
 	buf := bytes.NewBuffer(nil)
-	err = ctx.WriteBuildFile(buf)
+	if shardNinja != "" {
+		mode, ok := ninjaShardModes[shardNinja]
+		if !ok {
+			fatalf("unknown -shard mode %q", shardNinja)
+		}
+		ctx.SetShardIncludes(shardInclude)
+		_, err = ctx.WriteShardedBuildFile(buf, outFile+".shards", mode)
+	} else {
+		err = ctx.WriteBuildFile(buf)
+	}
 	if err != nil {
 		fatalf("error generating Ninja file contents: %s", err)
 	}
@@ -165,6 +223,24 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 		fatalf("error writing %s: %s", outFile, err)
 	}
 
+	if graphFile != "" {
+		err := writeBuildGraph(ctx, graphFile, blueprint.JSONBuildGraphWriter)
+		if err != nil {
+			fatalf("error writing %s: %s", graphFile, err)
+		}
+	}
+
+	if compdbFile != "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			fatalf("error getting working directory: %s", err)
+		}
+		err = writeBuildGraph(ctx, compdbFile, blueprint.CompileCommandsWriter(cwd))
+		if err != nil {
+			fatalf("error writing %s: %s", compdbFile, err)
+		}
+	}
+
 	if depFile != "" {
 		err := deptools.WriteDepFile(depFile, outFile, deps)
 		if err != nil {
@@ -172,6 +248,13 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 		}
 	}
 
+	if buildReportFile != "" {
+		err := writeBuildReport(ctx, SrcDir, buildReportFile, reportFormat)
+		if err != nil {
+			fatalf("error writing build report: %s", err)
+		}
+	}
+
 	if c, ok := config.(ConfigRemoveAbandonedFilesUnder); ok {
 		under := c.RemoveAbandonedFilesUnder()
 		err := removeAbandonedFilesUnder(ctx, bootstrapConfig, SrcDir, under)
@@ -190,12 +273,33 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 	}
 }
 
+func writeBuildGraph(ctx *blueprint.Context, filename string,
+	writer blueprint.BuildGraphWriter) error {
+
+	buf := bytes.NewBuffer(nil)
+	err := ctx.WriteBuildGraph(buf, writer)
+	if err != nil {
+		return err
+	}
+
+	return pathtools.WriteFileIfChanged(filename, buf.Bytes(), 0666)
+}
+
 func fatalf(format string, args ...interface{}) {
 	fmt.Printf(format, args...)
 	fmt.Print("\n")
 	os.Exit(1)
 }
 
+func printWarnings(warnings []error) {
+	yellow := "\x1b[33m"
+	unyellow := "\x1b[0m"
+
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%swarning:%s %s\n", yellow, unyellow, warning)
+	}
+}
+
 func fatalErrors(errs []error) {
 	red := "\x1b[31m"
 	unred := "\x1b[0m"
@@ -0,0 +1,75 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// parseActionFilter parses a comma separated list of
+// key=value pairs, where each key is one of output,
+// input, rule or module.
+func parseActionFilter(query string) (blueprint.ActionFilter, error) {
+	var filter blueprint.ActionFilter
+
+	for _, term := range strings.Split(query, ",") {
+		if term == "" {
+			continue
+		}
+
+		i := strings.IndexRune(term, '=')
+		if i == -1 {
+			return filter, fmt.Errorf("query term %q is not of the form key=value", term)
+		}
+
+		key, value := term[:i], term[i+1:]
+		switch key {
+		case "output":
+			filter.Output = value
+		case "input":
+			filter.Input = value
+		case "rule":
+			filter.Rule = value
+		case "module":
+			filter.Module = value
+		default:
+			return filter, fmt.Errorf("unknown query key %q", key)
+		}
+	}
+
+	return filter, nil
+}
+
+func queryActions(ctx *blueprint.Context, query string, w io.Writer) error {
+	filter, err := parseActionFilter(query)
+	if err != nil {
+		return err
+	}
+
+	actions, err := ctx.Actions(filter)
+	if err != nil {
+		return err
+	}
+
+	for _, action := range actions {
+		owner := "singleton " + action.Singleton
+		if action.Module != "" {
+			owner = fmt.Sprintf("module %q", action.Module)
+			if action.Variant != "" {
+				owner += fmt.Sprintf(" variant %q", action.Variant)
+			}
+		}
+
+		fmt.Fprintf(w, "%s\n", strings.Join(action.Outputs, " "))
+		fmt.Fprintf(w, "    owner:   %s\n", owner)
+		fmt.Fprintf(w, "    rule:    %s\n", action.Rule)
+		if action.Command != "" {
+			fmt.Fprintf(w, "    command: %s\n", action.Command)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
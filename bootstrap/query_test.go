@@ -0,0 +1,62 @@
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+func TestParseActionFilter(t *testing.T) {
+	testCases := []struct {
+		query  string
+		filter blueprint.ActionFilter
+		err    string
+	}{
+		{
+			query:  "",
+			filter: blueprint.ActionFilter{},
+		},
+		{
+			query:  "output=out/a.o",
+			filter: blueprint.ActionFilter{Output: "out/a.o"},
+		},
+		{
+			query: "input=a.c,rule=g.cc.compile,module=a,",
+			filter: blueprint.ActionFilter{
+				Input:  "a.c",
+				Rule:   "g.cc.compile",
+				Module: "a",
+			},
+		},
+		{
+			query:  "output=a=b",
+			filter: blueprint.ActionFilter{Output: "a=b"},
+		},
+		{
+			query: "output",
+			err:   `query term "output" is not of the form key=value`,
+		},
+		{
+			query: "target=a",
+			err:   `unknown query key "target"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		filter, err := parseActionFilter(testCase.query)
+		if testCase.err != "" {
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("%q: expected error %q, got %v", testCase.query, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", testCase.query, err)
+			continue
+		}
+		if filter != testCase.filter {
+			t.Errorf("%q: incorrect filter:\n  expected: %+v\n       got: %+v", testCase.query,
+				testCase.filter, filter)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/bootstrap/bpdoc"
@@ -72,7 +73,9 @@ func writeDocs(ctx *blueprint.Context, filename string) error {
 		"unique": func() int {
 			unique++
 			return unique
-		}}).Parse(fileTemplate)
+		},
+		"join": strings.Join,
+	}).Parse(fileTemplate)
 	if err != nil {
 		return err
 	}
@@ -145,6 +148,7 @@ const (
           <div class="panel-body">
             <p>{{.Text}}</p>
             {{range .OtherTexts}}<p>{{.}}</p>{{end}}
+            {{with .Constraints}}<p><i>Constraints: {{join . "; "}}</i></p>{{end}}
             {{template "properties" .Properties}}
           </div>
         </div>
@@ -154,6 +158,7 @@ const (
           <p>{{.Text}}</p>
           {{range .OtherTexts}}<p>{{.}}</p>{{end}}
           <p><i>Type: {{.Type}}</i></p>
+          {{with .Constraints}}<p><i>Constraints: {{join . "; "}}</i></p>{{end}}
           {{if .Default}}<p><i>Default: {{.Default}}</i></p>{{end}}
         </div>
       {{end}}
@@ -81,12 +81,41 @@ type Context struct {
 	// set by SetAllowMissingDependencies
 	allowMissingDependencies bool
 
+	// set by SetAllowedDuplicateOutputs
+	allowedDuplicateOutputs map[string]bool
+
+	// set by SetMaxCommandLength
+	maxCommandLength int
+
+	// set by SetSandboxLauncher
+	sandboxLauncher string
+
+	// set by SetRemoteWrapper
+	remoteWrapper string
+
+	// set by SetModuleAliases
+	moduleAliases bool
+
+	// set by SetDefaultTags
+	defaultTags map[string]bool
+
+	// set by SetShardIncludes
+	shardIncludes bool
+
+	// set by SetStrictDeprecatedProperties
+	strictDeprecatedProperties bool
+
+	// set during Parse and by CreateModule
+	deprecatedModules []*moduleInfo // The modules that use deprecated properties.
+
 	// set during PrepareBuildActions
 	pkgNames        map[*packageContext]string
 	liveGlobals     *liveTracker
 	globalVariables map[Variable]*ninjaString
 	globalPools     map[Pool]*poolDef
 	globalRules     map[Rule]*ruleDef
+	warnings        []error
+	defaultTargets  []*ninjaString
 
 	// set during PrepareBuildActions
 	ninjaBuildDir      *ninjaString // The builddir special Ninja variable
@@ -141,9 +170,15 @@ func (e *PropertyError) Error() string {
 }
 
 type localBuildActions struct {
-	variables []*localVariable
-	rules     []*localRule
-	buildDefs []*buildDef
+	variables      []*localVariable
+	rules          []*localRule
+	buildDefs      []*buildDef
+	validations    []*validationDef
+	primaryOutputs []*ninjaString
+}
+
+func (l *localBuildActions) hasActions() bool {
+	return len(l.variables)+len(l.rules)+len(l.buildDefs) > 0
 }
 
 type moduleGroup struct {
@@ -162,6 +197,9 @@ type moduleInfo struct {
 	relBlueprintsFile string
 	pos               scanner.Position
 	propertyPos       map[string]scanner.Position
+	replaceProperties map[string]bool
+
+	deprecatedProperties []DeprecatedProperty
 
 	variantName       string
 	variant           variationMap
@@ -187,6 +225,7 @@ type moduleInfo struct {
 
 	// set during PrepareBuildActions
 	actionDefs localBuildActions
+	tags       []string
 }
 
 type depInfo struct {
@@ -195,6 +234,11 @@ type depInfo struct {
 }
 
 func (module *moduleInfo) Name() string {
+	if module.group == nil {
+		// The module hasn't been added to a group yet, so
+		// it is only named by its name property.
+		return module.logicModule.Name()
+	}
 	return module.group.name
 }
 
@@ -279,6 +323,7 @@ func newContext() *Context {
 		moduleInfo:         make(map[Module]*moduleInfo),
 		globs:              make(map[string]GlobPath),
 		fs:                 pathtools.OsFs,
+		maxCommandLength:   defaultMaxCommandLength,
 		ninjaBuildDir:      nil,
 		requiredNinjaMajor: 1,
 		requiredNinjaMinor: 7,
@@ -336,11 +381,29 @@ type ModuleFactory func() (m Module, propertyStructs []interface{})
 // converted to lower-case.
 //
 // The fields of the properties struct must be either
-// []string, a string, or bool. The Context will panic
+// []string, a string, bool, int32, int64 or uint64, a
+// pointer to any of those, a nested struct, a slice of
+// any of these, or a map from strings to any of these.
+// Integer values that don't fit in the type of their
+// field are rejected, and so are values of named string
+// types that implement proptools.Enum that are not
+// listed by their Enum method. The Context will panic
 // if a Module gets instantiated with a properties
 // struct containing a field that is not one these
 // supported types.
 //
+// Fields can declare constraints on their values,
+// reporting a PropertyError if they are not met: a
+// `blueprint:"required"` tag requires the property to
+// be set to a non-zero value, `enum:"a,b,c"` limits a
+// string to a set of values, `range:"0,64"` limits an
+// integer to an inclusive range, and `pattern:"regex"`
+// requires a string to match a regular expression.
+// Required properties are checked once the mutators
+// have run, so they may be set by a mutator that applies
+// defaults. The other constraints are checked when the
+// module is parsed.
+//
 // Any properties that appear in the Blueprints files
 // that are not built-in module properties
 // (such as "name" and "deps") and do not have a
@@ -605,6 +668,201 @@ func (c *Context) SetAllowMissingDependencies(allowMissingDependencies bool) {
 	c.allowMissingDependencies = allowMissingDependencies
 }
 
+// SetAllowedDuplicateOutputs sets a list of output
+// paths that may be generated by more than one build
+// statement, as long as the build statements are
+// identical once all variables are expanded. Only the
+// first of the identical build statements is written
+// to the Ninja file. Any other output generated by more
+// than one build statement is reported as an error by
+// PrepareBuildActions.
+func (c *Context) SetAllowedDuplicateOutputs(outputs []string) {
+	c.allowedDuplicateOutputs = make(map[string]bool)
+	for _, output := range outputs {
+		c.allowedDuplicateOutputs[output] = true
+	}
+}
+
+// Linux limits the length of a single argument, such as
+// the command that Ninja passes to sh -c, to 128KiB
+// including the terminating NUL.
+const defaultMaxCommandLength = 128*1024 - 1
+
+// SetMaxCommandLength sets the length above which an
+// expanded build statement command is considered too
+// long to run. Build statements with longer commands
+// whose rule sets RuleParams.RspfileCommand will use a
+// variant of the rule that passes its inputs through a
+// response file instead. PrepareBuildActions reports an
+// error for longer commands whose rule doesn't.
+func (c *Context) SetMaxCommandLength(maxCommandLength int) {
+	c.maxCommandLength = maxCommandLength
+}
+
+// SetSandboxLauncher wraps the command of every rule,
+// other than generator rules, in calls to launcher so
+// that each build statement runs in its own sandbox
+// directory and can only read the inputs it declares.
+// The wrapped command is written as:
+//
+//     launcher -setup DIR INPUTS... &&
+//         (cd DIR && COMMAND); launcher -finish DIR STATUS OUTPUTS...
+//
+// DIR is the first output of the build statement with
+// a .sandbox suffix. INPUTS are the explicit and
+// implicit inputs, including the rule's CommandDeps, and
+// the response file if there is one. OUTPUTS are the
+// explicit and implicit outputs and the depfile if
+// there is one. The -setup step must create DIR and
+// populate it with symlinks to INPUTS at the same
+// relative paths. The -finish step must move OUTPUTS
+// out of DIR, fail if COMMAND wrote any other files,
+// remove DIR and exit with STATUS if it is non-zero.
+// Calling SetSandboxLauncher with an empty launcher
+// disables sandboxing.
+func (c *Context) SetSandboxLauncher(launcher string) {
+	c.sandboxLauncher = launcher
+}
+
+// SetRemoteWrapper passes the command of every rule,
+// other than generator rules and rules that use a
+// response file or RuleParams.HashOutputs, to wrapper so
+// that it can be run on a remote executor. The wrapped
+// command is written as:
+//
+//     wrapper FLAGS... -- /bin/sh SCRIPT
+//
+// SCRIPT is a response file containing the original
+// command, named after the first output of the build
+// statement with a .remote.sh suffix. FLAGS declare
+// everything the command needs to run off-host:
+//
+//     -inputs=PATH,...       the explicit and implicit inputs,
+//                            including the rule's CommandDeps
+//     -outputs=PATH,...      the explicit and implicit outputs
+//     -input_root=DIR        RemoteParams.InputRoot, if set
+//     -output_dirs=DIR,...   RemoteParams.OutputDirs, if set
+//     -platform=KEY=VALUE,.. RemoteParams.Platform, if set
+//     -env=KEY=VALUE         for each of RemoteParams.Env
+//     -no_cache              if RemoteParams.NoCache is set
+//     -local                 if RemoteParams.Local is set
+//
+// The remote parameters are those of the rule combined
+// with those of the build statement. Remote execution
+// takes precedence over SetSandboxLauncher. Calling
+// SetRemoteWrapper with an empty wrapper disables remote
+// execution.
+func (c *Context) SetRemoteWrapper(wrapper string) {
+	c.remoteWrapper = wrapper
+}
+
+// SetModuleAliases sets whether a phony target is
+// written for each module, named after the module, and
+// for each variant of a module, named after the module
+// and the variant separated by a '-'. A variant alias
+// depends on the primary outputs set by
+// ModuleContext.SetPrimaryOutputs, or on all of the
+// explicit outputs of the variant if there are none. A
+// module alias depends on the aliases of its variants.
+// Aliases that would have the same name as an output are
+// not written, and PrepareBuildActions returns an error
+// for aliases of different modules that would have the
+// same name.
+func (c *Context) SetModuleAliases(moduleAliases bool) {
+	c.moduleAliases = moduleAliases
+}
+
+// SetShardIncludes makes WriteShardedBuildFile refer to
+// the shard files with include statements instead of
+// subninja statements. A subninja file is parsed in its
+// own scope, so the variables it defines are not visible
+// to the rest of the manifest. An included file shares
+// the scope of the top level manifest, the same as the
+// output of WriteBuildFile, at the cost of its variables
+// being visible to the shards that follow it.
+func (c *Context) SetShardIncludes(include bool) {
+	c.shardIncludes = include
+}
+
+// SetDefaultTags selects the targets that Ninja builds
+// when no targets are given on its command line. If tags
+// is empty every build statement that doesn't set
+// BuildParams.Optional is built by default. Otherwise
+// only those created by modules that were given one of
+// tags with ModuleContext.AddTags are, and the build
+// statements created by singletons are not.
+func (c *Context) SetDefaultTags(tags []string) {
+	c.defaultTags = nil
+	if len(tags) > 0 {
+		c.defaultTags = make(map[string]bool)
+		for _, tag := range tags {
+			c.defaultTags[tag] = true
+		}
+	}
+}
+
+// SetStrictDeprecatedProperties makes the use of
+// properties tagged with `blueprint:"deprecated"` in
+// Blueprints files or by the modules created by mutators
+// an error. Otherwise each use is reported as a warning
+// by Warnings.
+func (c *Context) SetStrictDeprecatedProperties(strict bool) {
+	c.strictDeprecatedProperties = strict
+}
+
+// DeprecatedProperties returns the uses of deprecated
+// properties in the parsed Blueprints files and by the
+// modules created by mutators, ordered by position, for
+// tools that list or rewrite them.
+func (c *Context) DeprecatedProperties() []DeprecatedProperty {
+	var deprecated []DeprecatedProperty
+	for _, use := range c.deprecatedPropertyUses() {
+		deprecated = append(deprecated, use.DeprecatedProperty)
+	}
+	return deprecated
+}
+
+type deprecatedPropertyUse struct {
+	DeprecatedProperty
+	module *moduleInfo
+}
+
+// deprecatedPropertyUses returns the uses of deprecated
+// properties ordered by position. Modules are parsed
+// concurrently, so the order in which they were added
+// is not deterministic.
+func (c *Context) deprecatedPropertyUses() []deprecatedPropertyUse {
+	var uses []deprecatedPropertyUse
+	for _, module := range c.deprecatedModules {
+		for _, d := range module.deprecatedProperties {
+			uses = append(uses, deprecatedPropertyUse{d, module})
+		}
+	}
+
+	sort.SliceStable(uses, func(i, j int) bool {
+		a, b := uses[i].Pos, uses[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return uses[i].Property < uses[j].Property
+	})
+
+	return uses
+}
+
+func (c *Context) commandWrappers() commandWrappers {
+	return commandWrappers{
+		sandboxLauncher: c.sandboxLauncher,
+		remoteWrapper:   c.remoteWrapper,
+	}
+}
+
 func (c *Context) SetModuleListFile(listFile string) {
 	c.moduleListFile = listFile
 }
@@ -725,9 +983,10 @@ loop:
 			errs = append(errs, newErrs...)
 		case module := <-moduleCh:
 			newErrs := c.addModule(module)
-			if len(newErrs) > 0 {
-				errs = append(errs, newErrs...)
+			if len(newErrs) == 0 {
+				newErrs = c.addDeprecatedProperties(module)
 			}
+			errs = append(errs, newErrs...)
 		case <-doneCh:
 			n := atomic.AddInt32(&numGoroutines, -1)
 			if n == 0 {
@@ -1140,10 +1399,12 @@ func getLocalStringListFromScope(scope *parser.Scope, v string) ([]string, scann
 			ret := make([]string, 0, len(value.Values))
 
 			for _, listValue := range value.Values {
-				s, ok := listValue.(*parser.String)
+				s, ok := listValue.Eval().(*parser.String)
 				if !ok {
-					// The parser should not produce this.
-					panic("non-string value found in list")
+					return nil, scanner.Position{}, &BlueprintError{
+						Err: fmt.Errorf("%q must be a list of strings", v),
+						Pos: assignment.EqualsPos,
+					}
 				}
 
 				ret = append(ret, s.Value)
@@ -1331,20 +1592,81 @@ func (c *Context) processModuleDef(moduleDef *parser.Module, relBlueprintsFile s
 
 	module.relBlueprintsFile = relBlueprintsFile
 
-	propertyMap, errs := unpackProperties(moduleDef.Properties, module.properties...)
+	propertyMap, deprecated, errs := unpackProperties(moduleDef.Properties, module.properties...)
+
+	if c.strictDeprecatedProperties {
+		for _, d := range deprecated {
+			errs = append(errs, propertyErrorf(d.Property, d.Pos, "%s", d.message()))
+		}
+	}
+
 	if len(errs) > 0 {
+		for _, err := range errs {
+			if propertyErr, ok := err.(*PropertyError); ok {
+				propertyErr.module = module
+				if !propertyErr.Pos.IsValid() {
+					propertyErr.Pos = moduleDef.TypePos
+				}
+			}
+		}
 		return nil, errs
 	}
 
+	for i := range deprecated {
+		deprecated[i].Module = module.logicModule.Name()
+	}
+	module.deprecatedProperties = deprecated
+
 	module.pos = moduleDef.TypePos
 	module.propertyPos = make(map[string]scanner.Position)
 	for name, propertyDef := range propertyMap {
 		module.propertyPos[name] = propertyDef.ColonPos
+		if propertyDef.Replace {
+			if module.replaceProperties == nil {
+				module.replaceProperties = make(map[string]bool)
+			}
+			module.replaceProperties[name] = true
+		}
 	}
 
 	return module, nil
 }
 
+// addDeprecatedProperties records the uses of deprecated
+// properties by a module that was parsed from a
+// Blueprints file or created by a mutator, so that they
+// are reported as warnings, or returns them as errors if
+// deprecated properties are not allowed.
+func (c *Context) addDeprecatedProperties(module *moduleInfo) []error {
+	if len(module.deprecatedProperties) == 0 {
+		return nil
+	}
+
+	if c.strictDeprecatedProperties {
+		var errs []error
+		for _, d := range module.deprecatedProperties {
+			errs = append(errs, deprecatedPropertyError(module, d))
+		}
+		return errs
+	}
+
+	c.deprecatedModules = append(c.deprecatedModules, module)
+	return nil
+}
+
+func deprecatedPropertyError(module *moduleInfo, d DeprecatedProperty) error {
+	return &PropertyError{
+		ModuleError: ModuleError{
+			BlueprintError: BlueprintError{
+				Err: errors.New(d.message()),
+				Pos: d.Pos,
+			},
+			module: module,
+		},
+		property: d.Property,
+	}
+}
+
 func (c *Context) addModule(module *moduleInfo) []error {
 	name := module.logicModule.Name()
 	c.moduleInfo[module.logicModule] = module
@@ -1389,11 +1711,55 @@ func (c *Context) ResolveDependencies(config interface{}) (deps []string, errs [
 		return nil, errs
 	}
 	deps = append(deps, mutatorDeps...)
+
+	errs = c.checkRequiredProperties()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	c.cloneModules()
 	c.dependenciesReady = true
 	return deps, nil
 }
 
+// checkRequiredProperties returns an error for each
+// property tagged with `blueprint:"required"` that is
+// not set once the mutators have run, so that required
+// properties can be set by mutators that apply defaults.
+// A property that is missing from several variants of a
+// module is only reported once.
+func (c *Context) checkRequiredProperties() []error {
+	var errs []error
+	reported := make(map[*moduleGroup]map[string]bool)
+
+	for _, module := range c.sortedModules() {
+		for _, property := range requiredProperties(module.properties) {
+			if reported[module.group][property] {
+				continue
+			}
+			if reported[module.group] == nil {
+				reported[module.group] = make(map[string]bool)
+			}
+			reported[module.group][property] = true
+
+			// Report missing properties at the map that should have
+			// contained them, or at the module if there is none.
+			pos := module.pos
+			if i := strings.LastIndex(property, "."); i >= 0 {
+				if parentPos, ok := module.propertyPos[property[:i]]; ok {
+					pos = parentPos
+				}
+			}
+
+			err := propertyErrorf(property, pos, "missing required property")
+			err.module = module
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
 // blueprintDepsMutator is the default for dependencies
 // handling. If the module implements the (deprecated)
 // DynamicDependerModule interface then this set
@@ -1942,10 +2308,38 @@ func (c *Context) PrepareBuildActions(config interface{}) (deps []string, errs [
 	deps = append(deps, depsModules...)
 	deps = append(deps, depsSingletons...)
 
+	errs = c.checkDuplicateOutputs()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	errs = c.attachValidations()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	c.warnings = c.checkRules()
+
+	errs = c.useRspfileRules()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	c.selectDefaultTargets()
+
+	errs = c.checkModuleAliases()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	if c.ninjaBuildDir != nil {
 		c.liveGlobals.addNinjaStringDeps(c.ninjaBuildDir)
 	}
 
+	if v := c.liveGlobals.ninjaVersion; v != (ninjaVersion{}) {
+		c.requireNinjaVersion(v.major, v.minor, v.micro)
+	}
+
 	pkgNames, depsPackages := c.makeUniquePackageNames(c.liveGlobals)
 
 	deps = append(deps, depsPackages...)
@@ -1963,6 +2357,18 @@ func (c *Context) PrepareBuildActions(config interface{}) (deps []string, errs [
 	return deps, nil
 }
 
+// Warnings returns the warnings found while parsing
+// the Blueprints files and by the most recent call to
+// PrepareBuildActions. Warnings do not prevent the
+// Ninja file from being written.
+func (c *Context) Warnings() []error {
+	var warnings []error
+	for _, use := range c.deprecatedPropertyUses() {
+		warnings = append(warnings, deprecatedPropertyError(use.module, use.DeprecatedProperty))
+	}
+	return append(warnings, c.warnings...)
+}
+
 func (c *Context) runMutators(config interface{}) (deps []string, errs []error) {
 	var mutators []*mutatorInfo
 
@@ -2177,6 +2583,10 @@ func (c *Context) runMutator(config interface{}, mutator *mutatorInfo, direction
 		if len(errs) > 0 {
 			return nil, errs
 		}
+		errs = c.addDeprecatedProperties(module)
+		if len(errs) > 0 {
+			return nil, errs
+		}
 		atomic.AddUint32(&c.depsModified, 1)
 	}
 
@@ -2341,6 +2751,7 @@ func (c *Context) generateModuleBuildActions(config interface{}, liveGlobals *li
 			errsCh <- newErrs
 			return true
 		}
+		module.tags = mctx.tags
 		return false
 	})
 
@@ -2417,11 +2828,25 @@ func (c *Context) processLocalBuildActions(out, in *localBuildActions, liveGloba
 		}
 	}
 
+	for _, def := range in.validations {
+		err := liveGlobals.AddValidationDefDeps(def)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	err := liveGlobals.AddNinjaStringListDeps(in.primaryOutputs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return errs
 	}
 
 	out.buildDefs = append(out.buildDefs, in.buildDefs...)
+	out.validations = append(out.validations, in.validations...)
+	out.primaryOutputs = append(out.primaryOutputs, in.primaryOutputs...)
 
 	// We use the now-incorrect set of live "globals" to determine which local
 	// definitions are live.  As we go through copying those live locals to the
@@ -2443,123 +2868,572 @@ func (c *Context) processLocalBuildActions(out, in *localBuildActions, liveGloba
 	return nil
 }
 
-func (c *Context) walkDeps(topModule *moduleInfo, visitDown func(depInfo, *moduleInfo) bool, visitUp func(depInfo, *moduleInfo)) {
+// buildDefOwner identifies the module or singleton
+// that created a build statement.
+type buildDefOwner struct {
+	module    *moduleInfo
+	singleton *singletonInfo
+	def       *buildDef
+}
 
-	visited := make(map[*moduleInfo]bool)
-	var visiting *moduleInfo
+func (o buildDefOwner) String() string {
+	if o.module != nil {
+		return fmt.Sprintf("%s defined at %s", o.module, o.module.pos)
+	}
+	return fmt.Sprintf("singleton %q", o.singleton.name)
+}
 
-	defer func() {
-		if r := recover(); r != nil {
-			panic(newPanicErrorf(r, "WalkDeps(%s, %s, %s) for dependency %s", topModule, funcName(visitDown), funcName(visitUp), visiting))
+func (o buildDefOwner) errorf(format string, args ...interface{}) error {
+	if o.module != nil {
+		return &ModuleError{
+			BlueprintError: BlueprintError{
+				Err: fmt.Errorf(format, args...),
+				Pos: o.module.pos,
+			},
+			module: o.module,
 		}
-	}()
+	}
+	return fmt.Errorf("singleton %s: %s", o.singleton.name, fmt.Sprintf(format, args...))
+}
 
-	var walk func(module *moduleInfo)
-	walk = func(module *moduleInfo) {
-		for _, dep := range module.directDeps {
-			if !visited[dep.module] {
-				visited[dep.module] = true
-				visiting = dep.module
-				recurse := true
-				if visitDown != nil {
-					recurse = visitDown(dep, module)
-				}
-				if recurse {
-					walk(dep.module)
-				}
-				if visitUp != nil {
-					visitUp(dep, module)
-				}
+// selectDefaultTargets collects the outputs of the build
+// statements that should be built by default according
+// to SetDefaultTags, and marks every build statement
+// optional so that they don't write their own default
+// statements.
+func (c *Context) selectDefaultTargets() {
+	c.defaultTargets = nil
+	if c.defaultTags == nil {
+		return
+	}
+
+	for _, module := range c.sortedModules() {
+		tagged := false
+		for _, tag := range module.tags {
+			if c.defaultTags[tag] {
+				tagged = true
+				break
+			}
+		}
+
+		for _, def := range module.actionDefs.buildDefs {
+			if tagged && !def.Optional {
+				c.defaultTargets = append(c.defaultTargets, def.Outputs...)
 			}
+			def.Optional = true
 		}
 	}
 
-	walk(topModule)
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			def.Optional = true
+		}
+	}
 }
 
-type replace struct {
-	from, to *moduleInfo
-}
+// checkRules returns warnings about likely mistakes in
+// the build statements, and the rules they use, that
+// were defined by packages that called
+// PackageContext.EnableRuleChecks.
+func (c *Context) checkRules() []error {
+	var warnings []error
+	checkedRules := make(map[Rule]bool)
 
-type rename struct {
-	group *moduleGroup
-	name  string
-}
+	check := func(owner buildDefOwner) {
+		def := owner.def
+		argNames, enabled := ruleChecks(def.Rule)
+		if !enabled || def.RuleDef == nil {
+			return
+		}
 
-func (c *Context) moduleMatchingVariant(module *moduleInfo, name string) *moduleInfo {
-	targets := c.modulesFromName(name, module.namespace())
+		if !checkedRules[def.Rule] {
+			checkedRules[def.Rule] = true
+			for _, warning := range checkRuleDef(def.RuleDef, argNames) {
+				if _, isLocal := def.Rule.(*localRule); isLocal {
+					warnings = append(warnings, owner.errorf("rule %s: %s", def.Rule, warning))
+				} else {
+					warnings = append(warnings, fmt.Errorf("rule %s: %s", def.Rule, warning))
+				}
+			}
+		}
 
-	if targets == nil {
-		return nil
+		for _, warning := range checkBuildDef(def, argNames) {
+			warnings = append(warnings, owner.errorf("build statement using rule %s: %s",
+				def.Rule, warning))
+		}
 	}
 
-	for _, m := range targets {
-		if module.variantName == m.variantName {
-			return m
+	for _, module := range c.sortedModules() {
+		for _, def := range module.actionDefs.buildDefs {
+			check(buildDefOwner{module: module, def: def})
 		}
 	}
 
-	return nil
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			check(buildDefOwner{singleton: info, def: def})
+		}
+	}
+
+	return warnings
 }
 
-func (c *Context) handleRenames(renames []rename) []error {
+// ruleChecks returns the arguments declared by rule, and
+// whether the package that defined it enabled rule
+// checks.
+func ruleChecks(rule Rule) (argNames map[string]bool, enabled bool) {
+	switch r := rule.(type) {
+	case *staticRule:
+		return r.argNames, r.pctx.ruleChecks
+	case *ruleFunc:
+		return r.argNames, r.pctx.ruleChecks
+	case *localRule:
+		return r.argNames, r.checked
+	default:
+		return nil, false
+	}
+}
+
+// checkDuplicateOutputs reports an error for each
+// output that is generated by more than one build
+// statement, on both of the modules or singletons that
+// created them. Identical build statements for outputs
+// listed in SetAllowedDuplicateOutputs are removed
+// instead.
+func (c *Context) checkDuplicateOutputs() []error {
+	e := newActionEvaluator(c, c.liveGlobals.variables)
+	outputs := make(map[string]buildDefOwner)
+
 	var errs []error
-	for _, rename := range renames {
-		group, name := rename.group, rename.name
-		if name == group.name || len(group.modules) < 1 {
-			continue
-		}
 
-		errs = append(errs, c.nameInterface.Rename(group.name, rename.name, group.namespace)...)
+	identical := func(a, b *buildDef) (bool, error) {
+		actionA, err := e.action(a)
+		if err != nil {
+			return false, err
+		}
+		actionB, err := e.action(b)
+		if err != nil {
+			return false, err
+		}
+		return reflect.DeepEqual(actionA, actionB), nil
 	}
 
-	return errs
-}
+	// check returns true if the build statement should be kept.
+	check := func(owner buildDefOwner) (bool, error) {
+		values, err := e.evalList(owner.def.allOutputs())
+		if err != nil {
+			return false, owner.errorf("%s", err)
+		}
 
-func (c *Context) handleReplacements(replacements []replace) []error {
-	var errs []error
-	for _, replace := range replacements {
-		for _, m := range replace.from.reverseDeps {
-			for i, d := range m.directDeps {
-				if d.module == replace.from {
-					m.directDeps[i].module = replace.to
+		allowed := true
+		reported := make(map[*buildDef]bool)
+		var duplicates []string
+		for _, value := range values {
+			other, ok := outputs[value]
+			if !ok {
+				allowed = false
+				continue
+			}
+			duplicates = append(duplicates, value)
+
+			if c.allowedDuplicateOutputs[value] {
+				same, err := identical(owner.def, other.def)
+				if err != nil {
+					return false, owner.errorf("%s", err)
+				}
+				if same {
+					continue
 				}
 			}
+
+			allowed = false
+			if !reported[other.def] {
+				reported[other.def] = true
+				errs = append(errs,
+					owner.errorf("output %q is also generated by %s", value, other),
+					other.errorf("output %q is also generated by %s", value, owner))
+			}
 		}
 
-		atomic.AddUint32(&c.depsModified, 1)
-	}
+		if len(duplicates) > 0 && allowed {
+			return false, nil
+		}
 
-	return errs
-}
+		for _, value := range values {
+			if _, ok := outputs[value]; !ok {
+				outputs[value] = owner
+			}
+		}
 
-func (c *Context) discoveredMissingDependencies(module *moduleInfo, depName string) (errs []error) {
-	if c.allowMissingDependencies {
-		module.missingDeps = append(module.missingDeps, depName)
-		return nil
+		return true, nil
 	}
-	return []error{c.missingDependencyError(module, depName)}
-}
-
-func (c *Context) missingDependencyError(module *moduleInfo, depName string) (errs error) {
-	err := c.nameInterface.MissingDependencyError(module.Name(), module.namespace(), depName)
 
-	return &BlueprintError{
-		Err: err,
-		Pos: module.pos,
+	for _, module := range c.sortedModules() {
+		defs := module.actionDefs.buildDefs[:0]
+		for _, def := range module.actionDefs.buildDefs {
+			keep, err := check(buildDefOwner{module: module, def: def})
+			if err != nil {
+				return []error{err}
+			}
+			if keep {
+				defs = append(defs, def)
+			}
+		}
+		module.actionDefs.buildDefs = defs
 	}
-}
 
-func (c *Context) modulesFromName(name string, namespace Namespace) []*moduleInfo {
-	group, exists := c.nameInterface.ModuleFromName(name, namespace)
-	if exists {
-		return group.modules
+	for _, info := range c.singletonInfo {
+		defs := info.actionDefs.buildDefs[:0]
+		for _, def := range info.actionDefs.buildDefs {
+			keep, err := check(buildDefOwner{singleton: info, def: def})
+			if err != nil {
+				return []error{err}
+			}
+			if keep {
+				defs = append(defs, def)
+			}
+		}
+		info.actionDefs.buildDefs = defs
 	}
-	return nil
+
+	return errs
 }
 
-func (c *Context) sortedModuleGroups() []*moduleGroup {
-	if c.cachedSortedModuleGroups == nil {
+// useRspfileRules switches build statements whose
+// expanded command, including the HashOutputs wrapper,
+// sandbox launcher or remote wrapper if there is one, is
+// longer than the maximum command length to the
+// response file variant of their rule, which is never
+// run remotely. An
+// error is reported for each over-long command whose
+// rule has no response file variant.
+func (c *Context) useRspfileRules() []error {
+	e := newActionEvaluator(c, c.liveGlobals.variables)
+	rspfileRules := make(map[Rule]Rule)
+
+	// The response file variant of a rule is normally named after the
+	// rule with an "_rsp" suffix. A number is added to the suffix if the
+	// scope of the rule already has a rule with that name, or if another
+	// variant was given that name.
+	generatedNames := make(map[*basicScope]map[string]bool)
+	rspfileRuleName := func(scope *basicScope, name string) string {
+		if generatedNames[scope] == nil {
+			generatedNames[scope] = make(map[string]bool)
+		}
+		rspName := name + "_rsp"
+		for i := 2; scope.rules[rspName] != nil || generatedNames[scope][rspName]; i++ {
+			rspName = fmt.Sprintf("%s_rsp%d", name, i)
+		}
+		generatedNames[scope][rspName] = true
+		return rspName
+	}
+
+	useRspfileRule := func(owner buildDefOwner) (*localRule, error) {
+		def := owner.def
+		if def.RuleDef == nil {
+			return nil, nil
+		}
+
+		action, err := e.action(def)
+		if err != nil {
+			return nil, owner.errorf("%s", err)
+		}
+		command := action.Command
+		if def.RuleDef.HashOutputs {
+			command = hashedOutputsCommand(action)
+		}
+		if def.RuleDef.remote(c.remoteWrapper) {
+			command = remoteWrappedCommand(c.remoteWrapper,
+				def.RuleDef.Remote.merge(def.Remote), action)
+		} else if def.RuleDef.sandboxed(c.sandboxLauncher) {
+			command = sandboxedCommand(c.sandboxLauncher, action)
+		}
+		if len(command) <= c.maxCommandLength {
+			return nil, nil
+		}
+
+		if def.RuleDef.RspfileDef == nil {
+			return nil, owner.errorf("the command of rule %s for output %q is %d bytes long, "+
+				"which is more than the maximum of %d, and the rule doesn't set RspfileCommand",
+				def.Rule, action.Outputs[0], len(command), c.maxCommandLength)
+		}
+
+		rule, ok := rspfileRules[def.Rule]
+		var newLocalRule *localRule
+		if !ok {
+			if local, isLocal := def.Rule.(*localRule); isLocal {
+				newLocalRule = &localRule{
+					namePrefix: local.namePrefix,
+					name_:      rspfileRuleName(local.scope_.parent, local.name_),
+					def_:       def.RuleDef.RspfileDef,
+					argNames:   local.argNames,
+					scope_:     local.scope_,
+					checked:    local.checked,
+				}
+				rule = newLocalRule
+			} else {
+				name := rspfileRuleName(def.Rule.packageContext().getScope(), def.Rule.name())
+				rule = &rspfileRule{def.Rule, name, def.RuleDef.RspfileDef}
+				c.liveGlobals.rules[rule] = def.RuleDef.RspfileDef
+			}
+			rspfileRules[def.Rule] = rule
+		}
+
+		def.Rule = rule
+		def.RuleDef = def.RuleDef.RspfileDef
+
+		return newLocalRule, nil
+	}
+
+	var errs []error
+
+	for _, module := range c.sortedModules() {
+		for _, def := range module.actionDefs.buildDefs {
+			rule, err := useRspfileRule(buildDefOwner{module: module, def: def})
+			if err != nil {
+				errs = append(errs, err)
+			} else if rule != nil {
+				module.actionDefs.rules = append(module.actionDefs.rules, rule)
+			}
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			rule, err := useRspfileRule(buildDefOwner{singleton: info, def: def})
+			if err != nil {
+				errs = append(errs, err)
+			} else if rule != nil {
+				info.actionDefs.rules = append(info.actionDefs.rules, rule)
+			}
+		}
+	}
+
+	return errs
+}
+
+// attachValidations adds the validation targets
+// requested through ModuleContext.AddValidations and
+// SingletonContext.AddValidations to the build
+// statements that produce the requested outputs. The
+// build actions of pre-singletons are not written to
+// the Ninja file, so validations requested by a
+// pre-singleton are reported as errors rather than
+// being dropped.
+func (c *Context) attachValidations() []error {
+	modules := c.sortedModules()
+	singletons := c.singletonInfo
+
+	var errs []error
+	for _, info := range c.preSingletonInfo {
+		if len(info.actionDefs.validations) > 0 {
+			errs = append(errs, fmt.Errorf("pre-singleton %s: cannot add validations, "+
+				"the build actions of pre-singletons are not written to the Ninja file",
+				info.name))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	found := false
+	for _, module := range modules {
+		found = found || len(module.actionDefs.validations) > 0
+	}
+	for _, info := range singletons {
+		found = found || len(info.actionDefs.validations) > 0
+	}
+	if !found {
+		return nil
+	}
+
+	e := newActionEvaluator(c, c.liveGlobals.variables)
+
+	outputs := make(map[string]*buildDef)
+	addOutputs := func(defs []*buildDef) error {
+		for _, def := range defs {
+			values, err := e.evalList(def.allOutputs())
+			if err != nil {
+				return err
+			}
+			for _, value := range values {
+				outputs[value] = def
+			}
+		}
+		return nil
+	}
+	for _, module := range modules {
+		if err := addOutputs(module.actionDefs.buildDefs); err != nil {
+			return []error{err}
+		}
+	}
+	for _, info := range singletons {
+		if err := addOutputs(info.actionDefs.buildDefs); err != nil {
+			return []error{err}
+		}
+	}
+
+	attach := func(v *validationDef) error {
+		output, err := v.Output.EvalWith(e.lookup)
+		if err != nil {
+			return err
+		}
+
+		def, ok := outputs[output]
+		if !ok {
+			return fmt.Errorf("cannot add validations to %q: no build "+
+				"statement produces it", output)
+		}
+
+		def.Validations = append(def.Validations, v.Validations...)
+		def.requireNinjaVersion(ninjaValidationsVersion)
+		c.requireNinjaVersion(ninjaValidationsVersion.major, ninjaValidationsVersion.minor,
+			ninjaValidationsVersion.micro)
+
+		return nil
+	}
+
+	for _, module := range modules {
+		for _, v := range module.actionDefs.validations {
+			if err := attach(v); err != nil {
+				errs = append(errs, &ModuleError{
+					BlueprintError: BlueprintError{
+						Err: err,
+						Pos: module.pos,
+					},
+					module: module,
+				})
+			}
+		}
+	}
+	for _, info := range singletons {
+		for _, v := range info.actionDefs.validations {
+			if err := attach(v); err != nil {
+				errs = append(errs, fmt.Errorf("singleton %s: %s", info.name, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func (c *Context) walkDeps(topModule *moduleInfo, visitDown func(depInfo, *moduleInfo) bool, visitUp func(depInfo, *moduleInfo)) {
+
+	visited := make(map[*moduleInfo]bool)
+	var visiting *moduleInfo
+
+	defer func() {
+		if r := recover(); r != nil {
+			panic(newPanicErrorf(r, "WalkDeps(%s, %s, %s) for dependency %s", topModule, funcName(visitDown), funcName(visitUp), visiting))
+		}
+	}()
+
+	var walk func(module *moduleInfo)
+	walk = func(module *moduleInfo) {
+		for _, dep := range module.directDeps {
+			if !visited[dep.module] {
+				visited[dep.module] = true
+				visiting = dep.module
+				recurse := true
+				if visitDown != nil {
+					recurse = visitDown(dep, module)
+				}
+				if recurse {
+					walk(dep.module)
+				}
+				if visitUp != nil {
+					visitUp(dep, module)
+				}
+			}
+		}
+	}
+
+	walk(topModule)
+}
+
+type replace struct {
+	from, to *moduleInfo
+}
+
+type rename struct {
+	group *moduleGroup
+	name  string
+}
+
+func (c *Context) moduleMatchingVariant(module *moduleInfo, name string) *moduleInfo {
+	targets := c.modulesFromName(name, module.namespace())
+
+	if targets == nil {
+		return nil
+	}
+
+	for _, m := range targets {
+		if module.variantName == m.variantName {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (c *Context) handleRenames(renames []rename) []error {
+	var errs []error
+	for _, rename := range renames {
+		group, name := rename.group, rename.name
+		if name == group.name || len(group.modules) < 1 {
+			continue
+		}
+
+		errs = append(errs, c.nameInterface.Rename(group.name, rename.name, group.namespace)...)
+	}
+
+	return errs
+}
+
+func (c *Context) handleReplacements(replacements []replace) []error {
+	var errs []error
+	for _, replace := range replacements {
+		for _, m := range replace.from.reverseDeps {
+			for i, d := range m.directDeps {
+				if d.module == replace.from {
+					m.directDeps[i].module = replace.to
+				}
+			}
+		}
+
+		atomic.AddUint32(&c.depsModified, 1)
+	}
+
+	return errs
+}
+
+func (c *Context) discoveredMissingDependencies(module *moduleInfo, depName string) (errs []error) {
+	if c.allowMissingDependencies {
+		module.missingDeps = append(module.missingDeps, depName)
+		return nil
+	}
+	return []error{c.missingDependencyError(module, depName)}
+}
+
+func (c *Context) missingDependencyError(module *moduleInfo, depName string) (errs error) {
+	err := c.nameInterface.MissingDependencyError(module.Name(), module.namespace(), depName)
+
+	return &BlueprintError{
+		Err: err,
+		Pos: module.pos,
+	}
+}
+
+func (c *Context) modulesFromName(name string, namespace Namespace) []*moduleInfo {
+	group, exists := c.nameInterface.ModuleFromName(name, namespace)
+	if exists {
+		return group.modules
+	}
+	return nil
+}
+
+func (c *Context) sortedModuleGroups() []*moduleGroup {
+	if c.cachedSortedModuleGroups == nil {
 		unwrap := func(wrappers []ModuleGroup) []*moduleGroup {
 			result := make([]*moduleGroup, 0, len(wrappers))
 			for _, group := range wrappers {
@@ -2983,44 +3857,194 @@ func (c *Context) WriteBuildFile(w io.Writer) error {
 
 	nw := newNinjaWriter(w)
 
-	err := c.writeBuildFileHeader(nw)
+	err := c.writeBuildFileGlobals(nw)
 	if err != nil {
 		return err
 	}
 
-	err = c.writeNinjaRequiredVersion(nw)
+	err = c.writeAllModuleActions(nw)
 	if err != nil {
 		return err
 	}
 
-	// TODO: Group the globals by package.
+	err = c.writeAllSingletonActions(nw)
+	if err != nil {
+		return err
+	}
 
-	err = c.writeGlobalVariables(nw)
+	err = c.writeDefaultTargets(nw)
 	if err != nil {
 		return err
 	}
 
-	err = c.writeGlobalPools(nw)
+	return nil
+}
+
+// NinjaShardMode selects how WriteShardedBuildFile
+// splits the module build actions into separate Ninja
+// files.
+type NinjaShardMode int
+
+const (
+	// NinjaShardByDirectory writes the build actions
+	// of all modules defined in the same directory to
+	// a single file.
+	NinjaShardByDirectory NinjaShardMode = iota
+
+	// NinjaShardByModuleType writes the build actions
+	// of all modules of the same module type to a
+	// single file.
+	NinjaShardByModuleType
+)
+
+func (mode NinjaShardMode) shardFile(module *moduleInfo) string {
+	switch mode {
+	case NinjaShardByDirectory:
+		return filepath.Join(filepath.Dir(module.relBlueprintsFile), "build.ninja")
+	case NinjaShardByModuleType:
+		return module.typeName + ".ninja"
+	default:
+		panic(fmt.Sprintf("unknown ninja shard mode: %d", mode))
+	}
+}
+
+// WriteShardedBuildFile writes the Ninja manifest text
+// for the generated build actions split across
+// multiple files. The global variables, pools and
+// rules are written to w, along with a subninja
+// statement for each shard, or an include statement if
+// SetShardIncludes was called. The module build actions
+// are grouped according to mode and written to files
+// under shardDir, and the singleton build actions are
+// written to shardDir/singletons.ninja. A shard file
+// is only rewritten if its contents have changed, so
+// callers must still write w out unconditionally for
+// Ninja to notice that the manifest was regenerated.
+// The returned shards lists the paths of all of the
+// shard files. If this is called before
+// PrepareBuildActions successfully completes then
+// ErrBuildActionsNotReady is returned.
+func (c *Context) WriteShardedBuildFile(w io.Writer, shardDir string,
+	mode NinjaShardMode) (shards []string, err error) {
+
+	if !c.buildActionsReady {
+		return nil, ErrBuildActionsNotReady
+	}
+
+	nw := newNinjaWriter(w)
+
+	err = c.writeBuildFileGlobals(nw)
+	if err != nil {
+		return nil, err
+	}
+
+	var shardNames []string
+	shardModules := make(map[string][]*moduleInfo)
+	for _, module := range c.sortedModules() {
+		if !module.actionDefs.hasActions() {
+			continue
+		}
+
+		name := mode.shardFile(module)
+		if _, ok := shardModules[name]; !ok {
+			shardNames = append(shardNames, name)
+		}
+		shardModules[name] = append(shardModules[name], module)
+	}
+
+	sort.Strings(shardNames)
+
+	buf := bytes.NewBuffer(nil)
+
+	writeShard := func(name string, write func(*ninjaWriter) error) error {
+		buf.Reset()
+		snw := newNinjaWriter(buf)
+
+		err := snw.Comment(shardHeader)
+		if err != nil {
+			return err
+		}
+
+		err = snw.BlankLine()
+		if err != nil {
+			return err
+		}
+
+		err = write(snw)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(shardDir, name)
+		err = pathtools.WriteFileIfChanged(path, buf.Bytes(), 0666)
+		if err != nil {
+			return err
+		}
+		shards = append(shards, path)
+
+		if c.shardIncludes {
+			return nw.Include(inputEscaper.Replace(path))
+		}
+		return nw.Subninja(inputEscaper.Replace(path))
+	}
+
+	for _, name := range shardNames {
+		modules := shardModules[name]
+		err = writeShard(name, func(snw *ninjaWriter) error {
+			return c.writeModuleActions(snw, modules)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writeShard("singletons.ninja", c.writeAllSingletonActions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.writeModuleAliases(nw)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.writeDefaultTargets(nw)
+	if err != nil {
+		return nil, err
+	}
+
+	return shards, nil
+}
+
+func (c *Context) writeBuildFileGlobals(nw *ninjaWriter) error {
+	err := c.writeBuildFileHeader(nw)
 	if err != nil {
 		return err
 	}
 
-	err = c.writeBuildDir(nw)
+	err = c.writeNinjaRequiredVersion(nw)
 	if err != nil {
 		return err
 	}
 
-	err = c.writeGlobalRules(nw)
+	// TODO: Group the globals by package.
+
+	err = c.writeGlobalVariables(nw)
 	if err != nil {
 		return err
 	}
 
-	err = c.writeAllModuleActions(nw)
+	err = c.writeGlobalPools(nw)
 	if err != nil {
 		return err
 	}
 
-	err = c.writeAllSingletonActions(nw)
+	err = c.writeBuildDir(nw)
+	if err != nil {
+		return err
+	}
+
+	err = c.writeGlobalRules(nw)
 	if err != nil {
 		return err
 	}
@@ -3229,7 +4253,7 @@ func (c *Context) writeGlobalRules(nw *ninjaWriter) error {
 		rule := entity.(Rule)
 		name := rule.fullName(c.pkgNames)
 		def := c.globalRules[rule]
-		err := def.WriteTo(nw, name, c.pkgNames)
+		err := def.WriteTo(nw, name, c.pkgNames, c.commandWrappers())
 		if err != nil {
 			return err
 		}
@@ -3292,7 +4316,216 @@ func (s moduleSorter) Swap(i, j int) {
 	s.modules[i], s.modules[j] = s.modules[j], s.modules[i]
 }
 
+func (c *Context) sortedModules() []*moduleInfo {
+	modules := make([]*moduleInfo, 0, len(c.moduleInfo))
+	for _, module := range c.moduleInfo {
+		modules = append(modules, module)
+	}
+	sort.Sort(moduleSorter{modules, c.nameInterface})
+
+	return modules
+}
+
 func (c *Context) writeAllModuleActions(nw *ninjaWriter) error {
+	err := c.writeModuleActions(nw, c.sortedModules())
+	if err != nil {
+		return err
+	}
+
+	return c.writeModuleAliases(nw)
+}
+
+// moduleAlias is a phony alias for the primary outputs
+// of a module, or for the aliases of all of the variants
+// of a module.
+type moduleAlias struct {
+	name   string
+	module *moduleInfo // The module, or the first variant of the module.
+	deps   []*ninjaString
+}
+
+// moduleAliasList returns the phony module and module
+// variant aliases described in SetModuleAliases.
+func (c *Context) moduleAliasList() []moduleAlias {
+	var aliases []moduleAlias
+	var groups []*moduleGroup
+	variantAliases := make(map[*moduleGroup][]*ninjaString)
+	groupModules := make(map[*moduleGroup]*moduleInfo)
+
+	for _, module := range c.sortedModules() {
+		primary := module.actionDefs.primaryOutputs
+		if len(primary) == 0 {
+			for _, def := range module.actionDefs.buildDefs {
+				primary = append(primary, def.Outputs...)
+			}
+		}
+		if len(primary) == 0 {
+			continue
+		}
+
+		name := module.Name()
+		if module.variantName != "" {
+			name += "-" + module.variantName
+			if _, ok := variantAliases[module.group]; !ok {
+				groups = append(groups, module.group)
+				groupModules[module.group] = module
+			}
+			variantAliases[module.group] = append(variantAliases[module.group],
+				simpleNinjaString(name))
+		}
+
+		aliases = append(aliases, moduleAlias{name, module, primary})
+	}
+
+	for _, group := range groups {
+		aliases = append(aliases, moduleAlias{group.name, groupModules[group], variantAliases[group]})
+	}
+
+	return aliases
+}
+
+// checkModuleAliases returns an error for each module
+// alias that has the same name as the alias of another
+// module, as Ninja doesn't allow two build statements
+// for the same output.
+func (c *Context) checkModuleAliases() []error {
+	if !c.moduleAliases {
+		return nil
+	}
+
+	var errs []error
+	owners := make(map[string]*moduleInfo)
+	for _, alias := range c.moduleAliasList() {
+		if owner, ok := owners[alias.name]; ok {
+			errs = append(errs, &ModuleError{
+				BlueprintError: BlueprintError{
+					Err: fmt.Errorf("module alias %q is also the alias of %s",
+						alias.name, owner),
+					Pos: alias.module.pos,
+				},
+				module: alias.module,
+			})
+			continue
+		}
+		owners[alias.name] = alias.module
+	}
+
+	return errs
+}
+
+// evalPaths returns the paths in list with all of their
+// variable references expanded, escaped with escaper.
+// The expanded paths can be written to any Ninja file,
+// including the top level file of a sharded manifest
+// where module local variables are not defined.
+func (c *Context) evalPaths(e *actionEvaluator, list []*ninjaString,
+	escaper *strings.Replacer) ([]string, error) {
+
+	paths, err := e.evalList(list)
+	if err != nil {
+		return nil, err
+	}
+	for i := range paths {
+		paths[i] = escaper.Replace(paths[i])
+	}
+	return paths, nil
+}
+
+// writeModuleAliases writes the phony module and module
+// variant aliases described in SetModuleAliases.
+// Aliases that have the same name as an output of a
+// build statement are skipped.
+func (c *Context) writeModuleAliases(nw *ninjaWriter) error {
+	if !c.moduleAliases {
+		return nil
+	}
+
+	aliases := c.moduleAliasList()
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	e := newActionEvaluator(c, c.globalVariables)
+
+	outputs := make(map[string]bool)
+	addOutputs := func(defs []*buildDef) error {
+		for _, def := range defs {
+			for _, list := range [][]*ninjaString{def.Outputs, def.ImplicitOutputs} {
+				paths, err := c.evalPaths(e, list, outputEscaper)
+				if err != nil {
+					return err
+				}
+				for _, path := range paths {
+					outputs[path] = true
+				}
+			}
+		}
+		return nil
+	}
+	for _, module := range c.sortedModules() {
+		if err := addOutputs(module.actionDefs.buildDefs); err != nil {
+			return fmt.Errorf("%s: %s", module, err)
+		}
+	}
+	for _, info := range c.singletonInfo {
+		if err := addOutputs(info.actionDefs.buildDefs); err != nil {
+			return fmt.Errorf("singleton %s: %s", info.name, err)
+		}
+	}
+
+	err := nw.Comment("Phony aliases for each module and module variant.")
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range aliases {
+		name := outputEscaper.Replace(alias.name)
+		if outputs[name] {
+			continue
+		}
+
+		deps, err := c.evalPaths(e, alias.deps, inputEscaper)
+		if err != nil {
+			return fmt.Errorf("%s: %s", alias.module, err)
+		}
+
+		err = nw.Build("", "phony", []string{name}, nil, deps, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nw.BlankLine()
+}
+
+// writeDefaultTargets writes the default statement for
+// the targets selected by SetDefaultTags.
+func (c *Context) writeDefaultTargets(nw *ninjaWriter) error {
+	if c.defaultTags == nil {
+		return nil
+	}
+
+	// The targets are expanded, as they can refer to module local
+	// variables that aren't defined in the top level file of a
+	// sharded manifest.
+	e := newActionEvaluator(c, c.globalVariables)
+	targets, err := c.evalPaths(e, c.defaultTargets, outputEscaper)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	err = nw.Default(targets...)
+	if err != nil {
+		return err
+	}
+
+	return nw.BlankLine()
+}
+
+func (c *Context) writeModuleActions(nw *ninjaWriter, modules []*moduleInfo) error {
 	headerTemplate := template.New("moduleHeader")
 	_, err := headerTemplate.Parse(moduleHeaderTemplate)
 	if err != nil {
@@ -3300,16 +4533,10 @@ func (c *Context) writeAllModuleActions(nw *ninjaWriter) error {
 		panic(err)
 	}
 
-	modules := make([]*moduleInfo, 0, len(c.moduleInfo))
-	for _, module := range c.moduleInfo {
-		modules = append(modules, module)
-	}
-	sort.Sort(moduleSorter{modules, c.nameInterface})
-
 	buf := bytes.NewBuffer(nil)
 
 	for _, module := range modules {
-		if len(module.actionDefs.variables)+len(module.actionDefs.rules)+len(module.actionDefs.buildDefs) == 0 {
+		if !module.actionDefs.hasActions() {
 			continue
 		}
 
@@ -3372,7 +4599,7 @@ func (c *Context) writeAllSingletonActions(nw *ninjaWriter) error {
 	buf := bytes.NewBuffer(nil)
 
 	for _, info := range c.singletonInfo {
-		if len(info.actionDefs.variables)+len(info.actionDefs.rules)+len(info.actionDefs.buildDefs) == 0 {
+		if !info.actionDefs.hasActions() {
 			continue
 		}
 
@@ -3450,7 +4677,7 @@ func (c *Context) writeLocalBuildActions(nw *ninjaWriter,
 			panic(err)
 		}
 
-		err = def.WriteTo(nw, name, c.pkgNames)
+		err = def.WriteTo(nw, name, c.pkgNames, c.commandWrappers())
 		if err != nil {
 			return err
 		}
@@ -3463,7 +4690,7 @@ func (c *Context) writeLocalBuildActions(nw *ninjaWriter,
 
 	// Write the build definitions.
 	for _, buildDef := range defs.buildDefs {
-		err := buildDef.WriteTo(nw, c.pkgNames)
+		err := buildDef.WriteTo(nw, c.pkgNames, c.commandWrappers())
 		if err != nil {
 			return err
 		}
@@ -3538,6 +4765,13 @@ they were generated by the following Go packages:
 
 `
 
+var shardHeader = `******************************************************************************
+***            This file is generated and should not be edited             ***
+******************************************************************************
+
+This file is included from the top-level Ninja file with a subninja statement.
+`
+
 var moduleHeaderTemplate = `# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # 
 Module:  {{.name}}
 Variant: {{.variant}}
@@ -0,0 +1,1620 @@
+package blueprint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/blueprint/proptools"
+)
+
+var pctx = NewPackageContext("github.com/google/blueprint")
+
+var copyRule = pctx.StaticRule("cp", RuleParams{
+	Command:     "cp $in $out",
+	Description: "cp $out",
+})
+
+// testModule is a module type for tests. It generates
+// a single build statement that copies Srcs to Outs
+// using copyRule, after passing its BuildParams to the
+// config if it is a testBuildParams function.
+type testModule struct {
+	SimpleName
+	properties struct {
+		Srcs []string
+		Outs []string
+	}
+}
+
+func newTestModule() (Module, []interface{}) {
+	m := &testModule{}
+	return m, []interface{}{&m.SimpleName.Properties, &m.properties}
+}
+
+func (m *testModule) GenerateBuildActions(ctx ModuleContext) {
+	if len(m.properties.Outs) == 0 {
+		return
+	}
+
+	params := BuildParams{
+		Rule:    copyRule,
+		Outputs: m.properties.Outs,
+		Inputs:  m.properties.Srcs,
+	}
+	if f, ok := ctx.Config().(testBuildParams); ok && f != nil {
+		f(ctx, &params)
+	}
+	ctx.Build(pctx, params)
+}
+
+// testBuildParams is passed as the config to let a test
+// modify the BuildParams of each testModule.
+type testBuildParams func(ctx ModuleContext, params *BuildParams)
+
+// newTestContext returns a Context with the test module
+// type registered and the given Blueprints files parsed.
+func newTestContext(t *testing.T, files map[string]string) *Context {
+	ctx := NewContext()
+	ctx.RegisterModuleType("test", newTestModule)
+
+	mockFiles := make(map[string][]byte)
+	for name, contents := range files {
+		mockFiles[name] = []byte(contents)
+	}
+	ctx.MockFileSystem(mockFiles)
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors:\n%s", joinErrors(errs))
+	}
+
+	return ctx
+}
+
+// prepareTestContext runs ResolveDependencies and
+// PrepareBuildActions on ctx, returning the errors from
+// whichever fails first.
+func prepareTestContext(ctx *Context, config interface{}) []error {
+	_, errs := ctx.ResolveDependencies(config)
+	if len(errs) > 0 {
+		return errs
+	}
+	_, errs = ctx.PrepareBuildActions(config)
+	return errs
+}
+
+// runTestContext is like newTestContext, but it also
+// prepares the build actions and fails the test if
+// that reports any errors.
+func runTestContext(t *testing.T, files map[string]string, config interface{}) *Context {
+	ctx := newTestContext(t, files)
+	if errs := prepareTestContext(ctx, config); len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+	return ctx
+}
+
+// buildFile returns the Ninja file written for ctx.
+func buildFile(t *testing.T, ctx *Context) string {
+	buf := &bytes.Buffer{}
+	err := ctx.WriteBuildFile(buf)
+	if err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	return buf.String()
+}
+
+func joinErrors(errs []error) string {
+	var s []string
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+func TestWriteShardedBuildFile(t *testing.T) {
+	files := map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.in"],
+				outs: ["a.out"],
+			}
+		`,
+		"sub/Blueprints": `
+			test {
+				name: "b",
+				srcs: ["b.in"],
+				outs: ["b.out"],
+			}
+
+			test {
+				name: "c",
+			}
+		`,
+	}
+
+	testCases := []struct {
+		name     string
+		mode     NinjaShardMode
+		includes bool
+		shards   map[string][]string // The outputs in each shard file.
+	}{
+		{
+			name: "by directory",
+			mode: NinjaShardByDirectory,
+			shards: map[string][]string{
+				"build.ninja":      {"a.out"},
+				"sub/build.ninja":  {"b.out"},
+				"singletons.ninja": nil,
+			},
+		},
+		{
+			name: "by module type",
+			mode: NinjaShardByModuleType,
+			shards: map[string][]string{
+				"test.ninja":       {"a.out", "b.out"},
+				"singletons.ninja": nil,
+			},
+		},
+		{
+			name:     "includes",
+			mode:     NinjaShardByModuleType,
+			includes: true,
+			shards: map[string][]string{
+				"test.ninja":       {"a.out", "b.out"},
+				"singletons.ninja": nil,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "shards")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			ctx := runTestContext(t, files, nil)
+			ctx.SetShardIncludes(testCase.includes)
+
+			buf := &bytes.Buffer{}
+			shards, err := ctx.WriteShardedBuildFile(buf, dir, testCase.mode)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(shards) != len(testCase.shards) {
+				t.Errorf("expected %d shards, got %q", len(testCase.shards), shards)
+			}
+
+			statement := "subninja "
+			if testCase.includes {
+				statement = "include "
+			}
+
+			for _, shard := range shards {
+				name, err := filepath.Rel(dir, shard)
+				if err != nil {
+					t.Fatal(err)
+				}
+				outs, ok := testCase.shards[name]
+				if !ok {
+					t.Errorf("unexpected shard %q", name)
+					continue
+				}
+
+				if !strings.Contains(buf.String(), "\n"+statement+shard+"\n") {
+					t.Errorf("expected %q%s in the top level manifest:\n%s", statement, shard, buf)
+				}
+
+				contents, err := ioutil.ReadFile(shard)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, out := range outs {
+					if !strings.Contains(string(contents), "build "+out+": ") {
+						t.Errorf("expected a build statement for %q in %s:\n%s", out, name, contents)
+					}
+					if strings.Contains(buf.String(), "build "+out+": ") {
+						t.Errorf("unexpected build statement for %q in the top level manifest", out)
+					}
+				}
+			}
+
+			if !strings.Contains(buf.String(), "\nrule g.blueprint.cp\n") {
+				t.Errorf("expected the rules in the top level manifest:\n%s", buf)
+			}
+		})
+	}
+}
+
+func TestWriteShardedBuildFileUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := runTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.in"],
+				outs: ["a.out"],
+			}
+		`,
+	}, nil)
+
+	shards, err := ctx.WriteShardedBuildFile(ioutil.Discard, dir, NinjaShardByDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Backdate the shards so that a rewrite would be noticed.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, shard := range shards {
+		if err := os.Chtimes(shard, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = ctx.WriteShardedBuildFile(ioutil.Discard, dir, NinjaShardByDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, shard := range shards {
+		info, err := os.Stat(shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("expected unchanged shard %s not to be rewritten", shard)
+		}
+	}
+}
+
+var dyndepRule = pctx.StaticRule("dyndep", RuleParams{
+	Command: "cp $in $out",
+	Dyndep:  "$out.dd",
+})
+
+func TestDyndep(t *testing.T) {
+	bp := map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.in"],
+				outs: ["a.out"],
+			}
+		`,
+	}
+
+	testCases := []struct {
+		name    string
+		params  testBuildParams
+		want    []string
+		notWant []string
+		err     string
+	}{
+		{
+			name: "none",
+			params: func(ctx ModuleContext, params *BuildParams) {
+			},
+			want:    []string{"ninja_required_version = 1.7.0\n"},
+			notWant: []string{"dyndep = "},
+		},
+		{
+			name: "build statement",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Dyndep = "a.dd"
+				params.Implicits = []string{"a.dd"}
+			},
+			want: []string{
+				"ninja_required_version = 1.10.0\n",
+				"build a.out: g.blueprint.cp a.in | a.dd\n    dyndep = a.dd\n",
+			},
+		},
+		{
+			name: "order only",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Dyndep = "a.dd"
+				params.OrderOnly = []string{"a.dd"}
+			},
+			want: []string{"    dyndep = a.dd\n"},
+		},
+		{
+			name: "rule",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = dyndepRule
+			},
+			want: []string{
+				"ninja_required_version = 1.10.0\n",
+				"rule g.blueprint.dyndep\n    command = cp ${in} ${out}\n    dyndep = ${out}.dd\n",
+			},
+		},
+		{
+			name: "not an input",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Dyndep = "a.dd"
+			},
+			err: `Dyndep file "a.dd" is not listed in Inputs, Implicits or OrderOnly`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := newTestContext(t, bp)
+			errs := prepareTestContext(ctx, testCase.params)
+			if testCase.err != "" {
+				if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+			}
+
+			out := buildFile(t, ctx)
+			for _, want := range testCase.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in:\n%s", want, out)
+				}
+			}
+			for _, notWant := range testCase.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+// testSingleton is a singleton for tests that calls
+// generate from GenerateBuildActions.
+type testSingleton struct {
+	generate func(ctx SingletonContext)
+}
+
+func (s *testSingleton) GenerateBuildActions(ctx SingletonContext) {
+	s.generate(ctx)
+}
+
+func newTestSingleton(generate func(ctx SingletonContext)) SingletonFactory {
+	return func() Singleton {
+		return &testSingleton{generate}
+	}
+}
+
+func TestValidations(t *testing.T) {
+	bp := map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.in"],
+				outs: ["a.out"],
+			}
+
+			test {
+				name: "b",
+				srcs: ["b.in"],
+				outs: ["b.out"],
+			}
+		`,
+	}
+
+	testCases := []struct {
+		name         string
+		params       testBuildParams
+		singleton    func(ctx SingletonContext)
+		preSingleton func(ctx SingletonContext)
+		want         []string
+		err          string
+	}{
+		{
+			name: "build params",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				if ctx.ModuleName() == "a" {
+					params.Validations = []string{"a.check"}
+				}
+			},
+			want: []string{
+				"ninja_required_version = 1.11.0\n",
+				"build a.out: g.blueprint.cp a.in |@ a.check\n",
+				"build b.out: g.blueprint.cp b.in\n",
+			},
+		},
+		{
+			name: "other module",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				if ctx.ModuleName() == "b" {
+					ctx.AddValidations(pctx, "a.out", "b.check")
+				}
+			},
+			want: []string{
+				"ninja_required_version = 1.11.0\n",
+				"build a.out: g.blueprint.cp a.in |@ b.check\n",
+				"build b.out: g.blueprint.cp b.in\n",
+			},
+		},
+		{
+			name: "singleton",
+			singleton: func(ctx SingletonContext) {
+				ctx.AddValidations(pctx, "b.out", "s.check", "t.check")
+			},
+			want: []string{
+				"build a.out: g.blueprint.cp a.in\n",
+				"build b.out: g.blueprint.cp b.in |@ s.check t.check\n",
+			},
+		},
+		{
+			name: "no build statement",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				if ctx.ModuleName() == "b" {
+					ctx.AddValidations(pctx, "c.out", "b.check")
+				}
+			},
+			err: `cannot add validations to "c.out": no build statement produces it`,
+		},
+		{
+			name: "pre-singleton",
+			preSingleton: func(ctx SingletonContext) {
+				ctx.AddValidations(pctx, "a.out", "s.check")
+			},
+			err: "pre-singleton pre: cannot add validations",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := newTestContext(t, bp)
+			if testCase.singleton != nil {
+				ctx.RegisterSingletonType("singleton", newTestSingleton(testCase.singleton))
+			}
+			if testCase.preSingleton != nil {
+				ctx.RegisterPreSingletonType("pre", newTestSingleton(testCase.preSingleton))
+			}
+
+			errs := prepareTestContext(ctx, testCase.params)
+			if testCase.err != "" {
+				if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+			}
+
+			out := buildFile(t, ctx)
+			for _, want := range testCase.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateOutputs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		bp      string
+		allowed []string
+		outputs []string // The first output of each build statement that is kept.
+		errs    []string
+	}{
+		{
+			name: "unique",
+			bp: `
+				test {
+					name: "a",
+					srcs: ["a.in"],
+					outs: ["a.out"],
+				}
+
+				test {
+					name: "b",
+					srcs: ["a.in"],
+					outs: ["b.out"],
+				}
+			`,
+			outputs: []string{"a.out", "b.out"},
+		},
+		{
+			name: "duplicate",
+			bp: `
+				test {
+					name: "a",
+					srcs: ["a.in"],
+					outs: ["a.out"],
+				}
+
+				test {
+					name: "b",
+					srcs: ["b.in"],
+					outs: ["b.out", "a.out"],
+				}
+			`,
+			errs: []string{
+				`Blueprints:8:5: module "b": output "a.out" is also generated by module "a"`,
+				`Blueprints:2:5: module "a": output "a.out" is also generated by module "b"`,
+			},
+		},
+		{
+			name: "allowed identical",
+			bp: `
+				test {
+					name: "a",
+					srcs: ["a.in"],
+					outs: ["a.out"],
+				}
+
+				test {
+					name: "b",
+					srcs: ["a.in"],
+					outs: ["a.out"],
+				}
+			`,
+			allowed: []string{"a.out"},
+			outputs: []string{"a.out"},
+		},
+		{
+			name: "allowed but different",
+			bp: `
+				test {
+					name: "a",
+					srcs: ["a.in"],
+					outs: ["a.out"],
+				}
+
+				test {
+					name: "b",
+					srcs: ["b.in"],
+					outs: ["a.out"],
+				}
+			`,
+			allowed: []string{"a.out"},
+			errs: []string{
+				`Blueprints:8:5: module "b": output "a.out" is also generated by module "a"`,
+				`Blueprints:2:5: module "a": output "a.out" is also generated by module "b"`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := newTestContext(t, map[string]string{"Blueprints": testCase.bp})
+			ctx.SetAllowedDuplicateOutputs(testCase.allowed)
+
+			errs := prepareTestContext(ctx, nil)
+			if len(testCase.errs) > 0 {
+				var got []string
+				for _, err := range errs {
+					got = append(got, err.Error())
+				}
+				for i := range got {
+					// Strip the position of the other module from the error.
+					got[i] = strings.Split(got[i], " defined at ")[0]
+				}
+				if !reflect.DeepEqual(got, testCase.errs) {
+					t.Errorf("incorrect errors:\n  expected: %q\n       got: %q", testCase.errs, got)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+			}
+
+			actions, err := ctx.Actions(ActionFilter{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var outputs []string
+			for _, action := range actions {
+				outputs = append(outputs, action.Outputs[0])
+			}
+			if !reflect.DeepEqual(outputs, testCase.outputs) {
+				t.Errorf("incorrect outputs:\n  expected: %q\n       got: %q", testCase.outputs, outputs)
+			}
+		})
+	}
+}
+
+func TestBuildDefAllOutputs(t *testing.T) {
+	outputs := make([]*ninjaString, 1, 4)
+	outputs[0] = simpleNinjaString("a.out")
+	def := &buildDef{
+		Outputs:         outputs,
+		ImplicitOutputs: []*ninjaString{simpleNinjaString("b.out")},
+	}
+
+	all := def.allOutputs()
+	all = append(all, simpleNinjaString("c.out"))
+
+	if len(all) != 3 || all[1].Value(nil) != "b.out" {
+		t.Errorf("expected a.out, b.out and c.out, got %d outputs", len(all))
+	}
+	if extra := outputs[:2][1]; extra != nil {
+		t.Errorf("expected the spare capacity of Outputs not to be written, got %q",
+			extra.Value(nil))
+	}
+}
+
+var linkParams = RuleParams{
+	Command:        "link -o $out $in",
+	Rspfile:        "$out.rsp",
+	RspfileContent: "$in",
+	RspfileCommand: "link -o $out @$out.rsp",
+}
+
+var linkRule = pctx.StaticRule("link", linkParams)
+
+func TestRspfileRules(t *testing.T) {
+	bp := map[string]string{
+		"Blueprints": `
+			test {
+				name: "short",
+				srcs: ["a.o"],
+				outs: ["short"],
+			}
+
+			test {
+				name: "long",
+				srcs: ["a.o", "b.o", "c.o", "d.o", "e.o", "f.o"],
+				outs: ["long"],
+			}
+		`,
+	}
+
+	testCases := []struct {
+		name   string
+		params testBuildParams
+		want   []string
+		err    string
+	}{
+		{
+			name: "package rule",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = linkRule
+			},
+			want: []string{
+				"rule g.blueprint.link\n    command = link -o ${out} ${in}\n",
+				"rule g.blueprint.link_rsp\n    command = link -o ${out} @${out}.rsp\n" +
+					"    rspfile = ${out}.rsp\n    rspfile_content = ${in}\n",
+				"build short: g.blueprint.link a.o\n",
+				"build long: g.blueprint.link_rsp a.o b.o c.o d.o e.o f.o\n",
+			},
+		},
+		{
+			name: "module rule",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = ctx.Rule(pctx, "link", linkParams)
+			},
+			want: []string{
+				"rule m.short_.link\n    command = link -o ${out} ${in}\n",
+				"rule m.long_.link_rsp\n    command = link -o ${out} @${out}.rsp\n",
+				"build short: m.short_.link a.o\n",
+				"build long: m.long_.link_rsp a.o b.o c.o d.o e.o f.o\n",
+			},
+		},
+		{
+			name: "no rspfile command",
+			err: `module "long": the command of rule github.com/google/blueprint.cp for output "long" ` +
+				`is 31 bytes long, which is more than the maximum of 20, and the rule doesn't set ` +
+				`RspfileCommand`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := newTestContext(t, bp)
+			ctx.SetMaxCommandLength(20)
+
+			errs := prepareTestContext(ctx, testCase.params)
+			if testCase.err != "" {
+				if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+			}
+
+			out := buildFile(t, ctx)
+			for _, want := range testCase.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+var regenRule = pctx.StaticRule("regen", RuleParams{
+	Command:   "regen -o $out $in",
+	Generator: true,
+})
+
+func TestSandboxLauncher(t *testing.T) {
+	ctx := newTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.c"],
+				outs: ["a.o"],
+			}
+
+			test {
+				name: "build.ninja",
+				srcs: ["Blueprints"],
+				outs: ["build.ninja"],
+			}
+		`,
+	})
+	ctx.SetSandboxLauncher("sbx")
+
+	errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		if ctx.ModuleName() == "build.ninja" {
+			params.Rule = regenRule
+		}
+	}))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	out := buildFile(t, ctx)
+	for _, want := range []string{
+		"rule g.blueprint.cp\n    command = sbx -setup ${sandbox_dir} ${sandbox_inputs} ${rspfile} && " +
+			"(cd ${sandbox_dir} && cp ${in} ${out}); " +
+			"sbx -finish ${sandbox_dir} $$? ${sandbox_outputs} ${depfile}\n",
+		"build a.o: g.blueprint.cp a.c\n" +
+			"    sandbox_dir = a.o.sandbox\n" +
+			"    sandbox_inputs = a.c\n" +
+			"    sandbox_outputs = a.o\n",
+		"rule g.blueprint.regen\n    command = regen -o ${out} ${in}\n",
+		"build build.ninja: g.blueprint.regen Blueprints\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "build.ninja.sandbox") {
+		t.Errorf("expected the generator rule not to be sandboxed:\n%s", out)
+	}
+}
+
+func TestSandboxLauncherRspfileRules(t *testing.T) {
+	ctx := newTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.o"],
+				outs: ["a"],
+			}
+		`,
+	})
+	// The unwrapped command "link -o a a.o" fits, but not
+	// once it is wrapped in the sandbox launcher.
+	ctx.SetMaxCommandLength(20)
+	ctx.SetSandboxLauncher("sbx")
+
+	errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		params.Rule = linkRule
+	}))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	out := buildFile(t, ctx)
+	if want := "build a: g.blueprint.link_rsp a.o\n"; !strings.Contains(out, want) {
+		t.Errorf("expected %q in:\n%s", want, out)
+	}
+}
+
+var checkedPctx = NewPackageContext("github.com/google/blueprint/checked")
+
+var (
+	// The cc argument of checkedArgs defaults to this
+	// variable, so leaving it unset is not reported.
+	_ = checkedPctx.StaticVariable("cc", "clang")
+
+	checkedUnusedArg = checkedPctx.StaticRule("unused_arg", RuleParams{
+		Command: "cp $in $out",
+	}, "flags")
+
+	checkedNoIn = checkedPctx.StaticRule("no_in", RuleParams{
+		Command: "touch $out",
+	})
+
+	checkedDepfile = checkedPctx.StaticRule("depfile", RuleParams{
+		Command: "cc -MD -MF deps.d -c $in -o $out",
+		Depfile: "deps.d",
+	})
+
+	checkedArgs = checkedPctx.StaticRule("args", RuleParams{
+		Command: "${cc} $flags -c $in -o $out",
+	}, "cc", "flags")
+
+	checkedOK = checkedPctx.StaticRule("ok", RuleParams{
+		Command: "cc -MD -MF $out.d -c $in -o $out",
+		Depfile: "$out.d",
+		Deps:    DepsGCC,
+	})
+)
+
+// Importing the checked package makes its rules visible
+// to the build statements of testModule.
+var _ = func() bool {
+	checkedPctx.EnableRuleChecks()
+	pctx.Import("github.com/google/blueprint/checked")
+	return true
+}()
+
+func TestRuleChecks(t *testing.T) {
+	bp := map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.c"],
+				outs: ["a.o", "a.h"],
+			}
+		`,
+	}
+
+	testCases := []struct {
+		name     string
+		params   testBuildParams
+		warnings []string
+	}{
+		{
+			name: "unused argument",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = checkedUnusedArg
+				params.Outputs = params.Outputs[:1]
+			},
+			warnings: []string{
+				`rule github.com/google/blueprint/checked.unused_arg: argument "flags" is never used`,
+			},
+		},
+		{
+			name: "no $in",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = checkedNoIn
+				params.Outputs = params.Outputs[:1]
+			},
+			warnings: []string{
+				"rule github.com/google/blueprint/checked.no_in: command does not reference $in",
+			},
+		},
+		{
+			name: "depfile",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = checkedDepfile
+				params.Outputs = params.Outputs[:1]
+			},
+			warnings: []string{
+				"rule github.com/google/blueprint/checked.depfile: Depfile is set without Deps",
+				"rule github.com/google/blueprint/checked.depfile: Depfile does not reference $out",
+			},
+		},
+		{
+			name: "build statement",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = checkedArgs
+			},
+			warnings: []string{
+				`Blueprints:2:4: module "a": build statement using rule github.com/google/blueprint/checked.args: ` +
+					`command references $out, which expands to all 2 outputs`,
+				`Blueprints:2:4: module "a": build statement using rule github.com/google/blueprint/checked.args: ` +
+					`argument "flags" is referenced by the command but not set`,
+			},
+		},
+		{
+			name: "module rule",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = ctx.Rule(checkedPctx, "no_in", RuleParams{
+					Command: "touch $out",
+				})
+				params.Outputs = params.Outputs[:1]
+			},
+			warnings: []string{
+				`Blueprints:2:4: module "a": rule <local rule>:m.a_.no_in: command does not reference $in`,
+			},
+		},
+		{
+			name: "no warnings",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = checkedOK
+				params.Outputs = params.Outputs[:1]
+			},
+		},
+		{
+			name: "checks not enabled",
+			params: func(ctx ModuleContext, params *BuildParams) {
+				params.Rule = ctx.Rule(pctx, "no_in", RuleParams{
+					Command: "touch $out",
+				})
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := runTestContext(t, bp, testCase.params)
+
+			var warnings []string
+			for _, warning := range ctx.Warnings() {
+				warnings = append(warnings, warning.Error())
+			}
+
+			if !reflect.DeepEqual(warnings, testCase.warnings) {
+				t.Errorf("incorrect warnings:\n  expected: %q\n       got: %q",
+					testCase.warnings, warnings)
+			}
+		})
+	}
+}
+
+var (
+	hashRule = pctx.StaticRule("hash", RuleParams{
+		Command:     "gen $in $out",
+		HashOutputs: true,
+	})
+
+	checkedHash = checkedPctx.StaticRule("hash", RuleParams{
+		Command:     "gen -o $outDir $in",
+		HashOutputs: true,
+	}, "outDir")
+)
+
+func TestHashOutputs(t *testing.T) {
+	bp := map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.in"],
+				outs: ["a.out", "b.out"],
+			}
+		`,
+	}
+
+	t.Run("rule", func(t *testing.T) {
+		ctx := newTestContext(t, bp)
+		ctx.SetSandboxLauncher("sbx")
+
+		errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+			params.Rule = hashRule
+		}))
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+		}
+
+		out := buildFile(t, ctx)
+		want := "rule g.blueprint.hash\n" +
+			"    command = (gen ${in} ${out}) && for f in $out; do " +
+			"h=$$( (sha1sum 2>/dev/null || shasum) < $$f) || exit 1; " +
+			"if [ -f $$f.hash ] && [ \"$$h\" = \"$$(cat $$f.hash)\" ]; then touch -r $$f.hash $$f; " +
+			"else echo \"$$h\" > $$f.hash && touch -r $$f $$f.hash; fi; done\n" +
+			"    restat = true\n"
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+		if strings.Contains(out, "sandbox") {
+			t.Errorf("expected the rule not to be sandboxed:\n%s", out)
+		}
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		// The wrapper iterates over $out, which must not be
+		// reported as the rule's command referencing all of
+		// the outputs.
+		ctx := runTestContext(t, bp, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+			params.Rule = checkedHash
+			params.Args = map[string]string{"outDir": "."}
+		}))
+		if warnings := ctx.Warnings(); len(warnings) > 0 {
+			t.Errorf("unexpected warnings: %q", warnings)
+		}
+	})
+
+	t.Run("command length", func(t *testing.T) {
+		// The unwrapped command fits, but not once it is
+		// wrapped.
+		ctx := newTestContext(t, bp)
+		ctx.SetMaxCommandLength(30)
+
+		errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+			params.Rule = hashRule
+		}))
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "doesn't set RspfileCommand") {
+			t.Errorf("expected an over-long command error, got %q", errs)
+		}
+	})
+}
+
+var remoteRule = pctx.StaticRule("remote", RuleParams{
+	Command:     "gen -o $out $in",
+	CommandDeps: []string{"gen"},
+	Remote: RemoteParams{
+		Platform: map[string]string{"OSFamily": "linux", "container-image": "img"},
+		Env:      map[string]string{"LANG": "C"},
+	},
+})
+
+func TestRemoteWrapper(t *testing.T) {
+	ctx := newTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.in"],
+				outs: ["a.out"],
+			}
+
+			test {
+				name: "b",
+				srcs: ["b.in"],
+				outs: ["b.out"],
+			}
+
+			test {
+				name: "c",
+				srcs: ["c.o"],
+				outs: ["c"],
+			}
+		`,
+	})
+	ctx.SetSandboxLauncher("sbx")
+	ctx.SetRemoteWrapper("rw --verbose")
+
+	errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		switch ctx.ModuleName() {
+		case "a":
+			params.Rule = remoteRule
+			params.Remote = RemoteParams{
+				Platform:   map[string]string{"container-image": "other"},
+				Env:        map[string]string{"FOO": "a b"},
+				OutputDirs: []string{"out"},
+				NoCache:    true,
+			}
+		case "b":
+			params.Rule = hashRule
+		case "c":
+			params.Rule = ctx.Rule(pctx, "link", RuleParams{
+				Command:        "link -o $out @$out.rsp",
+				Rspfile:        "$out.rsp",
+				RspfileContent: "$in",
+			})
+		}
+	}))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	out := buildFile(t, ctx)
+	for _, want := range []string{
+		"rule g.blueprint.remote\n" +
+			"    command = rw$ --verbose ${remote_flags} -- /bin/sh ${remote_script}\n" +
+			"    rspfile = ${remote_script}\n" +
+			"    rspfile_content = gen -o ${out} ${in}\n",
+		"build a.out: g.blueprint.remote a.in | gen\n" +
+			"    remote_script = a.out.remote.sh\n" +
+			"    remote_flags = -inputs=a.in,gen -outputs=a.out -output_dirs=out " +
+			"-platform='OSFamily=linux,container-image=other' -env='FOO=a b' -env='LANG=C' -no_cache\n",
+		// HashOutputs and response file rules are not run
+		// remotely; the latter is still sandboxed.
+		"rule g.blueprint.hash\n    command = (gen ${in} ${out}) && ",
+		"rule m.c_.link\n    command = sbx -setup ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRemoteWrapperRspfileRules(t *testing.T) {
+	ctx := newTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.o"],
+				outs: ["a"],
+			}
+		`,
+	})
+	// The unwrapped command "link -o a a.o" fits, but not
+	// the remote wrapper command with its flags, so the
+	// response file variant of the rule is run locally.
+	ctx.SetMaxCommandLength(40)
+	ctx.SetRemoteWrapper("rw")
+
+	errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		params.Rule = linkRule
+	}))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	out := buildFile(t, ctx)
+	if want := "build a: g.blueprint.link_rsp a.o\n"; !strings.Contains(out, want) {
+		t.Errorf("expected %q in:\n%s", want, out)
+	}
+	if strings.Contains(out, "remote_flags =") {
+		t.Errorf("expected the response file rule not to be run remotely:\n%s", out)
+	}
+}
+
+// variantOutputs puts the outputs of each variant of a
+// testModule in a directory named after the variant.
+func variantOutputs(ctx ModuleContext, params *BuildParams) {
+	if dir := ctx.ModuleSubDir(); dir != "" {
+		var outputs []string
+		for _, output := range params.Outputs {
+			outputs = append(outputs, dir+"/"+output)
+		}
+		params.Outputs = outputs
+	}
+}
+
+// newVariantsTestContext returns a test Context that
+// creates variants x and y of the modules whose name
+// starts with "v".
+func newVariantsTestContext(t *testing.T, files map[string]string) *Context {
+	ctx := newTestContext(t, files)
+	ctx.RegisterBottomUpMutator("variants", func(ctx BottomUpMutatorContext) {
+		if strings.HasPrefix(ctx.ModuleName(), "v") {
+			ctx.CreateVariations("x", "y")
+		}
+	})
+	return ctx
+}
+
+func TestModuleAliases(t *testing.T) {
+	ctx := newVariantsTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.c"],
+				outs: ["a.o", "a.d"],
+			}
+
+			test {
+				name: "b",
+				srcs: ["b.c"],
+				outs: ["b.o", "b.d"],
+			}
+
+			test {
+				name: "v",
+				srcs: ["v.c"],
+				outs: ["v.o"],
+			}
+
+			test {
+				name: "c",
+				srcs: ["c.c"],
+				outs: ["c"],
+			}
+
+			test {
+				name: "empty",
+			}
+		`,
+	})
+	ctx.SetModuleAliases(true)
+
+	errs := prepareTestContext(ctx, testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		variantOutputs(ctx, params)
+		if ctx.ModuleName() == "a" {
+			ctx.SetPrimaryOutputs(pctx, "a.o")
+		}
+	}))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	out := buildFile(t, ctx)
+	want := "# Phony aliases for each module and module variant.\n" +
+		"build a: phony a.o\n" +
+		"build b: phony b.o b.d\n" +
+		"build v-x: phony x/v.o\n" +
+		"build v-y: phony y/v.o\n" +
+		"build v: phony v-x v-y\n" +
+		"\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected %q in:\n%s", want, out)
+	}
+	// The alias of c would have the same name as its output.
+	if strings.Contains(out, "build c: phony") {
+		t.Errorf("expected no alias for c:\n%s", out)
+	}
+}
+
+func TestModuleAliasConflicts(t *testing.T) {
+	ctx := newVariantsTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "v",
+				srcs: ["v.c"],
+				outs: ["v.o"],
+			}
+
+			test {
+				name: "v-x",
+				srcs: ["w.c"],
+				outs: ["w.o"],
+			}
+		`,
+	})
+	ctx.SetModuleAliases(true)
+
+	errs := prepareTestContext(ctx, testBuildParams(variantOutputs))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `module alias "v-x" is also the alias of`) {
+		t.Errorf("expected a module alias conflict error, got %q", errs)
+	}
+}
+
+func TestDefaultTags(t *testing.T) {
+	bp := map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs: ["a.c"],
+				outs: ["a.o"],
+			}
+
+			test {
+				name: "b",
+				srcs: ["b.c"],
+				outs: ["b.o"],
+			}
+
+			test {
+				name: "c",
+				srcs: ["c.c"],
+				outs: ["c.o"],
+			}
+		`,
+	}
+
+	params := testBuildParams(func(ctx ModuleContext, params *BuildParams) {
+		switch ctx.ModuleName() {
+		case "a":
+			ctx.AddTags("host", "device")
+		case "b":
+			ctx.AddTags("device")
+			params.Optional = true
+		}
+	})
+
+	newContext := func(tags []string) *Context {
+		ctx := newTestContext(t, bp)
+		ctx.SetDefaultTags(tags)
+		ctx.RegisterSingletonType("singleton", newTestSingleton(func(ctx SingletonContext) {
+			ctx.Build(pctx, BuildParams{
+				Rule:    copyRule,
+				Outputs: []string{"s.out"},
+				Inputs:  []string{"a.o"},
+			})
+		}))
+		if errs := prepareTestContext(ctx, params); len(errs) > 0 {
+			t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+		}
+		return ctx
+	}
+
+	out := buildFile(t, newContext([]string{"device", "other"}))
+	if !strings.HasSuffix(out, "default a.o\n\n") {
+		t.Errorf("expected only a.o to be built by default:\n%s", out)
+	}
+	if n := strings.Count(out, "default "); n != 1 {
+		t.Errorf("expected 1 default statement, got %d:\n%s", n, out)
+	}
+
+	out = buildFile(t, newContext(nil))
+	for _, want := range []string{"default a.o\n", "default c.o\n", "default s.out\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q without default tags:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "default b.o") {
+		t.Errorf("expected the optional b.o not to be built by default:\n%s", out)
+	}
+}
+
+func TestReplacesProperty(t *testing.T) {
+	ctx := newVariantsTestContext(t, map[string]string{
+		"Blueprints": `
+			test {
+				name: "a",
+				srcs := ["a.c"],
+				outs: ["a.o"],
+			}
+
+			test {
+				name: "v",
+				srcs: ["v.c"],
+				outs := ["v.o"],
+			}
+		`,
+	})
+
+	type replaceResult struct {
+		replaced   []string
+		properties []string
+	}
+	results := make(map[string][]replaceResult)
+	ctx.RegisterBottomUpMutator("replace", func(ctx BottomUpMutatorContext) {
+		var replaced []string
+		for _, name := range []string{"name", "srcs", "outs", "srcs.arm"} {
+			if ctx.ReplacesProperty(name) {
+				replaced = append(replaced, name)
+			}
+		}
+
+		// Append the module's properties onto defaults.
+		properties := ctx.Module().(*testModule).properties
+		defaults := properties
+		defaults.Srcs = []string{"default.c"}
+		defaults.Outs = []string{"default.o"}
+		err := proptools.ExtendProperties(&defaults, &properties, nil,
+			proptools.OrderReplacing(ctx.ReplacesProperty, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results[ctx.ModuleName()] = append(results[ctx.ModuleName()], replaceResult{
+			replaced:   replaced,
+			properties: append(defaults.Srcs, defaults.Outs...),
+		})
+	})
+	if _, errs := ctx.ResolveDependencies(nil); len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	// Both variants of v keep the properties it set with ":=".
+	vResult := replaceResult{
+		replaced:   []string{"outs"},
+		properties: []string{"default.c", "v.c", "v.o"},
+	}
+	expected := map[string][]replaceResult{
+		"a": {{
+			replaced:   []string{"srcs", "srcs.arm"},
+			properties: []string{"a.c", "default.o", "a.o"},
+		}},
+		"v": {vResult, vResult},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("incorrect replaced properties:\n  expected: %#v\n       got: %#v", expected,
+			results)
+	}
+}
+
+// archModule is a module type with a
+// `arch: { arm: {...}, x86: {...} }` block for
+// TestSquashVariantProperties.
+type archModule struct {
+	SimpleName
+	properties struct {
+		Srcs   []string `blueprint:"variant"`
+		Cflags []string `blueprint:"variant_prepend"`
+	}
+	archProperties struct {
+		Arch interface{}
+	}
+}
+
+func newArchModule() (Module, []interface{}) {
+	m := &archModule{}
+	typ, err := proptools.VariantPropertiesType(reflect.TypeOf(m.properties),
+		[]string{"arm", "x86"})
+	if err != nil {
+		panic(err)
+	}
+	m.archProperties.Arch = reflect.New(typ).Interface()
+	return m, []interface{}{&m.SimpleName.Properties, &m.properties, &m.archProperties}
+}
+
+func (m *archModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func TestSquashVariantProperties(t *testing.T) {
+	bp := []byte(`
+		arch_module {
+			name: "a",
+			srcs: ["a.c"],
+			cflags: ["-a"],
+			arch: {
+				arm: {
+					srcs: ["arm.c"],
+					cflags: ["-arm"],
+				},
+				x86: {
+					srcs: ["x86.c"],
+				},
+			},
+		}
+
+		arch_module {
+			name: "b",
+		}
+	`)
+
+	// squash runs a mutator that squashes the properties
+	// of variant into each module in bp, and returns the
+	// resulting srcs and cflags of the modules.
+	squash := func(bp []byte, variant string) (map[string][]string, []error) {
+		ctx := NewContext()
+		ctx.RegisterModuleType("arch_module", newArchModule)
+		ctx.MockFileSystem(map[string][]byte{"Blueprints": bp})
+		if _, errs := ctx.ParseBlueprintsFiles("Blueprints"); len(errs) > 0 {
+			t.Fatalf("unexpected parse errors:\n%s", joinErrors(errs))
+		}
+
+		results := make(map[string][]string)
+		ctx.RegisterBottomUpMutator("arch", func(ctx BottomUpMutatorContext) {
+			ctx.SquashVariantProperties("arch", variant)
+			m := ctx.Module().(*archModule)
+			results[ctx.ModuleName()] = append(m.properties.Srcs, m.properties.Cflags...)
+		})
+
+		_, errs := ctx.ResolveDependencies(nil)
+		return results, errs
+	}
+
+	results, errs := squash(bp, "arm")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+	expected := map[string][]string{
+		"a": {"a.c", "arm.c", "-arm", "-a"},
+		"b": nil,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("incorrect properties:\n  expected: %q\n       got: %q", expected, results)
+	}
+
+	// The mutator stops at the first module with errors, so only
+	// use one module.
+	_, errs = squash([]byte(`
+		arch_module {
+			name: "a",
+			arch: {
+				arm: {
+					srcs: ["arm.c"],
+				},
+			},
+		}
+	`), "mips")
+	expectedErrs := []string{
+		`Blueprints:4:8: module "a": arch: property "arch.mips" not found`,
+	}
+	var gotErrs []string
+	for _, err := range errs {
+		gotErrs = append(gotErrs, err.Error())
+	}
+	if !reflect.DeepEqual(gotErrs, expectedErrs) {
+		t.Errorf("incorrect errors:\n  expected: %q\n       got: %q", expectedErrs, gotErrs)
+	}
+}
+
+// deprecatedModule is a module type with deprecated
+// properties for TestDeprecatedProperties.
+type deprecatedModule struct {
+	SimpleName
+	properties struct {
+		Srcs     []string
+		Old_srcs []string `blueprint:"deprecated,renamed_to=srcs"`
+		Unused   *bool    `blueprint:"deprecated"`
+	}
+}
+
+func newDeprecatedModule() (Module, []interface{}) {
+	m := &deprecatedModule{}
+	return m, []interface{}{&m.SimpleName.Properties, &m.properties}
+}
+
+func (m *deprecatedModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func TestDeprecatedProperties(t *testing.T) {
+	bp := []byte(`
+		deprecated_module {
+			name: "a",
+			old_srcs: ["a.c"],
+		}
+
+		deprecated_module {
+			name: "b",
+			unused: true,
+		}
+	`)
+
+	newContext := func(strict bool, create func(TopDownMutatorContext)) (*Context, []error) {
+		ctx := NewContext()
+		ctx.SetStrictDeprecatedProperties(strict)
+		ctx.RegisterModuleType("deprecated_module", newDeprecatedModule)
+		ctx.MockFileSystem(map[string][]byte{"Blueprints": bp})
+		if create != nil {
+			ctx.RegisterTopDownMutator("create", create)
+		}
+		if _, errs := ctx.ParseBlueprintsFiles("Blueprints"); len(errs) > 0 {
+			return ctx, errs
+		}
+		_, errs := ctx.ResolveDependencies(nil)
+		return ctx, errs
+	}
+
+	errorStrings := func(errs []error) []string {
+		var s []string
+		for _, err := range errs {
+			s = append(s, err.Error())
+		}
+		sort.Strings(s)
+		return s
+	}
+
+	ctx, errs := newContext(false, func(ctx TopDownMutatorContext) {
+		if ctx.ModuleName() == "a" {
+			ctx.CreateModule(newDeprecatedModule, &struct {
+				Name     string
+				Old_srcs []string
+			}{"c", []string{"c.c"}})
+		}
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	expected := []string{
+		`Blueprints:2:3: module "c": old_srcs: deprecated property, use "srcs" instead`,
+		`Blueprints:4:12: module "a": old_srcs: deprecated property, use "srcs" instead`,
+		`Blueprints:9:10: module "b": unused: deprecated property`,
+	}
+	if got := errorStrings(ctx.Warnings()); !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect warnings:\n  expected: %q\n       got: %q", expected, got)
+	}
+
+	var srcs []string
+	ctx.VisitAllModules(func(module Module) {
+		srcs = append(srcs, module.(*deprecatedModule).properties.Srcs...)
+	})
+	sort.Strings(srcs)
+	if !reflect.DeepEqual(srcs, []string{"a.c", "c.c"}) {
+		t.Errorf("expected renamed properties to be set, got %q", srcs)
+	}
+
+	_, errs = newContext(true, nil)
+	expected = []string{
+		`Blueprints:4:12: module "a": old_srcs: deprecated property, use "srcs" instead`,
+		`Blueprints:9:10: module "b": unused: deprecated property`,
+	}
+	if got := errorStrings(errs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect strict errors:\n  expected: %q\n       got: %q", expected, got)
+	}
+
+	_, errs = newContext(false, func(ctx TopDownMutatorContext) {
+		if ctx.ModuleName() == "a" {
+			ctx.CreateModule(newDeprecatedModule, &struct {
+				Name     string
+				Srcs     []string
+				Old_srcs []string
+			}{"c", []string{"a.c"}, []string{"b.c"}})
+		}
+	})
+	expected = []string{
+		`Blueprints:2:3: module "c": old_srcs: can't be set together with "srcs", which replaces it`,
+	}
+	if got := errorStrings(errs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect errors:\n  expected: %q\n       got: %q", expected, got)
+	}
+}
@@ -9,6 +9,10 @@ type liveTracker struct {
 	variables map[Variable]*ninjaString
 	pools     map[Pool]*poolDef
 	rules     map[Rule]*ruleDef
+
+	// The minimum Ninja version required by the live rules and build
+	// statements.
+	ninjaVersion ninjaVersion
 }
 
 func newLiveTracker(config interface{}) *liveTracker {
@@ -30,6 +34,8 @@ func (l *liveTracker) AddBuildDefDeps(def *buildDef) error {
 	}
 	def.RuleDef = ruleDef
 
+	l.requireNinjaVersion(def.RequiredNinjaVersion)
+
 	err = l.addNinjaStringListDeps(def.Outputs)
 	if err != nil {
 		return err
@@ -50,6 +56,11 @@ func (l *liveTracker) AddBuildDefDeps(def *buildDef) error {
 		return err
 	}
 
+	err = l.addNinjaStringListDeps(def.Validations)
+	if err != nil {
+		return err
+	}
+
 	for _, value := range def.Variables {
 		err = l.addNinjaStringDeps(value)
 		if err != nil {
@@ -67,6 +78,25 @@ func (l *liveTracker) AddBuildDefDeps(def *buildDef) error {
 	return nil
 }
 
+func (l *liveTracker) AddValidationDefDeps(def *validationDef) error {
+	l.Lock()
+	defer l.Unlock()
+
+	err := l.addNinjaStringDeps(def.Output)
+	if err != nil {
+		return err
+	}
+
+	return l.addNinjaStringListDeps(def.Validations)
+}
+
+func (l *liveTracker) AddNinjaStringListDeps(list []*ninjaString) error {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.addNinjaStringListDeps(list)
+}
+
 func (l *liveTracker) addRule(r Rule) (def *ruleDef, err error) {
 	def, ok := l.rules[r]
 	if !ok {
@@ -103,6 +133,17 @@ func (l *liveTracker) addRule(r Rule) (def *ruleDef, err error) {
 			}
 		}
 
+		if def.RspfileDef != nil {
+			for _, value := range def.RspfileDef.Variables {
+				err = l.addNinjaStringDeps(value)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		l.requireNinjaVersion(def.RequiredNinjaVersion)
+
 		l.rules[r] = def
 	}
 
@@ -152,6 +193,12 @@ func (l *liveTracker) addVariable(v Variable) error {
 	return nil
 }
 
+func (l *liveTracker) requireNinjaVersion(v ninjaVersion) {
+	if v.newerThan(l.ninjaVersion) {
+		l.ninjaVersion = v
+	}
+}
+
 func (l *liveTracker) addNinjaStringListDeps(list []*ninjaString) error {
 	for _, str := range list {
 		err := l.addNinjaStringDeps(str)
@@ -3,6 +3,8 @@ package blueprint
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"text/scanner"
 
 	"github.com/google/blueprint/pathtools"
@@ -136,6 +138,16 @@ type BaseModuleContext interface {
 	Config() interface{}
 
 	ContainsProperty(name string) bool
+
+	// ReplacesProperty returns true if the property with
+	// the given name, or one of the maps containing it,
+	// was set with ":=" instead of ":" in the Blueprints
+	// file. Pass it to proptools.OrderReplacing when
+	// appending the module's properties onto others,
+	// such as those of its defaults, so that they
+	// replace the values they are appended to.
+	ReplacesProperty(name string) bool
+
 	Errorf(pos scanner.Position, fmt string, args ...interface{})
 	ModuleErrorf(fmt string, args ...interface{})
 	PropertyErrorf(property, fmt string, args ...interface{})
@@ -185,6 +197,24 @@ type ModuleContext interface {
 	Rule(pctx PackageContext, name string, params RuleParams, argNames ...string) Rule
 	Build(pctx PackageContext, params BuildParams)
 
+	// AddValidations attaches validation targets to
+	// the build statement that produces output. The
+	// validations are built whenever output is built,
+	// but they do not block dependents of output.
+	AddValidations(pctx PackageContext, output string, validations ...string)
+
+	// SetPrimaryOutputs sets the outputs that the phony
+	// alias for the module variant depends on, see
+	// Context.SetModuleAliases. By default the alias
+	// depends on all of the explicit outputs of the
+	// module variant's build statements.
+	SetPrimaryOutputs(pctx PackageContext, outputs ...string)
+
+	// AddTags adds tags to the module variant that
+	// select whether its build statements are built by
+	// default, see Context.SetDefaultTags.
+	AddTags(tags ...string)
+
 	PrimaryModule() Module
 	FinalModule() Module
 	VisitAllModuleVariants(visit func(Module))
@@ -217,6 +247,19 @@ func (d *baseModuleContext) ContainsProperty(name string) bool {
 	return ok
 }
 
+func (d *baseModuleContext) ReplacesProperty(name string) bool {
+	for {
+		if d.module.replaceProperties[name] {
+			return true
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
 func (d *baseModuleContext) ModuleDir() string {
 	return filepath.Dir(d.module.relBlueprintsFile)
 }
@@ -296,6 +339,7 @@ type moduleContext struct {
 	baseModuleContext
 	scope              *localScope
 	actionDefs         localBuildActions
+	tags               []string
 	handledMissingDeps bool
 }
 
@@ -481,6 +525,7 @@ func (m *moduleContext) Rule(pctx PackageContext, name string,
 	if err != nil {
 		panic(err)
 	}
+	r.checked = pctx.ruleChecksEnabled()
 
 	m.actionDefs.rules = append(m.actionDefs.rules, r)
 
@@ -498,6 +543,34 @@ func (m *moduleContext) Build(pctx PackageContext, params BuildParams) {
 	m.actionDefs.buildDefs = append(m.actionDefs.buildDefs, def)
 }
 
+func (m *moduleContext) AddValidations(pctx PackageContext, output string,
+	validations ...string) {
+
+	m.scope.ReparentTo(pctx)
+
+	def, err := parseValidationParams(m.scope, output, validations)
+	if err != nil {
+		panic(err)
+	}
+
+	m.actionDefs.validations = append(m.actionDefs.validations, def)
+}
+
+func (m *moduleContext) SetPrimaryOutputs(pctx PackageContext, outputs ...string) {
+	m.scope.ReparentTo(pctx)
+
+	values, err := parseNinjaStrings(m.scope, outputs)
+	if err != nil {
+		panic(fmt.Errorf("error parsing outputs param: %s", err))
+	}
+
+	m.actionDefs.primaryOutputs = values
+}
+
+func (m *moduleContext) AddTags(tags ...string) {
+	m.tags = append(m.tags, tags...)
+}
+
 func (m *moduleContext) PrimaryModule() Module {
 	return m.module.group.modules[0].logicModule
 }
@@ -535,6 +608,17 @@ type baseMutatorContext interface {
 	OtherModuleExists(name string) bool
 	Rename(name string)
 	Module() Module
+
+	// SquashVariantProperties applies the properties set
+	// for variant in the variant property struct that is
+	// the value of the given property, which was created
+	// from a type returned by
+	// proptools.VariantPropertiesType, to the other
+	// property structs of the module. For example, a
+	// mutator that creates an "arm" variant can call
+	// SquashVariantProperties("arch", "arm") to apply
+	// the properties in the `arch: { arm: {...} }` block.
+	SquashVariantProperties(property, variant string)
 }
 
 type EarlyMutatorContext interface {
@@ -685,6 +769,29 @@ func (mctx *mutatorContext) Module() Module {
 	return mctx.module.logicModule
 }
 
+func (mctx *mutatorContext) SquashVariantProperties(property, variant string) {
+	variantProperties, err := proptools.GetProperty(mctx.module.properties, property+"."+variant)
+	if err != nil {
+		mctx.PropertyErrorf(property, "%s", err)
+		return
+	}
+
+	// GetProperty returns a copy of the struct, which needs to be
+	// addressable to be extended from.
+	src := reflect.New(reflect.TypeOf(variantProperties))
+	src.Elem().Set(reflect.ValueOf(variantProperties))
+
+	err = proptools.SquashVariantProperties(mctx.module.properties, src.Interface())
+	if err != nil {
+		if propertyErr, ok := err.(*proptools.ExtendPropertyError); ok {
+			mctx.PropertyErrorf(property+"."+variant+"."+propertyErr.Property,
+				"%s", propertyErr.Err)
+		} else {
+			mctx.ModuleErrorf("%s", err)
+		}
+	}
+}
+
 // AddDependency adds a dependency to the given module.
 // Does not affect the ordering of the current mutator
 // pass, but will be ordered correctly for all future
@@ -813,6 +920,21 @@ func (mctx *mutatorContext) CreateModule(factory ModuleFactory, props ...interfa
 		}
 	}
 
+	deprecated, errs := setDeprecatedProperties(module.properties, module.pos)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			propertyErr := err.(*PropertyError)
+			propertyErr.module = module
+			mctx.error(propertyErr)
+		}
+		return
+	}
+
+	module.deprecatedProperties = deprecated
+	for i := range module.deprecatedProperties {
+		module.deprecatedProperties[i].Module = module.logicModule.Name()
+	}
+
 	mctx.newModules = append(mctx.newModules, module)
 }
 
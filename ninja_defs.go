@@ -31,6 +31,31 @@ func (d Deps) String() string {
 	}
 }
 
+// ninjaVersion identifies a Ninja release. It is used
+// to record the minimum version of Ninja that supports
+// the features used by a rule or build statement.
+type ninjaVersion struct {
+	major, minor, micro int
+}
+
+func (v ninjaVersion) newerThan(other ninjaVersion) bool {
+	if v.major != other.major {
+		return v.major > other.major
+	}
+	if v.minor != other.minor {
+		return v.minor > other.minor
+	}
+	return v.micro > other.micro
+}
+
+// ninjaDyndepVersion is the first version of Ninja that
+// supports dynamic dependency information.
+var ninjaDyndepVersion = ninjaVersion{1, 10, 0}
+
+// ninjaValidationsVersion is the first version of Ninja
+// that supports validation inputs.
+var ninjaValidationsVersion = ninjaVersion{1, 11, 0}
+
 // PoolParams contains the set of parameters that
 // make up a Ninja pool definition.
 type PoolParams struct {
@@ -46,6 +71,7 @@ type RuleParams struct {
 	Depfile        string // The dependency file name.
 	Deps           Deps   // The format of the dependency file.
 	Description    string // The description that Ninja will print for the rule.
+	Dyndep         string // The dynamic dependency file, requires Ninja 1.10.
 	Generator      bool   // Whether the rule generates the Ninja manifest file.
 	Pool           Pool   // The Ninja pool to which the rule belongs.
 	Restat         bool   // Whether Ninja should re-stat the rule's outputs.
@@ -56,8 +82,26 @@ type RuleParams struct {
 	CommandDeps      []string // Command-specific implicit dependencies to prepend to builds
 	CommandOrderOnly []string // Command-specific order-only dependencies to prepend to builds
 	Comment          string   // The comment that will appear above the definition.
+	Compiler         bool     // Whether the rule compiles its inputs, for compile_commands.json
+	RspfileCommand   string   // The command to use with Rspfile when the expanded Command is too long
+	HashOutputs      bool     // Whether to keep unchanged outputs from rebuilding dependents, see HashStampSuffix
+	Remote           RemoteParams
 }
 
+// HashStampSuffix is appended to the explicit outputs of
+// build statements using a rule with
+// RuleParams.HashOutputs set to get the names of their
+// stamp files. The command of such a rule is wrapped so
+// that after it runs the content hash of each output is
+// compared with the hash stored in its stamp file. If
+// the hash is unchanged, the output's modification time
+// is reset to that of the stamp file, and because the
+// rule is also marked restat Ninja doesn't rebuild the
+// targets that depend on it. Otherwise the new hash is
+// written to the stamp file. Rules with HashOutputs set
+// are never sandboxed.
+const HashStampSuffix = ".hash"
+
 // BuildParams contains the set of parameters that
 // make up a Ninja build statement. Each field
 // except for Args corresponds with a part of the
@@ -69,14 +113,128 @@ type BuildParams struct {
 	Depfile         string            // The dependency file name.
 	Deps            Deps              // The format of the dependency file.
 	Description     string            // The description that Ninja will print for the build.
+	Dyndep          string            // The dynamic dependency file, requires Ninja 1.10.
 	Rule            Rule              // The rule to invoke.
 	Outputs         []string          // The list of explicit output targets.
 	ImplicitOutputs []string          // The list of implicit output targets.
 	Inputs          []string          // The list of explicit input dependencies.
 	Implicits       []string          // The list of implicit input dependencies.
 	OrderOnly       []string          // The list of order-only dependencies.
+	Validations     []string          // The list of validation targets, requires Ninja 1.11.
 	Args            map[string]string // The variable/value pairs to set.
 	Optional        bool              // Skip outputting a default statement
+	Remote          RemoteParams      // Combined with the rule's RuleParams.Remote.
+}
+
+// RemoteParams describes how the commands of a rule or
+// build statement are run by the remote wrapper set with
+// Context.SetRemoteWrapper. The parameters of a build
+// statement are combined with those of its rule, with
+// the build statement's platform properties,
+// environment variables and input root taking
+// precedence.
+type RemoteParams struct {
+	Platform   map[string]string // The properties a remote worker must have, such as its OS or container image.
+	NoCache    bool              // Whether the results of the command must not be cached.
+	Local      bool              // Whether the command must run on the local machine.
+	InputRoot  string            // The directory that input and output paths are relative to.
+	OutputDirs []string          // The directories that the command writes undeclared outputs to.
+	Env        map[string]string // The environment variables that the command needs.
+}
+
+// merge returns the combination of the remote
+// parameters of a rule, p, with those of a build
+// statement that uses it.
+func (p RemoteParams) merge(build RemoteParams) RemoteParams {
+	merged := RemoteParams{
+		NoCache:    p.NoCache || build.NoCache,
+		Local:      p.Local || build.Local,
+		InputRoot:  p.InputRoot,
+		OutputDirs: append(append([]string(nil), p.OutputDirs...), build.OutputDirs...),
+		Platform:   make(map[string]string),
+		Env:        make(map[string]string),
+	}
+
+	if build.InputRoot != "" {
+		merged.InputRoot = build.InputRoot
+	}
+
+	for _, m := range []map[string]string{p.Platform, build.Platform} {
+		for k, v := range m {
+			merged.Platform[k] = v
+		}
+	}
+
+	for _, m := range []map[string]string{p.Env, build.Env} {
+		for k, v := range m {
+			merged.Env[k] = v
+		}
+	}
+
+	return merged
+}
+
+// flags returns the command line flags that pass the
+// remote parameters of a build statement with the given
+// Ninja-escaped inputs and outputs to the remote
+// wrapper.
+func (p RemoteParams) flags(inputs, outputs []string) string {
+	escape := func(s string) string {
+		return strings.Replace(shellEscape(s), "$", "$$", -1)
+	}
+
+	sortedKeys := func(m map[string]string) []string {
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	flags := []string{
+		"-inputs=" + strings.Join(inputs, ","),
+		"-outputs=" + strings.Join(outputs, ","),
+	}
+
+	if p.InputRoot != "" {
+		flags = append(flags, "-input_root="+escape(p.InputRoot))
+	}
+
+	if len(p.OutputDirs) > 0 {
+		flags = append(flags, "-output_dirs="+escape(strings.Join(p.OutputDirs, ",")))
+	}
+
+	if len(p.Platform) > 0 {
+		var platform []string
+		for _, k := range sortedKeys(p.Platform) {
+			platform = append(platform, k+"="+p.Platform[k])
+		}
+		flags = append(flags, "-platform="+escape(strings.Join(platform, ",")))
+	}
+
+	for _, k := range sortedKeys(p.Env) {
+		flags = append(flags, "-env="+escape(k+"="+p.Env[k]))
+	}
+
+	if p.NoCache {
+		flags = append(flags, "-no_cache")
+	}
+
+	if p.Local {
+		flags = append(flags, "-local")
+	}
+
+	return strings.Join(flags, " ")
+}
+
+// commandWrappers holds the commands that rule commands
+// are wrapped in when they are written to the Ninja
+// file, as set by Context.SetSandboxLauncher and
+// Context.SetRemoteWrapper.
+type commandWrappers struct {
+	sandboxLauncher string
+	remoteWrapper   string
 }
 
 // poolDef describes a pool definition. It does
@@ -116,20 +274,31 @@ func (p *poolDef) WriteTo(nw *ninjaWriter, name string) error {
 // ruleDef describes a rule definition. It does
 // not include the name of the rule.
 type ruleDef struct {
-	CommandDeps      []*ninjaString
-	CommandOrderOnly []*ninjaString
-	Comment          string
-	Pool             Pool
-	Variables        map[string]*ninjaString
+	CommandDeps          []*ninjaString
+	CommandOrderOnly     []*ninjaString
+	Comment              string
+	Compiler             bool
+	HashOutputs          bool
+	Pool                 Pool
+	Remote               RemoteParams
+	Variables            map[string]*ninjaString
+	RequiredNinjaVersion ninjaVersion
+
+	// The variant of the rule to use for build statements whose command
+	// is too long, set if RuleParams.RspfileCommand is set.
+	RspfileDef *ruleDef
 }
 
 func parseRuleParams(scope scope, params *RuleParams) (*ruleDef,
 	error) {
 
 	r := &ruleDef{
-		Comment:   params.Comment,
-		Pool:      params.Pool,
-		Variables: make(map[string]*ninjaString),
+		Comment:     params.Comment,
+		Compiler:    params.Compiler,
+		HashOutputs: params.HashOutputs,
+		Pool:        params.Pool,
+		Remote:      params.Remote,
+		Variables:   make(map[string]*ninjaString),
 	}
 
 	if params.Command == "" {
@@ -167,11 +336,20 @@ func parseRuleParams(scope scope, params *RuleParams) (*ruleDef,
 		r.Variables["description"] = value
 	}
 
+	if params.Dyndep != "" {
+		value, err = parseNinjaString(scope, params.Dyndep)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Dyndep param: %s", err)
+		}
+		r.Variables["dyndep"] = value
+		r.RequiredNinjaVersion = ninjaDyndepVersion
+	}
+
 	if params.Generator {
 		r.Variables["generator"] = simpleNinjaString("true")
 	}
 
-	if params.Restat {
+	if params.Restat || params.HashOutputs {
 		r.Variables["restat"] = simpleNinjaString("true")
 	}
 
@@ -202,11 +380,145 @@ func parseRuleParams(scope scope, params *RuleParams) (*ruleDef,
 		return nil, fmt.Errorf("error parsing CommandDeps param: %s", err)
 	}
 
+	if params.RspfileCommand != "" {
+		if params.Rspfile == "" || params.RspfileContent == "" {
+			return nil, fmt.Errorf("RspfileCommand param requires Rspfile " +
+				"and RspfileContent params")
+		}
+
+		value, err = parseNinjaString(scope, params.RspfileCommand)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing RspfileCommand param: %s", err)
+		}
+
+		rspfileDef := *r
+		rspfileDef.Variables = make(map[string]*ninjaString)
+		for name, value := range r.Variables {
+			rspfileDef.Variables[name] = value
+		}
+		rspfileDef.Variables["command"] = value
+		r.RspfileDef = &rspfileDef
+
+		// The rule only uses the response file when its command is too long.
+		delete(r.Variables, "rspfile")
+		delete(r.Variables, "rspfile_content")
+	}
+
 	return r, nil
 }
 
+// sandboxed returns true if the commands run by the
+// rule should be wrapped in sandboxLauncher. Generator
+// rules are never sandboxed, as they regenerate the
+// Ninja manifest from files that are not declared as
+// inputs.
+func (r *ruleDef) sandboxed(sandboxLauncher string) bool {
+	return sandboxLauncher != "" && r.Variables["generator"] == nil && !r.HashOutputs
+}
+
+// remote returns true if the commands run by the rule
+// should be wrapped in remoteWrapper. Rules that use a
+// response file are never run remotely, as the command
+// itself is passed to the remote wrapper through a
+// response file.
+func (r *ruleDef) remote(remoteWrapper string) bool {
+	return remoteWrapper != "" && r.Variables["generator"] == nil && !r.HashOutputs &&
+		r.Variables["rspfile"] == nil
+}
+
+// hashOutputsSuffix follows the command of a rule with
+// HashOutputs set, and only updates the modification
+// times of the outputs whose content changed, as
+// described by HashStampSuffix. The stamp file is
+// touched to match the output when the hash changes, so
+// that resetting the output to the stamp's modification
+// time restores exactly the time Ninja last saw.
+const hashOutputsSuffix = ") && for f in $out; do " +
+	"h=$$( (sha1sum 2>/dev/null || shasum) < $$f) || exit 1; " +
+	"if [ -f $$f" + HashStampSuffix + " ] && " +
+	"[ \"$$h\" = \"$$(cat $$f" + HashStampSuffix + ")\" ]; then " +
+	"touch -r $$f" + HashStampSuffix + " $$f; " +
+	"else echo \"$$h\" > $$f" + HashStampSuffix + " && " +
+	"touch -r $$f $$f" + HashStampSuffix + "; fi; done"
+
+// hashOutputsCommand wraps command so that it only
+// updates the outputs whose content changed.
+func hashOutputsCommand(command *ninjaString,
+	pkgNames map[*packageContext]string) *ninjaString {
+
+	return simpleNinjaString("(" + command.Value(pkgNames) + hashOutputsSuffix)
+}
+
+// hashedOutputsCommand returns the command that Ninja
+// runs for action when its rule is wrapped by
+// hashOutputsCommand.
+func hashedOutputsCommand(action *Action) string {
+	suffix := strings.NewReplacer("$out", strings.Join(action.Outputs, " "),
+		"$$", "$").Replace(hashOutputsSuffix)
+	return "(" + action.Command + suffix
+}
+
+// references returns true if the value of the rule
+// variable named variable references the Ninja variable
+// named name.
+func (r *ruleDef) references(variable, name string) bool {
+	value, ok := r.Variables[variable]
+	if !ok {
+		return false
+	}
+
+	for _, v := range value.variables {
+		if v.name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRuleDef returns warnings about likely mistakes
+// in a rule definition. The argNames argument lists the
+// arguments that the rule declares.
+func checkRuleDef(def *ruleDef, argNames map[string]bool) []string {
+	var warnings []string
+
+	referenced := func(name string) bool {
+		for variable := range def.Variables {
+			if def.references(variable, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var unused []string
+	for argName := range argNames {
+		if !referenced(argName) {
+			unused = append(unused, argName)
+		}
+	}
+	sort.Strings(unused)
+	for _, argName := range unused {
+		warnings = append(warnings, fmt.Sprintf("argument %q is never used", argName))
+	}
+
+	if !referenced("in") {
+		warnings = append(warnings, "command does not reference $in")
+	}
+
+	if _, ok := def.Variables["depfile"]; ok {
+		if _, ok := def.Variables["deps"]; !ok {
+			warnings = append(warnings, "Depfile is set without Deps")
+		}
+		if !def.references("depfile", "out") {
+			warnings = append(warnings, "Depfile does not reference $out")
+		}
+	}
+
+	return warnings
+}
+
 func (r *ruleDef) WriteTo(nw *ninjaWriter, name string,
-	pkgNames map[*packageContext]string) error {
+	pkgNames map[*packageContext]string, wrappers commandWrappers) error {
 
 	if r.Comment != "" {
 		err := nw.Comment(r.Comment)
@@ -227,7 +539,27 @@ func (r *ruleDef) WriteTo(nw *ninjaWriter, name string,
 		}
 	}
 
-	err = writeVariables(nw, r.Variables, pkgNames)
+	variables := r.Variables
+	if r.HashOutputs || r.remote(wrappers.remoteWrapper) || r.sandboxed(wrappers.sandboxLauncher) {
+		variables = make(map[string]*ninjaString)
+		for name, value := range r.Variables {
+			variables[name] = value
+		}
+	}
+	if r.HashOutputs {
+		variables["command"] = hashOutputsCommand(r.Variables["command"], pkgNames)
+	}
+
+	switch {
+	case r.remote(wrappers.remoteWrapper):
+		variables["command"] = remoteCommand(wrappers.remoteWrapper)
+		variables["rspfile"] = simpleNinjaString("${remote_script}")
+		variables["rspfile_content"] = r.Variables["command"]
+	case r.sandboxed(wrappers.sandboxLauncher):
+		variables["command"] = sandboxCommand(wrappers.sandboxLauncher, r.Variables["command"], pkgNames)
+	}
+
+	err = writeVariables(nw, variables, pkgNames)
 	if err != nil {
 		return err
 	}
@@ -235,19 +567,79 @@ func (r *ruleDef) WriteTo(nw *ninjaWriter, name string,
 	return nil
 }
 
+// sandboxCommand wraps command in calls to
+// sandboxLauncher as described in
+// Context.SetSandboxLauncher. The sandbox_dir,
+// sandbox_inputs and sandbox_outputs variables are set
+// by each build statement that uses the rule.
+func sandboxCommand(sandboxLauncher string, command *ninjaString,
+	pkgNames map[*packageContext]string) *ninjaString {
+
+	launcher := strings.NewReplacer("$", "$$", " ", "$ ").Replace(sandboxLauncher)
+
+	return simpleNinjaString(fmt.Sprintf("%s -setup ${sandbox_dir} ${sandbox_inputs} ${rspfile} && "+
+		"(cd ${sandbox_dir} && %s); "+
+		"%s -finish ${sandbox_dir} $$? ${sandbox_outputs} ${depfile}",
+		launcher, command.Value(pkgNames), launcher))
+}
+
+// sandboxedCommand returns the command that Ninja runs
+// for action when its rule is wrapped by sandboxCommand.
+func sandboxedCommand(sandboxLauncher string, action *Action) string {
+	dir := action.Outputs[0] + ".sandbox"
+
+	var inputs, outputs []string
+	inputs = append(append(inputs, action.Inputs...), action.Implicits...)
+	outputs = append(append(outputs, action.Outputs...), action.ImplicitOutputs...)
+
+	return fmt.Sprintf("%s -setup %s %s %s && (cd %s && %s); %s -finish %s $? %s %s",
+		sandboxLauncher, dir, strings.Join(inputs, " "), action.Env["rspfile"],
+		dir, action.Command,
+		sandboxLauncher, dir, strings.Join(outputs, " "), action.Env["depfile"])
+}
+
+// remoteCommand returns a command that passes the
+// original command of a rule to remoteWrapper as
+// described in Context.SetRemoteWrapper. The
+// remote_script and remote_flags variables are set by
+// each build statement that uses the rule.
+func remoteCommand(remoteWrapper string) *ninjaString {
+	wrapper := strings.NewReplacer("$", "$$", " ", "$ ").Replace(remoteWrapper)
+
+	return simpleNinjaString(fmt.Sprintf("%s ${remote_flags} -- /bin/sh ${remote_script}", wrapper))
+}
+
+// remoteWrappedCommand returns the command that Ninja
+// runs for action when its rule is wrapped by
+// remoteCommand, with remote as the combined remote
+// parameters of the rule and build statement.
+func remoteWrappedCommand(remoteWrapper string, remote RemoteParams, action *Action) string {
+	var inputs, outputs []string
+	inputs = append(append(inputs, action.Inputs...), action.Implicits...)
+	outputs = append(append(outputs, action.Outputs...), action.ImplicitOutputs...)
+
+	flags := strings.Replace(remote.flags(inputs, outputs), "$$", "$", -1)
+
+	return fmt.Sprintf("%s %s -- /bin/sh %s", remoteWrapper, flags,
+		action.Outputs[0]+".remote.sh")
+}
+
 // buildDef describes a build target definition.
 type buildDef struct {
-	Comment         string
-	Rule            Rule
-	RuleDef         *ruleDef
-	Outputs         []*ninjaString
-	ImplicitOutputs []*ninjaString
-	Inputs          []*ninjaString
-	Implicits       []*ninjaString
-	OrderOnly       []*ninjaString
-	Args            map[Variable]*ninjaString
-	Variables       map[string]*ninjaString
-	Optional        bool
+	Comment              string
+	Rule                 Rule
+	RuleDef              *ruleDef
+	Outputs              []*ninjaString
+	ImplicitOutputs      []*ninjaString
+	Inputs               []*ninjaString
+	Implicits            []*ninjaString
+	OrderOnly            []*ninjaString
+	Validations          []*ninjaString
+	Args                 map[Variable]*ninjaString
+	Variables            map[string]*ninjaString
+	Optional             bool
+	Remote               RemoteParams
+	RequiredNinjaVersion ninjaVersion
 }
 
 func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
@@ -259,6 +651,7 @@ func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
 	b := &buildDef{
 		Comment: comment,
 		Rule:    rule,
+		Remote:  params.Remote,
 	}
 
 	setVariable := func(name string, value *ninjaString) {
@@ -302,6 +695,14 @@ func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
 		return nil, fmt.Errorf("error parsing OrderOnly param: %s", err)
 	}
 
+	b.Validations, err = parseNinjaStrings(scope, params.Validations)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Validations param: %s", err)
+	}
+	if len(b.Validations) > 0 {
+		b.requireNinjaVersion(ninjaValidationsVersion)
+	}
+
 	b.Optional = params.Optional
 
 	if params.Depfile != "" {
@@ -324,6 +725,20 @@ func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
 		setVariable("description", value)
 	}
 
+	if params.Dyndep != "" {
+		if !inStringLists(params.Dyndep, params.Inputs, params.Implicits, params.OrderOnly) {
+			return nil, fmt.Errorf("Dyndep file %q is not listed in Inputs, "+
+				"Implicits or OrderOnly", params.Dyndep)
+		}
+
+		value, err := parseNinjaString(scope, params.Dyndep)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Dyndep param: %s", err)
+		}
+		setVariable("dyndep", value)
+		b.requireNinjaVersion(ninjaDyndepVersion)
+	}
+
 	argNameScope := rule.scope()
 
 	if len(params.Args) > 0 {
@@ -352,7 +767,70 @@ func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
 	return b, nil
 }
 
-func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string) error {
+// checkBuildDef returns warnings about likely mistakes
+// in a build statement, based on the definition of the
+// rule it uses. The argNames argument lists the
+// arguments that the rule declares.
+func checkBuildDef(def *buildDef, argNames map[string]bool) []string {
+	if def.RuleDef == nil {
+		return nil
+	}
+
+	var warnings []string
+
+	if len(def.Outputs) > 1 && def.RuleDef.references("command", "out") {
+		warnings = append(warnings, fmt.Sprintf("command references $out, "+
+			"which expands to all %d outputs", len(def.Outputs)))
+	}
+
+	set := make(map[string]bool)
+	for argVar := range def.Args {
+		set[argVar.name()] = true
+	}
+
+	var unset []string
+	for argName := range argNames {
+		if set[argName] || !def.RuleDef.references("command", argName) {
+			continue
+		}
+
+		// Arguments that shadow a package-scoped variable default to the
+		// value of that variable.
+		if v, err := def.Rule.scope().LookupVariable(argName); err == nil {
+			if _, isArg := v.(*argVariable); !isArg {
+				continue
+			}
+		}
+
+		unset = append(unset, argName)
+	}
+	sort.Strings(unset)
+	for _, argName := range unset {
+		warnings = append(warnings, fmt.Sprintf("argument %q is referenced "+
+			"by the command but not set", argName))
+	}
+
+	return warnings
+}
+
+func (b *buildDef) requireNinjaVersion(v ninjaVersion) {
+	if v.newerThan(b.RequiredNinjaVersion) {
+		b.RequiredNinjaVersion = v
+	}
+}
+
+// allOutputs returns the explicit and implicit outputs
+// of the build statement in a new slice, so that it can
+// be appended to without modifying the build statement.
+func (b *buildDef) allOutputs() []*ninjaString {
+	outputs := make([]*ninjaString, 0, len(b.Outputs)+len(b.ImplicitOutputs))
+	outputs = append(outputs, b.Outputs...)
+	return append(outputs, b.ImplicitOutputs...)
+}
+
+func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string,
+	wrappers commandWrappers) error {
+
 	var (
 		comment       = b.Comment
 		rule          = b.Rule.fullName(pkgNames)
@@ -361,6 +839,7 @@ func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string)
 		explicitDeps  = valueList(b.Inputs, pkgNames, inputEscaper)
 		implicitDeps  = valueList(b.Implicits, pkgNames, inputEscaper)
 		orderOnlyDeps = valueList(b.OrderOnly, pkgNames, inputEscaper)
+		validations   = valueList(b.Validations, pkgNames, inputEscaper)
 	)
 
 	if b.RuleDef != nil {
@@ -368,7 +847,8 @@ func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string)
 		orderOnlyDeps = append(valueList(b.RuleDef.CommandOrderOnly, pkgNames, inputEscaper), orderOnlyDeps...)
 	}
 
-	err := nw.Build(comment, rule, outputs, implicitOuts, explicitDeps, implicitDeps, orderOnlyDeps)
+	err := nw.Build(comment, rule, outputs, implicitOuts, explicitDeps, implicitDeps, orderOnlyDeps,
+		validations)
 	if err != nil {
 		return err
 	}
@@ -384,6 +864,31 @@ func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string)
 		return err
 	}
 
+	if b.RuleDef != nil && b.RuleDef.remote(wrappers.remoteWrapper) {
+		remote := b.RuleDef.Remote.merge(b.Remote)
+		err = nw.ScopedAssign("remote_script", outputs[0]+".remote.sh")
+		if err != nil {
+			return err
+		}
+		err = nw.ScopedAssign("remote_flags", remote.flags(append(explicitDeps, implicitDeps...),
+			append(outputs, implicitOuts...)))
+		if err != nil {
+			return err
+		}
+	} else if b.RuleDef != nil && b.RuleDef.sandboxed(wrappers.sandboxLauncher) {
+		sandboxVariables := map[string]string{
+			"sandbox_dir":     outputs[0] + ".sandbox",
+			"sandbox_inputs":  strings.Join(append(explicitDeps, implicitDeps...), " "),
+			"sandbox_outputs": strings.Join(append(outputs, implicitOuts...), " "),
+		}
+		for _, name := range []string{"sandbox_dir", "sandbox_inputs", "sandbox_outputs"} {
+			err = nw.ScopedAssign(name, sandboxVariables[name])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	var keys []string
 	for k := range args {
 		keys = append(keys, k)
@@ -404,6 +909,49 @@ func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string)
 	return nw.BlankLine()
 }
 
+// validationDef describes a set of validation targets
+// to attach to the build statement that produces
+// Output, which may have been created by a different
+// module or singleton.
+type validationDef struct {
+	Output      *ninjaString
+	Validations []*ninjaString
+}
+
+func parseValidationParams(scope scope, output string,
+	validations []string) (*validationDef, error) {
+
+	if len(validations) == 0 {
+		return nil, errors.New("validations param has no elements")
+	}
+
+	outputValue, err := parseNinjaString(scope, output)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing output param: %s", err)
+	}
+
+	validationValues, err := parseNinjaStrings(scope, validations)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing validations param: %s", err)
+	}
+
+	return &validationDef{
+		Output:      outputValue,
+		Validations: validationValues,
+	}, nil
+}
+
+func inStringLists(s string, lists ...[]string) bool {
+	for _, list := range lists {
+		for _, x := range list {
+			if x == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func valueList(list []*ninjaString, pkgNames map[*packageContext]string,
 	escaper *strings.Replacer) []string {
 
@@ -23,6 +23,10 @@ var (
 type ninjaString struct {
 	strings   []string
 	variables []Variable
+
+	// The byte offset of the '$' of each variable reference in the
+	// string that was parsed.  Only set by parseNinjaString.
+	offsets []int
 }
 
 type scope interface {
@@ -46,7 +50,15 @@ type parseState struct {
 	result      *ninjaString
 }
 
-func (ps *parseState) pushVariable(v Variable) {
+// pushVariable looks up the variable whose name ends at
+// byte offset end and whose reference starts at byte
+// offset start, and appends it to the result.
+func (ps *parseState) pushVariable(start, end int) error {
+	v, err := ps.scope.LookupVariable(ps.str[ps.varStart:end])
+	if err != nil {
+		return fmt.Errorf("%s at byte offset %d of %q", err, start, ps.str)
+	}
+
 	if len(ps.result.variables) == len(ps.result.strings) {
 		// Last push was a variable, we need a blank string separator
 		ps.result.strings = append(ps.result.strings, "")
@@ -55,6 +67,8 @@ func (ps *parseState) pushVariable(v Variable) {
 		panic("oops, pushed variable with pending string")
 	}
 	ps.result.variables = append(ps.result.variables, v)
+	ps.result.offsets = append(ps.result.offsets, start)
+	return nil
 }
 
 func (ps *parseState) pushString(s string) {
@@ -78,6 +92,7 @@ func parseNinjaString(scope scope, str string) (*ninjaString, error) {
 	result := &ninjaString{
 		strings:   make([]string, 0, n+1),
 		variables: make([]Variable, 0, n),
+		offsets:   make([]int, 0, n),
 	}
 
 	parseState := &parseState{
@@ -168,12 +183,11 @@ func parseDollarState(state *parseState, i int, r rune) (stateFunc, error) {
 	case r == '$':
 		// A dollar after the variable name (e.g. "$blah$").  Output the
 		// variable we have and start a new one.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
+		err := state.pushVariable(state.varStart-1, i)
 		if err != nil {
 			return nil, err
 		}
 
-		state.pushVariable(v)
 		state.varStart = i + 1
 		state.stringStart = i
 
@@ -181,13 +195,11 @@ func parseDollarState(state *parseState, i int, r rune) (stateFunc, error) {
 
 	case r == eof:
 		// This is the end of the variable name.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
+		err := state.pushVariable(state.varStart-1, i)
 		if err != nil {
 			return nil, err
 		}
 
-		state.pushVariable(v)
-
 		// We always end with a string, even if it's an empty one.
 		state.pushString("")
 
@@ -196,12 +208,11 @@ func parseDollarState(state *parseState, i int, r rune) (stateFunc, error) {
 	default:
 		// We've just gone past the end of the variable name, so record what
 		// we have.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
+		err := state.pushVariable(state.varStart-1, i)
 		if err != nil {
 			return nil, err
 		}
 
-		state.pushVariable(v)
 		state.stringStart = i
 		return parseStringState, nil
 	}
@@ -222,12 +233,11 @@ func parseBracketsState(state *parseState, i int, r rune) (stateFunc, error) {
 		}
 
 		// This is the end of the variable name.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
+		err := state.pushVariable(state.varStart-2, i)
 		if err != nil {
 			return nil, err
 		}
 
-		state.pushVariable(v)
 		state.stringStart = i + 1
 		return parseStringState, nil
 
@@ -274,13 +284,24 @@ func (n *ninjaString) ValueWithEscaper(pkgNames map[*packageContext]string,
 }
 
 func (n *ninjaString) Eval(variables map[Variable]*ninjaString) (string, error) {
-	str := n.strings[0]
-	for i, v := range n.variables {
+	var lookup func(v Variable) (string, error)
+	lookup = func(v Variable) (string, error) {
 		variable, ok := variables[v]
 		if !ok {
 			return "", fmt.Errorf("no such global variable: %s", v)
 		}
-		value, err := variable.Eval(variables)
+		return variable.EvalWith(lookup)
+	}
+	return n.EvalWith(lookup)
+}
+
+// EvalWith expands the ninjaString, calling lookup to
+// get the expanded value of each variable it
+// references.
+func (n *ninjaString) EvalWith(lookup func(v Variable) (string, error)) (string, error) {
+	str := n.strings[0]
+	for i, v := range n.variables {
+		value, err := lookup(v)
 		if err != nil {
 			return "", err
 		}
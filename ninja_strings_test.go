@@ -0,0 +1,65 @@
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNinjaStringOffsets(t *testing.T) {
+	scope := newLocalScope(nil, "")
+	for _, name := range []string{"foo", "bar"} {
+		if _, err := scope.AddLocalVariable(name, "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		input   string
+		offsets []int
+		err     string
+	}{
+		{
+			input:   "a $foo ${bar} $$ $foo",
+			offsets: []int{2, 7, 17},
+		},
+		{
+			input:   "$foo$bar",
+			offsets: []int{0, 4},
+		},
+		{
+			input:   "plain $$ string",
+			offsets: []int{},
+		},
+		{
+			input: "a ${fooo}",
+			err:   `undefined variable "fooo" (did you mean "foo"?) at byte offset 2 of "a ${fooo}"`,
+		},
+		{
+			input: "$foo $baz",
+			err: `undefined variable "baz" (did you mean "bar"?) ` +
+				`at byte offset 5 of "$foo $baz"`,
+		},
+		{
+			input: "$foo/$unknown",
+			err:   `undefined variable "unknown" at byte offset 5 of "$foo/$unknown"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		ninjaStr, err := parseNinjaString(scope.scope, testCase.input)
+		if testCase.err != "" {
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("%q: expected error %q, got %v", testCase.input, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", testCase.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(ninjaStr.offsets, testCase.offsets) {
+			t.Errorf("%q: expected offsets %v, got %v", testCase.input, testCase.offsets,
+				ninjaStr.offsets)
+		}
+	}
+}
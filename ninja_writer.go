@@ -90,7 +90,7 @@ func (n *ninjaWriter) Rule(name string) error {
 }
 
 func (n *ninjaWriter) Build(comment string, rule string, outputs, implicitOuts,
-	explicitDeps, implicitDeps, orderOnlyDeps []string) error {
+	explicitDeps, implicitDeps, orderOnlyDeps, validations []string) error {
 
 	n.justDidBlankLine = false
 
@@ -144,6 +144,14 @@ func (n *ninjaWriter) Build(comment string, rule string, outputs, implicitOuts,
 		}
 	}
 
+	if len(validations) > 0 {
+		wrapper.WriteStringWithSpace("|@")
+
+		for _, validation := range validations {
+			wrapper.WriteStringWithSpace(validation)
+		}
+	}
+
 	return wrapper.Flush()
 }
 
@@ -179,6 +187,18 @@ func (n *ninjaWriter) Default(targets ...string) error {
 	return wrapper.Flush()
 }
 
+func (n *ninjaWriter) Subninja(file string) error {
+	n.justDidBlankLine = false
+	_, err := fmt.Fprintf(n.writer, "subninja %s\n", file)
+	return err
+}
+
+func (n *ninjaWriter) Include(file string) error {
+	n.justDidBlankLine = false
+	_, err := fmt.Fprintf(n.writer, "include %s\n", file)
+	return err
+}
+
 func (n *ninjaWriter) BlankLine() (err error) {
 	// We don't output multiple blank lines in a row.
 	if !n.justDidBlankLine {
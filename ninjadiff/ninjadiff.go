@@ -0,0 +1,281 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	quiet = flag.Bool("q", false, "only list the outputs of added, removed and changed build statements")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ninjadiff [-q] old.ninja new.ninja")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "ninjadiff compares the build statements of two Ninja files, including")
+	fmt.Fprintln(os.Stderr, "the files they include, with all variable references expanded. Build")
+	fmt.Fprintln(os.Stderr, "statements are matched by their first output. Paths in include and")
+	fmt.Fprintln(os.Stderr, "subninja statements are relative to the working directory, as they")
+	fmt.Fprintln(os.Stderr, "are for Ninja. The exit status is 1 if the files differ.")
+	fmt.Fprintln(os.Stderr)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		usage()
+	}
+
+	oldManifest, err := parseManifest(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	newManifest, err := parseManifest(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if diffManifests(os.Stdout, oldManifest, newManifest, !*quiet) {
+		os.Exit(1)
+	}
+}
+
+// diffManifests writes the differences between the build
+// statements of two manifests to w and returns true if
+// there were any.
+func diffManifests(w io.Writer, oldManifest, newManifest *manifest, details bool) bool {
+	keys := make(map[string]bool)
+	for key := range oldManifest.builds {
+		keys[key] = true
+	}
+	for key := range newManifest.builds {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var added, removed, changed int
+
+	for _, key := range sortedKeys {
+		oldBuild, newBuild := oldManifest.builds[key], newManifest.builds[key]
+		switch {
+		case oldBuild == nil:
+			fmt.Fprintf(w, "added: %s\n", key)
+			added++
+		case newBuild == nil:
+			fmt.Fprintf(w, "removed: %s\n", key)
+			removed++
+		default:
+			var buf strings.Builder
+			if diffBuilds(&buf, oldBuild, newBuild) {
+				fmt.Fprintf(w, "changed: %s\n", key)
+				if details {
+					fmt.Fprintf(w, "    %s -> %s\n", oldBuild.pos, newBuild.pos)
+					io.WriteString(w, buf.String())
+				}
+				changed++
+			}
+		}
+	}
+
+	var buf strings.Builder
+	if diffLists(&buf, "defaults", oldManifest.defaults, newManifest.defaults) {
+		io.WriteString(w, "changed: default\n")
+		if details {
+			io.WriteString(w, buf.String())
+		}
+		changed++
+	}
+
+	if details && added+removed+changed > 0 {
+		fmt.Fprintf(w, "%d added, %d removed, %d changed\n", added, removed, changed)
+	}
+
+	return added+removed+changed > 0
+}
+
+// diffBuilds writes the differences between two build
+// statements for the same output to w and returns true
+// if there were any. Rule names are not compared, as
+// they depend on the unique package names chosen by
+// Blueprint; the expanded rule variables are compared
+// instead.
+func diffBuilds(w io.Writer, oldBuild, newBuild *build) bool {
+	different := false
+
+	lists := []struct {
+		name     string
+		old, new []string
+	}{
+		{"outputs", oldBuild.outputs, newBuild.outputs},
+		{"implicit outputs", oldBuild.implicitOuts, newBuild.implicitOuts},
+		{"inputs", oldBuild.inputs, newBuild.inputs},
+		{"implicits", oldBuild.implicits, newBuild.implicits},
+		{"order-only", oldBuild.orderOnly, newBuild.orderOnly},
+		{"validations", oldBuild.validations, newBuild.validations},
+	}
+
+	for _, list := range lists {
+		if diffLists(w, list.name, list.old, list.new) {
+			different = true
+		}
+	}
+
+	for _, name := range reservedVariables {
+		oldValue, newValue := oldBuild.variables[name], newBuild.variables[name]
+		if oldValue == newValue {
+			continue
+		}
+		different = true
+
+		if name == "command" && oldValue != "" && newValue != "" {
+			fmt.Fprintf(w, "    command:\n")
+			diffWords(w, strings.Fields(oldValue), strings.Fields(newValue))
+		} else {
+			fmt.Fprintf(w, "    %s:\n", name)
+			if oldValue != "" {
+				fmt.Fprintf(w, "      - %s\n", oldValue)
+			}
+			if newValue != "" {
+				fmt.Fprintf(w, "      + %s\n", newValue)
+			}
+		}
+	}
+
+	return different
+}
+
+// diffLists writes the entries that were removed from
+// and added to a list of paths to w and returns true if
+// there were any. Changes in order are ignored.
+func diffLists(w io.Writer, name string, oldList, newList []string) bool {
+	oldSet := make(map[string]bool)
+	for _, s := range oldList {
+		oldSet[s] = true
+	}
+	newSet := make(map[string]bool)
+	for _, s := range newList {
+		newSet[s] = true
+	}
+
+	var lines []string
+	for _, s := range oldList {
+		if !newSet[s] {
+			lines = append(lines, "      - "+s)
+		}
+	}
+	for _, s := range newList {
+		if !oldSet[s] {
+			lines = append(lines, "      + "+s)
+		}
+	}
+
+	if len(lines) == 0 {
+		return false
+	}
+
+	fmt.Fprintf(w, "    %s:\n", name)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	return true
+}
+
+// maxDiffWords limits the number of words, after the
+// unchanged words at the start and end are removed, that
+// diffWords compares word by word, as the comparison
+// takes time and memory proportional to the product of
+// the lengths of the two commands.
+const maxDiffWords = 2000
+
+// diffWords writes a diff of two commands split into
+// words to w, showing the removed and added words along
+// with the unchanged word before each change. Commands
+// that differ in more than maxDiffWords words are shown
+// as the removed and added commands.
+func diffWords(w io.Writer, oldWords, newWords []string) {
+	context := ""
+
+	// Skip the unchanged words at the start and end, which are usually
+	// most of the command.
+	for len(oldWords) > 0 && len(newWords) > 0 && oldWords[0] == newWords[0] {
+		context = oldWords[0]
+		oldWords, newWords = oldWords[1:], newWords[1:]
+	}
+	for len(oldWords) > 0 && len(newWords) > 0 &&
+		oldWords[len(oldWords)-1] == newWords[len(newWords)-1] {
+		oldWords, newWords = oldWords[:len(oldWords)-1], newWords[:len(newWords)-1]
+	}
+
+	if len(oldWords)+len(newWords) > maxDiffWords {
+		if context != "" {
+			fmt.Fprintf(w, "        %s\n", context)
+		}
+		if len(oldWords) > 0 {
+			fmt.Fprintf(w, "      - %s\n", strings.Join(oldWords, " "))
+		}
+		if len(newWords) > 0 {
+			fmt.Fprintf(w, "      + %s\n", strings.Join(newWords, " "))
+		}
+		return
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// oldWords[i:] and newWords[j:].
+	lcs := make([][]int, len(oldWords)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newWords)+1)
+	}
+	for i := len(oldWords) - 1; i >= 0; i-- {
+		for j := len(newWords) - 1; j >= 0; j-- {
+			if oldWords[i] == newWords[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	printed := false
+	change := func(prefix, word string) {
+		if context != "" && !printed {
+			fmt.Fprintf(w, "        %s\n", context)
+		}
+		fmt.Fprintf(w, "      %s %s\n", prefix, word)
+		printed = true
+	}
+
+	i, j := 0, 0
+	for i < len(oldWords) || j < len(newWords) {
+		switch {
+		case i < len(oldWords) && j < len(newWords) && oldWords[i] == newWords[j]:
+			context = oldWords[i]
+			printed = false
+			i++
+			j++
+		case j == len(newWords) || i < len(oldWords) && lcs[i+1][j] >= lcs[i][j+1]:
+			change("-", oldWords[i])
+			i++
+		default:
+			change("+", newWords[j])
+			j++
+		}
+	}
+}
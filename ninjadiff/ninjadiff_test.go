@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifests(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ninjadiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		contents = strings.Replace(contents, "$dir", dir, -1)
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDiffManifests(t *testing.T) {
+	dir := writeManifests(t, map[string]string{
+		"old.ninja": `
+cflags = -O2
+rule cc
+    command = clang $cflags -c $in -o $out
+rule cp_abc
+    command = cp $in $out
+
+build a.o: cc a.c
+build b.o: cc b.c | b.h
+build c: cp_abc c.in
+build d: cp_abc d.in
+default a.o
+`,
+		"new.ninja": `
+cflags = -O2
+rule compile
+    command = clang $cflags -Wall -c $in -o $out
+rule cp_def
+    command = cp $in $out
+
+build a.o: compile a.c
+build b.o: compile b.c | b.h
+    cflags = -O2
+build c: cp_def c.in
+include $dir/sub.ninja
+default a.o e
+`,
+		"sub.ninja": `
+build e: cp_def e.in
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	oldManifest, err := parseManifest(filepath.Join(dir, "old.ninja"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newManifest, err := parseManifest(filepath.Join(dir, "new.ninja"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if !diffManifests(&buf, oldManifest, newManifest, false) {
+		t.Fatal("expected the manifests to differ")
+	}
+
+	// Renaming a rule is not a change, only the expanded
+	// command is compared.
+	expected := "changed: a.o\n" +
+		"changed: b.o\n" +
+		"removed: d\n" +
+		"added: e\n" +
+		"changed: default\n"
+	if buf.String() != expected {
+		t.Errorf("incorrect diff:\n  expected: %q\n       got: %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	diffManifests(&buf, oldManifest, newManifest, true)
+	for _, want := range []string{
+		"changed: a.o\n    " + filepath.Join(dir, "old.ninja") + ":8 -> " +
+			filepath.Join(dir, "new.ninja") + ":8\n" +
+			"    command:\n        -O2\n      + -Wall\n",
+		"changed: default\n    defaults:\n      + e\n",
+		"1 added, 1 removed, 3 changed\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if diffManifests(&buf, oldManifest, oldManifest, true) || buf.Len() > 0 {
+		t.Errorf("expected no differences, got:\n%s", buf.String())
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	long := strings.Repeat("x ", maxDiffWords)
+
+	testCases := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{
+			name:     "changed word",
+			old:      "cc -O2 -c a.c -o a.o",
+			new:      "cc -O3 -c a.c -o a.o",
+			expected: "        cc\n      - -O2\n      + -O3\n",
+		},
+		{
+			name:     "added words",
+			old:      "cc -c a.c",
+			new:      "cc -c a.c -o a.o",
+			expected: "        a.c\n      + -o\n      + a.o\n",
+		},
+		{
+			name:     "removed first word",
+			old:      "env cc -c a.c",
+			new:      "cc -c a.c",
+			expected: "      - env\n",
+		},
+		{
+			name:     "separate changes",
+			old:      "cc -a -c a.c -b",
+			new:      "cc -c a.c -d",
+			expected: "        cc\n      - -a\n        a.c\n      - -b\n      + -d\n",
+		},
+		{
+			name: "long commands",
+			old:  "cc " + long + "-o a.o",
+			new:  "cc -c a.c -o a.o",
+			expected: "        cc\n      - " + strings.TrimSpace(long) + "\n" +
+				"      + -c a.c\n",
+		},
+		{
+			name:     "long unchanged words",
+			old:      long + "-a",
+			new:      long + "-b",
+			expected: "        x\n      - -a\n      + -b\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf strings.Builder
+			diffWords(&buf, strings.Fields(testCase.old), strings.Fields(testCase.new))
+			if buf.String() != testCase.expected {
+				t.Errorf("incorrect diff:\n  expected: %q\n       got: %q",
+					testCase.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// evalString is a Ninja string that has been split into
+// literal text and variable references. Literal pieces
+// have an empty variable name.
+type evalString []evalPiece
+
+type evalPiece struct {
+	literal  string
+	variable string
+}
+
+func (s evalString) eval(lookup func(name string) (string, error)) (string, error) {
+	var buf strings.Builder
+	for _, piece := range s {
+		if piece.variable == "" {
+			buf.WriteString(piece.literal)
+			continue
+		}
+		value, err := lookup(piece.variable)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(value)
+	}
+	return buf.String(), nil
+}
+
+// scope holds the variables and rules defined in a
+// Ninja file. A file included with subninja gets a child
+// scope, a file included with include shares the scope
+// of the file that includes it.
+type scope struct {
+	parent    *scope
+	variables map[string]string
+	rules     map[string]*rule
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{
+		parent:    parent,
+		variables: make(map[string]string),
+		rules:     make(map[string]*rule),
+	}
+}
+
+func (s *scope) lookupVariable(name string) string {
+	for ; s != nil; s = s.parent {
+		if value, ok := s.variables[name]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func (s *scope) lookupRule(name string) *rule {
+	for ; s != nil; s = s.parent {
+		if r, ok := s.rules[name]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
+type rule struct {
+	name      string
+	variables map[string]evalString
+}
+
+// build is a build statement with all of its paths and
+// variables expanded.
+type build struct {
+	pos          string
+	rule         string
+	outputs      []string
+	implicitOuts []string
+	inputs       []string
+	implicits    []string
+	orderOnly    []string
+	validations  []string
+	variables    map[string]string // The expanded reserved Ninja variables.
+}
+
+// reservedVariables are the rule and build variables
+// that Ninja interprets itself. The other variables only
+// matter as far as they are referenced by these.
+var reservedVariables = []string{
+	"command",
+	"depfile",
+	"deps",
+	"description",
+	"dyndep",
+	"generator",
+	"msvc_deps_prefix",
+	"pool",
+	"restat",
+	"rspfile",
+	"rspfile_content",
+}
+
+// manifest contains the build statements of a Ninja file
+// and the files it includes, keyed by their first output.
+type manifest struct {
+	builds   map[string]*build
+	defaults []string
+}
+
+type line struct {
+	pos      string
+	text     string
+	indented bool
+}
+
+// readLines splits a Ninja file into logical lines,
+// joining lines continued with a trailing $ and dropping
+// comments and blank lines.
+func readLines(filename string, data string) []line {
+	var lines []line
+	var current string
+	var start int
+	continued := false
+
+	for i, text := range strings.Split(data, "\n") {
+		text = strings.TrimSuffix(text, "\r")
+		if continued {
+			text = strings.TrimLeft(text, " ")
+		} else {
+			start = i + 1
+			if strings.HasPrefix(strings.TrimLeft(text, " "), "#") {
+				continue
+			}
+		}
+
+		// A line is continued if it ends in an odd number of $.
+		dollars := len(text) - len(strings.TrimRight(text, "$"))
+		if dollars%2 == 1 {
+			current += text[:len(text)-1]
+			continued = true
+			continue
+		}
+
+		current += text
+		continued = false
+
+		if strings.TrimSpace(current) != "" {
+			lines = append(lines, line{
+				pos:      fmt.Sprintf("%s:%d", filename, start),
+				text:     strings.TrimLeft(current, " "),
+				indented: strings.HasPrefix(current, " "),
+			})
+		}
+		current = ""
+	}
+
+	return lines
+}
+
+// parseEvalString parses a Ninja string. If path is true
+// the string ends at the first unescaped space, colon or
+// pipe, and the length of the parsed prefix is returned.
+func parseEvalString(s string, path bool) (evalString, int, error) {
+	var result evalString
+	var literal strings.Builder
+
+	flush := func() {
+		if literal.Len() > 0 {
+			result = append(result, evalPiece{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	isVariableChar := func(c byte) bool {
+		return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '_' || c == '-'
+	}
+
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if path && (c == ' ' || c == ':' || c == '|') {
+			break
+		}
+		if c != '$' {
+			literal.WriteByte(c)
+			i++
+			continue
+		}
+
+		if i+1 >= len(s) {
+			return nil, 0, fmt.Errorf("unexpected $ at end of %q", s)
+		}
+
+		switch next := s[i+1]; {
+		case next == '$' || next == ' ' || next == ':':
+			literal.WriteByte(next)
+			i += 2
+		case next == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				return nil, 0, fmt.Errorf("unterminated ${ in %q", s)
+			}
+			flush()
+			result = append(result, evalPiece{variable: s[i+2 : i+end]})
+			i += end + 1
+		case isVariableChar(next):
+			end := i + 1
+			for end < len(s) && isVariableChar(s[end]) {
+				end++
+			}
+			flush()
+			result = append(result, evalPiece{variable: s[i+1 : end]})
+			i = end
+		default:
+			return nil, 0, fmt.Errorf("invalid $ escape in %q", s)
+		}
+	}
+	flush()
+
+	return result, i, nil
+}
+
+// parseBinding parses a "name = value" line.
+func parseBinding(text string) (string, evalString, error) {
+	eq := strings.IndexByte(text, '=')
+	if eq == -1 {
+		return "", nil, fmt.Errorf("expected '=' in %q", text)
+	}
+
+	name := strings.TrimSpace(text[:eq])
+	value, _, err := parseEvalString(strings.TrimLeft(text[eq+1:], " "), false)
+	return name, value, err
+}
+
+// buildLine is a parsed build statement line. Each list
+// of paths is stored under the operator that precedes it.
+type buildLine struct {
+	rule  string
+	paths map[string][]evalString
+}
+
+func parseBuildLine(text string) (*buildLine, error) {
+	b := &buildLine{paths: make(map[string][]evalString)}
+	section := ""
+
+	for {
+		text = strings.TrimLeft(text, " ")
+		if text == "" {
+			break
+		}
+
+		var op string
+		switch {
+		case strings.HasPrefix(text, "||"):
+			op = "||"
+		case strings.HasPrefix(text, "|@"):
+			op = "|@"
+		case strings.HasPrefix(text, "|"):
+			op = "|"
+		case strings.HasPrefix(text, ":"):
+			op = ":"
+		}
+
+		if op != "" {
+			text = text[len(op):]
+			section = op
+			// The implicit inputs operator is distinct from the implicit
+			// outputs operator that precedes the rule name.
+			if b.rule != "" && op == "|" {
+				section = "in|"
+			}
+			if op == ":" {
+				text = strings.TrimLeft(text, " ")
+				end := strings.IndexAny(text, " |")
+				if end == -1 {
+					end = len(text)
+				}
+				b.rule = text[:end]
+				text = text[end:]
+				section = "in"
+			}
+			continue
+		}
+
+		path, n, err := parseEvalString(text, true)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("unexpected character in %q", text)
+		}
+		b.paths[section] = append(b.paths[section], path)
+		text = text[n:]
+	}
+
+	if b.rule == "" {
+		return nil, fmt.Errorf("build statement has no rule")
+	}
+
+	return b, nil
+}
+
+// parseManifest parses the Ninja file filename and the
+// files it includes.
+func parseManifest(filename string) (*manifest, error) {
+	m := &manifest{builds: make(map[string]*build)}
+	err := m.parseFile(filename, newScope(nil))
+	return m, err
+}
+
+func (m *manifest) parseFile(filename string, s *scope) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	lines := readLines(filename, string(data))
+
+	// bindings returns the indented binding lines that follow line i.
+	bindings := func(i int) (map[string]evalString, int, error) {
+		vars := make(map[string]evalString)
+		for i+1 < len(lines) && lines[i+1].indented {
+			i++
+			name, value, err := parseBinding(lines[i].text)
+			if err != nil {
+				return nil, i, fmt.Errorf("%s: %s", lines[i].pos, err)
+			}
+			vars[name] = value
+		}
+		return vars, i, nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		if l.indented {
+			return fmt.Errorf("%s: unexpected indented line", l.pos)
+		}
+
+		keyword := l.text
+		rest := ""
+		if space := strings.IndexByte(l.text, ' '); space != -1 {
+			keyword, rest = l.text[:space], strings.TrimLeft(l.text[space+1:], " ")
+		}
+
+		switch keyword {
+		case "rule":
+			vars, next, err := bindings(i)
+			if err != nil {
+				return err
+			}
+			s.rules[rest] = &rule{name: rest, variables: vars}
+			i = next
+		case "pool":
+			_, next, err := bindings(i)
+			if err != nil {
+				return err
+			}
+			i = next
+		case "build":
+			vars, next, err := bindings(i)
+			if err != nil {
+				return err
+			}
+			b, err := m.parseBuild(rest, vars, s)
+			if err != nil {
+				return fmt.Errorf("%s: %s", l.pos, err)
+			}
+			b.pos = l.pos
+			if len(b.outputs) > 0 {
+				m.builds[b.outputs[0]] = b
+			}
+			i = next
+		case "default":
+			paths, err := evalPaths(rest, s)
+			if err != nil {
+				return fmt.Errorf("%s: %s", l.pos, err)
+			}
+			m.defaults = append(m.defaults, paths...)
+		case "include", "subninja":
+			paths, err := evalPaths(rest, s)
+			if err != nil || len(paths) != 1 {
+				return fmt.Errorf("%s: invalid %s statement", l.pos, keyword)
+			}
+			fileScope := s
+			if keyword == "subninja" {
+				fileScope = newScope(s)
+			}
+			if err := m.parseFile(paths[0], fileScope); err != nil {
+				return err
+			}
+		default:
+			name, value, err := parseBinding(l.text)
+			if err != nil {
+				return fmt.Errorf("%s: %s", l.pos, err)
+			}
+			s.variables[name], err = value.eval(func(name string) (string, error) {
+				return s.lookupVariable(name), nil
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %s", l.pos, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func evalPaths(text string, s *scope) ([]string, error) {
+	var paths []string
+	for text = strings.TrimLeft(text, " "); text != ""; text = strings.TrimLeft(text, " ") {
+		path, n, err := parseEvalString(text, true)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("unexpected character in %q", text)
+		}
+		value, _ := path.eval(func(name string) (string, error) {
+			return s.lookupVariable(name), nil
+		})
+		paths = append(paths, value)
+		text = text[n:]
+	}
+	return paths, nil
+}
+
+func (m *manifest) parseBuild(text string, bindings map[string]evalString, s *scope) (*build, error) {
+	bl, err := parseBuildLine(text)
+	if err != nil {
+		return nil, err
+	}
+
+	r := s.lookupRule(bl.rule)
+	if r == nil && bl.rule != "phony" {
+		return nil, fmt.Errorf("unknown rule %q", bl.rule)
+	}
+
+	// Build variables are expanded in the scope of the file.
+	buildVars := make(map[string]string)
+	for name, value := range bindings {
+		buildVars[name], err = value.eval(func(name string) (string, error) {
+			return s.lookupVariable(name), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Paths can refer to build variables as well.
+	pathLookup := func(name string) (string, error) {
+		if value, ok := buildVars[name]; ok {
+			return value, nil
+		}
+		return s.lookupVariable(name), nil
+	}
+
+	evalList := func(section string) ([]string, error) {
+		var values []string
+		for _, path := range bl.paths[section] {
+			value, err := path.eval(pathLookup)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	b := &build{
+		rule:      bl.rule,
+		variables: make(map[string]string),
+	}
+
+	lists := []struct {
+		dest    *[]string
+		section string
+	}{
+		{&b.outputs, ""},
+		{&b.implicitOuts, "|"},
+		{&b.inputs, "in"},
+		{&b.implicits, "in|"},
+		{&b.orderOnly, "||"},
+		{&b.validations, "|@"},
+	}
+	for _, list := range lists {
+		*list.dest, err = evalList(list.section)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Rule variables are expanded lazily in the scope of the build statement.
+	evaluating := make(map[string]bool)
+	var ruleLookup func(name string) (string, error)
+	ruleLookup = func(name string) (string, error) {
+		if value, ok := buildVars[name]; ok {
+			return value, nil
+		}
+
+		switch name {
+		case "in":
+			return shellJoin(b.inputs, " "), nil
+		case "in_newline":
+			return shellJoin(b.inputs, "\n"), nil
+		case "out":
+			return shellJoin(b.outputs, " "), nil
+		}
+
+		if r != nil {
+			if value, ok := r.variables[name]; ok {
+				if evaluating[name] {
+					return "", fmt.Errorf("cycle in rule variable %q", name)
+				}
+				evaluating[name] = true
+				defer delete(evaluating, name)
+				return value.eval(ruleLookup)
+			}
+		}
+
+		return s.lookupVariable(name), nil
+	}
+
+	for _, name := range reservedVariables {
+		value, err := ruleLookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			b.variables[name] = value
+		}
+	}
+
+	return b, nil
+}
+
+// shellJoin joins paths the way Ninja does when
+// expanding $in and $out, quoting the paths that
+// contain characters that are not known to be safe.
+func shellJoin(paths []string, sep string) string {
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		quoted[i] = path
+		for _, r := range path {
+			if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') &&
+				!(r >= '0' && r <= '9') && !strings.ContainsRune("_+-./", r) {
+				quoted[i] = "'" + strings.Replace(path, "'", `'\''`, -1) + "'"
+				break
+			}
+		}
+	}
+	return strings.Join(quoted, sep)
+}
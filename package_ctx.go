@@ -65,7 +65,15 @@ type PackageContext interface {
 
 	AddNinjaFileDeps(deps ...string)
 
+	// EnableRuleChecks enables warnings about likely
+	// mistakes in the rules defined by the package and
+	// in the build statements that use them, such as
+	// rule arguments that are never used or never set.
+	// The warnings are returned by Context.Warnings.
+	EnableRuleChecks()
+
 	getScope() *basicScope
+	ruleChecksEnabled() bool
 }
 
 type packageContext struct {
@@ -74,6 +82,7 @@ type packageContext struct {
 	pkgPath       string
 	scope         *basicScope
 	ninjaFileDeps []string
+	ruleChecks    bool
 }
 
 var _ PackageContext = &packageContext{}
@@ -916,6 +925,39 @@ func NewBuiltinRule(name string) Rule {
 	}
 }
 
+// rspfileRule is the variant of a package-scoped rule
+// that is used for build statements whose command is
+// too long, as described by RuleParams.RspfileCommand.
+type rspfileRule struct {
+	Rule
+	name_ string
+	def_  *ruleDef
+}
+
+func (r *rspfileRule) name() string {
+	return r.name_
+}
+
+func (r *rspfileRule) fullName(pkgNames map[*packageContext]string) string {
+	return packageNamespacePrefix(pkgNames[r.Rule.packageContext()]) + r.name_
+}
+
+func (r *rspfileRule) def(interface{}) (*ruleDef, error) {
+	return r.def_, nil
+}
+
+func (r *rspfileRule) String() string {
+	return r.Rule.packageContext().pkgPath + "." + r.name_
+}
+
 func (p *packageContext) AddNinjaFileDeps(deps ...string) {
 	p.ninjaFileDeps = append(p.ninjaFileDeps, deps...)
 }
+
+func (p *packageContext) EnableRuleChecks() {
+	p.ruleChecks = true
+}
+
+func (p *packageContext) ruleChecksEnabled() bool {
+	return p.ruleChecks
+}
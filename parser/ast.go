@@ -84,6 +84,7 @@ type Property struct {
 	NamePos  scanner.Position
 	ColonPos scanner.Position
 	Value    Expression
+	Replace  bool // The property was set with ":=" to replace the value it is extended onto.
 }
 
 func (p *Property) Copy() *Property {
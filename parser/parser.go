@@ -290,6 +290,7 @@ func (p *parser) parseProperty(isModule, compat bool) (property *Property) {
 	if isModule {
 		if compat && p.tok == ':' {
 			p.accept(':')
+			property.Replace = p.acceptReplace()
 		} else {
 			if !p.accept('=') {
 				return
@@ -299,6 +300,7 @@ func (p *parser) parseProperty(isModule, compat bool) (property *Property) {
 		if !p.accept(':') {
 			return
 		}
+		property.Replace = p.acceptReplace()
 	}
 
 	value := p.parseExpression()
@@ -311,6 +313,15 @@ func (p *parser) parseProperty(isModule, compat bool) (property *Property) {
 	return
 }
 
+// acceptReplace accepts the '=' of a ":=" following a
+// property name.
+func (p *parser) acceptReplace() bool {
+	if p.tok != '=' {
+		return false
+	}
+	return p.accept('=')
+}
+
 func (p *parser) parseExpression() (value Expression) {
 	value = p.parseValue()
 	switch p.tok {
@@ -348,7 +359,13 @@ func (p *parser) evaluateOperator(value1, value2 Expression, operator rune,
 				v.Value += e2.(*Int64).Value
 				v.Token = ""
 			case *List:
-				v.Values = append(v.Values, e2.(*List).Values...)
+				values2 := e2.(*List).Values
+				if len(v.Values) > 0 && len(values2) > 0 &&
+					v.Values[0].Type() != values2[0].Type() {
+					return nil, fmt.Errorf("mismatched list element type in operator %c: %s != %s",
+						operator, v.Values[0].Type(), values2[0].Type())
+				}
+				v.Values = append(v.Values, values2...)
 			case *Map:
 				var err error
 				v.Properties, err = p.addMaps(v.Properties, e2.(*Map).Properties, pos)
@@ -531,8 +548,9 @@ func (p *parser) parseListValue() *List {
 	var elements []Expression
 	for p.tok != ']' {
 		element := p.parseExpression()
-		if p.eval && element.Type() != StringType {
-			p.errorf("Expected string in list, found %s", element.Type().String())
+		if p.eval && len(elements) > 0 && element.Type() != elements[0].Type() {
+			p.errorf("Expected %s in list, found %s", elements[0].Type().String(),
+				element.Type().String())
 			return nil
 		}
 		elements = append(elements, element)
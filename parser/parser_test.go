@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseReplace(t *testing.T) {
+	input := `
+m {
+    srcs := ["a.c"],
+    cflags: ["-a"],
+    arch: {
+        arm := {
+            srcs: ["arm.c"],
+        },
+    },
+}
+`
+
+	file, errs := Parse("", bytes.NewBufferString(input), NewScope(nil))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	module := file.Defs[0].(*Module)
+	arch := module.Properties[2].Value.(*Map)
+	replaced := map[string]bool{
+		"srcs":          module.Properties[0].Replace,
+		"cflags":        module.Properties[1].Replace,
+		"arch":          module.Properties[2].Replace,
+		"arch.arm":      arch.Properties[0].Replace,
+		"arch.arm.srcs": arch.Properties[0].Value.(*Map).Properties[0].Replace,
+	}
+	expected := map[string]bool{
+		"srcs":          true,
+		"cflags":        false,
+		"arch":          false,
+		"arch.arm":      true,
+		"arch.arm.srcs": false,
+	}
+	for name, replace := range expected {
+		if replaced[name] != replace {
+			t.Errorf("expected Replace of %q to be %v", name, replace)
+		}
+	}
+
+	out, err := Print(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != input[1:] {
+		t.Errorf("incorrect output:\n  expected:\n%s\n  got:\n%s", input[1:], out)
+	}
+}
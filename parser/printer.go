@@ -172,7 +172,12 @@ func (p *printer) printOperator(operator *Operator) {
 
 func (p *printer) printProperty(property *Property) {
 	p.printToken(property.Name, property.NamePos)
-	p.printToken(":", property.ColonPos)
+	if property.Replace {
+		p.requestSpace()
+		p.printToken(":=", property.ColonPos)
+	} else {
+		p.printToken(":", property.ColonPos)
+	}
 	p.requestSpace()
 	p.printExpression(property.Value)
 }
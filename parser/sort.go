@@ -19,6 +19,10 @@ func SortLists(file *File) {
 }
 
 func SortList(file *File, list *List) {
+	if !isStringList(list) {
+		return
+	}
+
 	for i := 0; i < len(list.Values); i++ {
 		// Find a set of values on contiguous lines
 		line := list.Values[i].Pos().Line
@@ -40,6 +44,10 @@ func SortList(file *File, list *List) {
 }
 
 func ListIsSorted(list *List) bool {
+	if !isStringList(list) {
+		return true
+	}
+
 	for i := 0; i < len(list.Values); i++ {
 		// Find a set of values on contiguous lines
 		line := list.Values[i].Pos().Line
@@ -72,10 +80,27 @@ func sortListsInValue(value Expression, file *File) {
 			sortListsInValue(p.Value, file)
 		}
 	case *List:
-		SortList(file, v)
+		if isStringList(v) {
+			SortList(file, v)
+		} else {
+			for _, element := range v.Values {
+				sortListsInValue(element, file)
+			}
+		}
 	}
 }
 
+// isStringList returns true if every value in list is a
+// string literal.
+func isStringList(list *List) bool {
+	for _, v := range list.Values {
+		if _, ok := v.(*String); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func sortSubList(values []Expression, nextPos scanner.Position, file *File) {
 	l := make(elemList, len(values))
 	for i, v := range values {
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSortListsOfMaps(t *testing.T) {
+	input := `
+m {
+    srcs: [
+        "b.c",
+        "a.c",
+    ],
+    libs: [
+        {
+            name: "b",
+            srcs: [
+                "d.c",
+                "c.c",
+            ],
+        },
+        {
+            name: "a",
+        },
+    ],
+    ints: [
+        2,
+        1,
+    ],
+}
+`
+	expected := `m {
+    srcs: [
+        "a.c",
+        "b.c",
+    ],
+    libs: [
+        {
+            name: "b",
+            srcs: [
+                "c.c",
+                "d.c",
+            ],
+        },
+        {
+            name: "a",
+        },
+    ],
+    ints: [
+        2,
+        1,
+    ],
+}
+`
+
+	file, errs := Parse("", bytes.NewBufferString(input), NewScope(nil))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	SortLists(file)
+
+	out, err := Print(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("incorrect output:\n  expected:\n%s\n  got:\n%s", expected, out)
+	}
+
+	libs := file.Defs[0].(*Module).Properties[1].Value.(*List)
+	if !ListIsSorted(libs) {
+		t.Errorf("expected a list of maps to be treated as sorted")
+	}
+}
@@ -20,37 +20,40 @@ func CopyProperties(dstValue, srcValue reflect.Value) {
 			dstValue.Kind(), srcValue.Kind()))
 	}
 
-	for i, field := range typeFields(typ) {
-		if field.PkgPath != "" {
-			// The field is not exported so just skip it.
-			continue
-		}
-
-		srcFieldValue := srcValue.Field(i)
-		dstFieldValue := dstValue.Field(i)
+	plan := typePlan(typ)
+	src, dst := planValues{root: srcValue}, planValues{root: dstValue}
+	for i := range plan.fields {
+		f := &plan.fields[i]
+		srcFieldValue := src.field(f)
+		dstFieldValue := dst.field(f)
 		dstFieldInterfaceValue := reflect.Value{}
 		origDstFieldValue := dstFieldValue
 
-		switch srcFieldValue.Kind() {
-		case reflect.Bool, reflect.String, reflect.Int, reflect.Uint:
+		switch f.op {
+		case opStruct:
+			// The fields of the struct follow it in the plan.
+			continue
+		case opBasic, opInt:
 			dstFieldValue.Set(srcFieldValue)
-		case reflect.Struct:
-			CopyProperties(dstFieldValue, srcFieldValue)
-		case reflect.Slice:
+		case opList:
 			if !srcFieldValue.IsNil() {
-				if field.Type.Elem().Kind() != reflect.String {
-					panic(fmt.Errorf("can't copy field %q: slice elements are not strings", field.Name))
-				}
 				if srcFieldValue != dstFieldValue {
-					newSlice := reflect.MakeSlice(field.Type, srcFieldValue.Len(),
-						srcFieldValue.Len())
-					reflect.Copy(newSlice, srcFieldValue)
-					dstFieldValue.Set(newSlice)
+					dstFieldValue.Set(copyValue(f.name, srcFieldValue))
 				}
-			} else {
+			} else if !dstFieldValue.IsNil() {
 				dstFieldValue.Set(srcFieldValue)
 			}
-		case reflect.Interface:
+		case opPtrBasic:
+			if srcFieldValue.IsNil() {
+				if !dstFieldValue.IsNil() {
+					dstFieldValue.Set(srcFieldValue)
+				}
+				break
+			}
+			newValue := reflect.New(srcFieldValue.Type().Elem())
+			newValue.Elem().Set(srcFieldValue.Elem())
+			dstFieldValue.Set(newValue)
+		case opInterface:
 			if srcFieldValue.IsNil() {
 				dstFieldValue.Set(srcFieldValue)
 				break
@@ -60,11 +63,11 @@ func CopyProperties(dstValue, srcValue reflect.Value) {
 
 			if srcFieldValue.Kind() != reflect.Ptr {
 				panic(fmt.Errorf("can't clone field %q: interface refers to a non-pointer",
-					field.Name))
+					f.name))
 			}
 			if srcFieldValue.Type().Elem().Kind() != reflect.Struct {
 				panic(fmt.Errorf("can't clone field %q: interface points to a non-struct",
-					field.Name))
+					f.name))
 			}
 
 			if dstFieldValue.IsNil() || dstFieldValue.Elem().Type() != srcFieldValue.Type() {
@@ -78,58 +81,102 @@ func CopyProperties(dstValue, srcValue reflect.Value) {
 				dstFieldValue = dstFieldValue.Elem()
 			}
 			fallthrough
-		case reflect.Ptr:
+		case opPtrStruct:
 			if srcFieldValue.IsNil() {
-				origDstFieldValue.Set(srcFieldValue)
+				if !origDstFieldValue.IsNil() {
+					origDstFieldValue.Set(srcFieldValue)
+				}
 				break
 			}
 
-			srcFieldValue := srcFieldValue.Elem()
-
-			switch srcFieldValue.Kind() {
-			case reflect.Struct:
-				if !dstFieldValue.IsNil() {
-					// Re-use the existing allocation.
-					CopyProperties(dstFieldValue.Elem(), srcFieldValue)
-					break
+			if !dstFieldValue.IsNil() {
+				// Re-use the existing allocation.
+				CopyProperties(dstFieldValue.Elem(), srcFieldValue.Elem())
+			} else {
+				newValue := CloneProperties(srcFieldValue.Elem())
+				if dstFieldInterfaceValue.IsValid() {
+					dstFieldInterfaceValue.Set(newValue)
 				} else {
-					newValue := CloneProperties(srcFieldValue)
-					if dstFieldInterfaceValue.IsValid() {
-						dstFieldInterfaceValue.Set(newValue)
-					} else {
-						origDstFieldValue.Set(newValue)
-					}
+					origDstFieldValue.Set(newValue)
 				}
-			case reflect.Bool, reflect.Int64, reflect.String:
-				newValue := reflect.New(srcFieldValue.Type())
-				newValue.Elem().Set(srcFieldValue)
-				origDstFieldValue.Set(newValue)
-			default:
-				panic(fmt.Errorf("can't clone field %q: points to a %s",
-					field.Name, srcFieldValue.Kind()))
 			}
+		case opPtrOther:
+			if srcFieldValue.IsNil() {
+				dstFieldValue.Set(srcFieldValue)
+				break
+			}
+			panic(fmt.Errorf("can't clone field %q: points to a %s",
+				f.name, srcFieldValue.Elem().Kind()))
 		default:
 			panic(fmt.Errorf("unexpected kind for property struct field %q: %s",
-				field.Name, srcFieldValue.Kind()))
+				f.name, srcFieldValue.Kind()))
+		}
+	}
+}
+
+// copyValue returns a deep copy of the value of a slice
+// or map property, or of one of its elements.
+func copyValue(fieldName string, value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String:
+		return value
+	case reflect.Struct:
+		return CloneProperties(value).Elem()
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		switch value.Type().Elem().Kind() {
+		case reflect.Struct:
+			return CloneProperties(value.Elem())
+		case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String:
+			newValue := reflect.New(value.Type().Elem())
+			newValue.Elem().Set(value.Elem())
+			return newValue
+		}
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		newSlice := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		switch value.Type().Elem().Kind() {
+		case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String:
+			reflect.Copy(newSlice, value)
+		default:
+			for i := 0; i < value.Len(); i++ {
+				newSlice.Index(i).Set(copyValue(fieldName, value.Index(i)))
+			}
+		}
+		return newSlice
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		newMap := reflect.MakeMapWithSize(value.Type(), value.Len())
+		for _, key := range value.MapKeys() {
+			newMap.SetMapIndex(key, copyValue(fieldName, value.MapIndex(key)))
 		}
+		return newMap
 	}
+
+	panic(fmt.Errorf("can't copy field %q: contains a %s", fieldName, value.Type()))
 }
 
 func ZeroProperties(structValue reflect.Value) {
 	typ := structValue.Type()
 
-	for i, field := range typeFields(typ) {
-		if field.PkgPath != "" {
-			// The field is not exported so just skip it.
-			continue
-		}
-
-		fieldValue := structValue.Field(i)
+	plan := typePlan(typ)
+	values := planValues{root: structValue}
+	for i := range plan.fields {
+		f := &plan.fields[i]
+		fieldValue := values.field(f)
 
-		switch fieldValue.Kind() {
-		case reflect.Bool, reflect.String, reflect.Slice, reflect.Int, reflect.Uint:
+		switch f.op {
+		case opStruct:
+			// The fields of the struct follow it in the plan.
+		case opBasic, opInt, opList, opPtrBasic:
 			fieldValue.Set(reflect.Zero(fieldValue.Type()))
-		case reflect.Interface:
+		case opInterface:
 			if fieldValue.IsNil() {
 				break
 			}
@@ -139,31 +186,24 @@ func ZeroProperties(structValue reflect.Value) {
 			fieldValue = fieldValue.Elem()
 			if fieldValue.Kind() != reflect.Ptr {
 				panic(fmt.Errorf("can't zero field %q: interface refers to a non-pointer",
-					field.Name))
+					f.name))
 			}
 			if fieldValue.Type().Elem().Kind() != reflect.Struct {
 				panic(fmt.Errorf("can't zero field %q: interface points to a non-struct",
-					field.Name))
+					f.name))
 			}
 			fallthrough
-		case reflect.Ptr:
-			switch fieldValue.Type().Elem().Kind() {
-			case reflect.Struct:
-				if fieldValue.IsNil() {
-					break
-				}
-				ZeroProperties(fieldValue.Elem())
-			case reflect.Bool, reflect.Int64, reflect.String:
-				fieldValue.Set(reflect.Zero(fieldValue.Type()))
-			default:
-				panic(fmt.Errorf("can't zero field %q: points to a %s",
-					field.Name, fieldValue.Elem().Kind()))
+		case opPtrStruct:
+			if fieldValue.IsNil() {
+				break
 			}
-		case reflect.Struct:
-			ZeroProperties(fieldValue)
+			ZeroProperties(fieldValue.Elem())
+		case opPtrOther:
+			panic(fmt.Errorf("can't zero field %q: points to a %s",
+				f.name, fieldValue.Type().Elem().Kind()))
 		default:
 			panic(fmt.Errorf("unexpected kind for property struct field %q: %s",
-				field.Name, fieldValue.Kind()))
+				f.name, fieldValue.Kind()))
 		}
 	}
 }
@@ -176,63 +216,45 @@ func CloneEmptyProperties(structValue reflect.Value) reflect.Value {
 
 func cloneEmptyProperties(dstValue, srcValue reflect.Value) {
 	typ := srcValue.Type()
-	for i, field := range typeFields(typ) {
-		if field.PkgPath != "" {
-			// The field is not exported so just skip it.
-			continue
-		}
-
-		srcFieldValue := srcValue.Field(i)
-		dstFieldValue := dstValue.Field(i)
-		dstFieldInterfaceValue := reflect.Value{}
+	plan := typePlan(typ)
+	for i := range plan.fields {
+		f := &plan.fields[i]
 
-		switch srcFieldValue.Kind() {
-		case reflect.Bool, reflect.String, reflect.Slice, reflect.Int, reflect.Uint:
+		switch f.op {
+		case opStruct, opBasic, opInt, opList, opPtrBasic:
 			// Nothing
-		case reflect.Struct:
-			cloneEmptyProperties(dstFieldValue, srcFieldValue)
-		case reflect.Interface:
+		case opInterface, opPtrStruct:
+			// Only the few fields that point to structs are looked up, so
+			// the values of the nested structs aren't worth remembering.
+			srcFieldValue := srcValue.FieldByIndex(f.index)
 			if srcFieldValue.IsNil() {
 				break
 			}
 
-			srcFieldValue = srcFieldValue.Elem()
-			if srcFieldValue.Kind() != reflect.Ptr {
-				panic(fmt.Errorf("can't clone empty field %q: interface refers to a non-pointer",
-					field.Name))
-			}
-			if srcFieldValue.Type().Elem().Kind() != reflect.Struct {
-				panic(fmt.Errorf("can't clone empty field %q: interface points to a non-struct",
-					field.Name))
-			}
-
-			newValue := reflect.New(srcFieldValue.Type()).Elem()
-			dstFieldValue.Set(newValue)
-			dstFieldInterfaceValue = dstFieldValue
-			dstFieldValue = newValue
-			fallthrough
-		case reflect.Ptr:
-			switch srcFieldValue.Type().Elem().Kind() {
-			case reflect.Struct:
+			dstFieldValue := dstValue.FieldByIndex(f.index)
+			if f.op == opInterface {
+				srcFieldValue = srcFieldValue.Elem()
+				if srcFieldValue.Kind() != reflect.Ptr {
+					panic(fmt.Errorf("can't clone empty field %q: interface refers to a non-pointer",
+						f.name))
+				}
+				if srcFieldValue.Type().Elem().Kind() != reflect.Struct {
+					panic(fmt.Errorf("can't clone empty field %q: interface points to a non-struct",
+						f.name))
+				}
 				if srcFieldValue.IsNil() {
+					dstFieldValue.Set(reflect.Zero(srcFieldValue.Type()))
 					break
 				}
-				newValue := CloneEmptyProperties(srcFieldValue.Elem())
-				if dstFieldInterfaceValue.IsValid() {
-					dstFieldInterfaceValue.Set(newValue)
-				} else {
-					dstFieldValue.Set(newValue)
-				}
-			case reflect.Bool, reflect.Int64, reflect.String:
-				// Nothing
-			default:
-				panic(fmt.Errorf("can't clone empty field %q: points to a %s",
-					field.Name, srcFieldValue.Elem().Kind()))
 			}
 
+			dstFieldValue.Set(CloneEmptyProperties(srcFieldValue.Elem()))
+		case opPtrOther:
+			panic(fmt.Errorf("can't clone empty field %q: points to a %s",
+				f.name, f.field.Type.Elem().Kind()))
 		default:
 			panic(fmt.Errorf("unexpected kind for property struct field %q: %s",
-				field.Name, srcFieldValue.Kind()))
+				f.name, f.field.Type.Kind()))
 		}
 	}
 }
@@ -0,0 +1,65 @@
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type cloneTestElem struct {
+	Name *string
+	Srcs []string
+}
+
+type cloneTestProperties struct {
+	Elems    []cloneTestElem
+	Ptrs     []*cloneTestElem
+	Ints     []int64
+	Flags    map[string]string
+	Deps     map[string][]string
+	Variants map[string]*cloneTestElem
+}
+
+func newCloneTestProperties() *cloneTestProperties {
+	return &cloneTestProperties{
+		Elems:    []cloneTestElem{{Name: StringPtr("a"), Srcs: []string{"a.c"}}},
+		Ptrs:     []*cloneTestElem{{Name: StringPtr("b")}, nil},
+		Ints:     []int64{1, 2},
+		Flags:    map[string]string{"arm": "-march"},
+		Deps:     map[string][]string{"a": {"x"}},
+		Variants: map[string]*cloneTestElem{"v": {Srcs: []string{"v.c"}}},
+	}
+}
+
+func TestCopyPropertiesListsAndMaps(t *testing.T) {
+	src := newCloneTestProperties()
+	dst := &cloneTestProperties{}
+	CopyProperties(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+
+	if !reflect.DeepEqual(dst, newCloneTestProperties()) {
+		t.Fatalf("incorrect copy:\n  expected: %#v\n       got: %#v", newCloneTestProperties(), dst)
+	}
+
+	// Modifying the source must not modify the copy.
+	*src.Elems[0].Name = "changed"
+	src.Elems[0].Srcs[0] = "changed"
+	*src.Ptrs[0].Name = "changed"
+	src.Ints[0] = 3
+	src.Flags["arm"] = "changed"
+	src.Deps["a"][0] = "changed"
+	src.Variants["v"].Srcs[0] = "changed"
+	src.Variants["w"] = nil
+
+	if !reflect.DeepEqual(dst, newCloneTestProperties()) {
+		t.Errorf("copy shares values with the source:\n  expected: %#v\n       got: %#v",
+			newCloneTestProperties(), dst)
+	}
+}
+
+func TestZeroPropertiesListsAndMaps(t *testing.T) {
+	properties := newCloneTestProperties()
+	ZeroProperties(reflect.ValueOf(properties).Elem())
+
+	if !reflect.DeepEqual(properties, &cloneTestProperties{}) {
+		t.Errorf("expected zeroed properties, got %#v", properties)
+	}
+}
@@ -0,0 +1,211 @@
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PropertyDiff describes a property that has a
+// different value in two property structs.
+type PropertyDiff struct {
+	Property string // The dotted Blueprints name of the property.
+	Old      interface{}
+	New      interface{}
+}
+
+// String returns the property name and its old and new
+// values on a single line, using Blueprints syntax for
+// the values, for example:
+//
+//   cflags: ["-O2"] -> ["-O2", "-g"]
+func (d PropertyDiff) String() string {
+	oldValue := formatPropertyValue(reflect.ValueOf(d.Old))
+	newValue := formatPropertyValue(reflect.ValueOf(d.New))
+
+	// Interfaces can contain structs of different types that would look
+	// the same.
+	oldType, newType := reflect.TypeOf(d.Old), reflect.TypeOf(d.New)
+	if oldType != nil && newType != nil && oldType != newType {
+		oldValue = oldType.String() + oldValue
+		newValue = newType.String() + newValue
+	}
+
+	return fmt.Sprintf("%s: %s -> %s", d.Property, oldValue, newValue)
+}
+
+// FormatPropertyDiffs returns the String of each of
+// diffs on its own line.
+func FormatPropertyDiffs(diffs []PropertyDiff) string {
+	var s strings.Builder
+	for _, d := range diffs {
+		s.WriteString(d.String())
+		s.WriteByte('\n')
+	}
+	return s.String()
+}
+
+// DiffProperties returns the properties that have
+// different values in a and b, in the order of the
+// fields of the property structs. a and b must either
+// both be pointers to structs of the same type, or both
+// be slices of the same length containing pointers to
+// structs, such as the property structs of a module
+// before and after a mutator modifies a copy of them.
+//
+// The property structs are traversed the same way as
+// by CopyProperties and ExtendProperties: nested
+// structs, pointers to structs, and interfaces
+// containing pointers to structs are compared property
+// by property, with nil pointers to structs compared as
+// empty structs. An interface that contains a
+// different type in a and b is reported as a single
+// difference. Embedded structs do not add a component
+// to the names of their properties, as in Blueprints
+// files.
+func DiffProperties(a, b interface{}) ([]PropertyDiff, error) {
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	if aIsList != bIsList {
+		return nil, fmt.Errorf("expected matching types for a and b, got %T and %T", a, b)
+	}
+	if !aIsList {
+		aList, bList = []interface{}{a}, []interface{}{b}
+	}
+	if len(aList) != len(bList) {
+		return nil, fmt.Errorf("expected the same number of property structs, got %d and %d",
+			len(aList), len(bList))
+	}
+
+	var diffs []PropertyDiff
+	for i := range aList {
+		if aList[i] == nil || bList[i] == nil {
+			return nil, fmt.Errorf("expected pointer to struct, got %T and %T",
+				aList[i], bList[i])
+		}
+		aValue, bValue := reflect.ValueOf(aList[i]), reflect.ValueOf(bList[i])
+		if aValue.Type() != bValue.Type() {
+			return nil, fmt.Errorf("expected matching types for a and b, got %T and %T",
+				aList[i], bList[i])
+		}
+		if aValue.Kind() != reflect.Ptr || aValue.Type().Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("expected pointer to struct, got %T", aList[i])
+		}
+
+		diffs = diffPropertyValues("", "", aValue, bValue, diffs)
+	}
+
+	return diffs, nil
+}
+
+// diffPropertyValues appends the differences between
+// the values a and b of the property name to diffs.
+// prefix is prepended to the names of the properties
+// of a and b if they are structs.
+func diffPropertyValues(name, prefix string, a, b reflect.Value,
+	diffs []PropertyDiff) []PropertyDiff {
+
+	switch a.Kind() {
+	case reflect.Interface:
+		if a.IsNil() && b.IsNil() {
+			return diffs
+		}
+		if a.IsNil() || b.IsNil() || a.Elem().Type() != b.Elem().Type() {
+			return append(diffs, PropertyDiff{name, a.Interface(), b.Interface()})
+		}
+		return diffPropertyValues(name, prefix, a.Elem(), b.Elem(), diffs)
+
+	case reflect.Ptr:
+		if a.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+		if a.IsNil() && b.IsNil() {
+			return diffs
+		}
+		if a.IsNil() {
+			a = reflect.New(a.Type().Elem())
+		}
+		if b.IsNil() {
+			b = reflect.New(b.Type().Elem())
+		}
+		return diffPropertyValues(name, prefix, a.Elem(), b.Elem(), diffs)
+
+	case reflect.Struct:
+		for i, field := range typeFields(a.Type()) {
+			if field.PkgPath != "" {
+				// The field is not exported so just skip it.
+				continue
+			}
+
+			fieldName := prefix + PropertyNameForField(field.Name)
+			fieldPrefix := fieldName + "."
+			if field.Anonymous || field.Name == "BlueprintEmbed" {
+				fieldPrefix = prefix
+			}
+
+			diffs = diffPropertyValues(fieldName, fieldPrefix, a.Field(i), b.Field(i), diffs)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		diffs = append(diffs, PropertyDiff{name, a.Interface(), b.Interface()})
+	}
+	return diffs
+}
+
+// formatPropertyValue formats the value of a property
+// compactly using Blueprints syntax. Unset pointers,
+// slices and maps are formatted as "unset".
+func formatPropertyValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "unset"
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "unset"
+		}
+		return formatPropertyValue(v.Elem())
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			return "unset"
+		}
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = formatPropertyValue(v.Index(i))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case reflect.Map:
+		if v.IsNil() {
+			return "unset"
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		elems := make([]string, len(keys))
+		for i, key := range keys {
+			elems[i] = key.String() + ": " + formatPropertyValue(v.MapIndex(key))
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+	case reflect.Struct:
+		// Only list the properties that are set.
+		var elems []string
+		for i, field := range typeFields(v.Type()) {
+			if field.PkgPath != "" || isZeroPropertyValue(v.Field(i)) {
+				continue
+			}
+			elems = append(elems, PropertyNameForField(field.Name)+": "+
+				formatPropertyValue(v.Field(i)))
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func isZeroPropertyValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
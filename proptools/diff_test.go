@@ -0,0 +1,122 @@
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type DiffTestEmbedded struct {
+	Enabled *bool
+}
+
+type diffTestProperties struct {
+	DiffTestEmbedded
+	Name   *string
+	Cflags []string
+	Flags  map[string]string
+	Target *struct {
+		Android struct {
+			Cflags []string
+		}
+	}
+	Arch interface{}
+}
+
+type diffTestArm struct {
+	Srcs []string
+}
+
+type diffTestX86 struct {
+	Srcs []string
+}
+
+func TestDiffProperties(t *testing.T) {
+	a := &diffTestProperties{
+		Name:   StringPtr("a"),
+		Cflags: []string{"-O2"},
+		Arch:   &diffTestArm{Srcs: []string{"arm.c"}},
+	}
+	b := &diffTestProperties{
+		Name:   StringPtr("a"),
+		Cflags: []string{"-O2", "-g"},
+		Flags:  map[string]string{"b": "x", "a": "y"},
+		Arch:   &diffTestX86{Srcs: []string{"arm.c"}},
+	}
+	b.Enabled = BoolPtr(false)
+	b.Target = &struct {
+		Android struct {
+			Cflags []string
+		}
+	}{}
+	b.Target.Android.Cflags = []string{"-android"}
+
+	diffs, err := DiffProperties(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `enabled: unset -> false
+cflags: ["-O2"] -> ["-O2", "-g"]
+flags: unset -> {a: "y", b: "x"}
+target.android.cflags: unset -> ["-android"]
+arch: *proptools.diffTestArm{srcs: ["arm.c"]} -> *proptools.diffTestX86{srcs: ["arm.c"]}
+`
+	if got := FormatPropertyDiffs(diffs); got != expected {
+		t.Errorf("incorrect diffs:\n  expected:\n%s\n  got:\n%s", expected, got)
+	}
+
+	// Interfaces containing the same type are compared property by
+	// property.
+	b.Arch = &diffTestArm{Srcs: []string{"arm.c", "neon.c"}}
+	diffs, err = DiffProperties([]interface{}{a}, []interface{}{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := diffs[len(diffs)-1]; diff.Property != "arch.srcs" ||
+		!reflect.DeepEqual(diff.New, []string{"arm.c", "neon.c"}) {
+		t.Errorf("incorrect diff for arch.srcs: %#v", diff)
+	}
+
+	// A nil pointer to a struct is compared as an empty struct.
+	b.Target.Android.Cflags = nil
+	diffs, err = DiffProperties(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, diff := range diffs {
+		if diff.Property == "target.android.cflags" {
+			t.Errorf("expected an empty target not to differ from a nil one")
+		}
+	}
+
+	diffs, err = DiffProperties(a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got:\n%s", FormatPropertyDiffs(diffs))
+	}
+}
+
+func TestDiffPropertiesErrors(t *testing.T) {
+	a := &diffTestProperties{}
+	testCases := []struct {
+		name string
+		a, b interface{}
+	}{
+		{name: "list and struct", a: []interface{}{a}, b: a},
+		{name: "lengths", a: []interface{}{a}, b: []interface{}{a, a}},
+		{name: "types", a: a, b: &diffTestArm{}},
+		{name: "not a pointer", a: *a, b: *a},
+		{name: "nil", a: []interface{}{nil}, b: []interface{}{a}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := DiffProperties(testCase.a, testCase.b)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -23,13 +23,14 @@ import (
 //
 // The append operation is defined as appending strings
 // and slices of strings normally, OR-ing bool values,
-// replacing non-nil pointers to booleans or strings,
-// and recursing into embedded structs, pointers to
+// replacing non-nil pointers to booleans, integers or
+// strings and non-zero integers and Enum strings, and
+// recursing into embedded structs, pointers to
 // structs, and interfaces containing pointers to
 // structs. Appending the zero value of a property will
 // always be a no-op.
 func AppendProperties(dst interface{}, src interface{}, filter ExtendPropertyFilterFunc) error {
-	return extendProperties(dst, src, filter, orderAppend)
+	return extendProperties(dst, src, filter, Append, nil)
 }
 
 // PrependProperties prepends the values of properties
@@ -50,13 +51,14 @@ func AppendProperties(dst interface{}, src interface{}, filter ExtendPropertyFil
 //
 // The prepend operation is defined as prepending
 // strings, and slices of strings normally, OR-ing
-// bool values, replacing non-nil pointers to booleans
-// or strings, and recursing into embedded structs,
-// pointers to structs, and interfaces containing
-// pointers to structs.  Prepending the zero value of
-// a property will always be a no-op.
+// bool values, replacing non-nil pointers to
+// booleans, integers or strings and non-zero integers
+// and Enum strings, and recursing into embedded
+// structs, pointers to structs, and interfaces
+// containing pointers to structs. Prepending the zero
+// value of a property will always be a no-op.
 func PrependProperties(dst interface{}, src interface{}, filter ExtendPropertyFilterFunc) error {
-	return extendProperties(dst, src, filter, orderPrepend)
+	return extendProperties(dst, src, filter, Prepend, nil)
 }
 
 // AppendMatchingProperties appends the values of
@@ -80,14 +82,15 @@ func PrependProperties(dst interface{}, src interface{}, filter ExtendPropertyFi
 //
 // The append operation is defined as appending
 // strings, and slices of strings normally, OR-ing bool
-// values, replacing non-nil pointers to booleans or
+// values, replacing non-nil pointers to booleans,
+// integers or strings and non-zero integers and Enum
 // strings, and recursing into embedded structs,
 // pointers to structs, and interfaces containing
 // pointers to structs. Appending the zero value of a
 // property will always be a no-op.
 func AppendMatchingProperties(dst []interface{}, src interface{},
 	filter ExtendPropertyFilterFunc) error {
-	return extendMatchingProperties(dst, src, filter, orderAppend)
+	return extendMatchingProperties(dst, src, filter, Append, nil)
 }
 
 // PrependMatchingProperties prepends the values of
@@ -111,14 +114,15 @@ func AppendMatchingProperties(dst []interface{}, src interface{},
 //
 // The prepend operation is defined as prepending
 // strings, and slices of strings normally, OR-ing bool
-// values, replacing non-nil pointers to booleans or
+// values, replacing non-nil pointers to booleans,
+// integers or strings and non-zero integers and Enum
 // strings, and recursing into embedded structs,
 // pointers to structs, and interfaces containing
 // pointers to structs. Prepending the zero value of a
 // property will always be a no-op.
 func PrependMatchingProperties(dst []interface{}, src interface{},
 	filter ExtendPropertyFilterFunc) error {
-	return extendMatchingProperties(dst, src, filter, orderPrepend)
+	return extendMatchingProperties(dst, src, filter, Prepend, nil)
 }
 
 // ExtendProperties appends or prepends the values of
@@ -133,8 +137,11 @@ func PrependMatchingProperties(dst []interface{}, src interface{},
 // filter will append or prepend all properties.
 //
 // The order function is called on each non-filtered
-// property to determine if it should be appended or
-// prepended.
+// property to determine if it should be appended,
+// prepended or replaced. Properties whose fields are
+// tagged with `blueprint:"replace"` are always
+// replaced when appending, and when prepending are
+// only set if they haven't been already.
 //
 // An error returned by ExtendProperties that applies
 // to a specific property will be an
@@ -143,14 +150,15 @@ func PrependMatchingProperties(dst []interface{}, src interface{},
 //
 // The append operation is defined as appending strings
 // and slices of strings normally, OR-ing bool values,
-// replacing non-nil pointers to booleans or strings,
-// and recursing into embedded structs, pointers to
+// replacing non-nil pointers to booleans, integers or
+// strings and non-zero integers and Enum strings, and
+// recursing into embedded structs, pointers to
 // structs, and interfaces containing pointers to
-// structs. Appending or prepending the zero value of
-// a property will always be a no-op.
+// structs. Appending or prepending the zero value of a
+// property will always be a no-op.
 func ExtendProperties(dst interface{}, src interface{}, filter ExtendPropertyFilterFunc,
 	order ExtendPropertyOrderFunc) error {
-	return extendProperties(dst, src, filter, order)
+	return extendProperties(dst, src, filter, Append, order)
 }
 
 // ExtendMatchingProperties appends or prepends the
@@ -178,14 +186,15 @@ func ExtendProperties(dst interface{}, src interface{}, filter ExtendPropertyFil
 //
 // The append operation is defined as appending
 // strings, and slices of strings normally, OR-ing bool
-// values, replacing non-nil pointers to booleans or
+// values, replacing non-nil pointers to booleans,
+// integers or strings and non-zero integers and Enum
 // strings, and recursing into embedded structs,
 // pointers to structs, and interfaces containing
 // pointers to structs. Appending or prepending the
 // zero value of a property will always be a no-op.
 func ExtendMatchingProperties(dst []interface{}, src interface{},
 	filter ExtendPropertyFilterFunc, order ExtendPropertyOrderFunc) error {
-	return extendMatchingProperties(dst, src, filter, order)
+	return extendMatchingProperties(dst, src, filter, Append, order)
 }
 
 type Order int
@@ -193,6 +202,12 @@ type Order int
 const (
 	Append Order = iota
 	Prepend
+
+	// Replace replaces the original value of a property,
+	// unless the new value is the zero value. Slices and
+	// maps are replaced as a whole, so setting a list
+	// property to an empty list clears it.
+	Replace
 )
 
 type ExtendPropertyFilterFunc func(property string,
@@ -203,16 +218,27 @@ type ExtendPropertyOrderFunc func(property string,
 	dstField, srcField reflect.StructField,
 	dstValue, srcValue interface{}) (Order, error)
 
-func orderAppend(property string,
-	dstField, srcField reflect.StructField,
-	dstValue, srcValue interface{}) (Order, error) {
-	return Append, nil
-}
-
-func orderPrepend(property string,
-	dstField, srcField reflect.StructField,
-	dstValue, srcValue interface{}) (Order, error) {
-	return Prepend, nil
+// OrderReplacing returns an ExtendPropertyOrderFunc
+// that uses the Replace order for the properties for
+// which replaced returns true, for example those that
+// a module set with ":=" in its Blueprints file, and
+// the order returned by order for the other
+// properties. If order is nil the other properties
+// are appended.
+func OrderReplacing(replaced func(property string) bool,
+	order ExtendPropertyOrderFunc) ExtendPropertyOrderFunc {
+
+	return func(property string,
+		dstField, srcField reflect.StructField,
+		dstValue, srcValue interface{}) (Order, error) {
+		if replaced(property) {
+			return Replace, nil
+		}
+		if order == nil {
+			return Append, nil
+		}
+		return order(property, dstField, srcField, dstValue, srcValue)
+	}
 }
 
 type ExtendPropertyError struct {
@@ -232,7 +258,7 @@ func extendPropertyErrorf(property string, format string, a ...interface{}) *Ext
 }
 
 func extendProperties(dst interface{}, src interface{}, filter ExtendPropertyFilterFunc,
-	order ExtendPropertyOrderFunc) error {
+	order Order, orderFunc ExtendPropertyOrderFunc) error {
 
 	srcValue, err := getStruct(src)
 	if err != nil {
@@ -253,11 +279,11 @@ func extendProperties(dst interface{}, src interface{}, filter ExtendPropertyFil
 
 	dstValues := []reflect.Value{dstValue}
 
-	return extendPropertiesRecursive(dstValues, srcValue, "", filter, true, order)
+	return extendPropertiesRecursive(dstValues, srcValue, "", filter, true, order, orderFunc)
 }
 
 func extendMatchingProperties(dst []interface{}, src interface{}, filter ExtendPropertyFilterFunc,
-	order ExtendPropertyOrderFunc) error {
+	order Order, orderFunc ExtendPropertyOrderFunc) error {
 
 	srcValue, err := getStruct(src)
 	if err != nil {
@@ -276,28 +302,60 @@ func extendMatchingProperties(dst []interface{}, src interface{}, filter ExtendP
 		}
 	}
 
-	return extendPropertiesRecursive(dstValues, srcValue, "", filter, false, order)
+	return extendPropertiesRecursive(dstValues, srcValue, "", filter, false, order, orderFunc)
 }
 
+// extendPropertiesRecursive extends the property structs
+// dstValues with srcValue, using the order returned by
+// orderFunc, or defaultOrder if orderFunc is nil.
 func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value,
 	prefix string, filter ExtendPropertyFilterFunc, sameTypes bool,
-	orderFunc ExtendPropertyOrderFunc) error {
+	defaultOrder Order, orderFunc ExtendPropertyOrderFunc) error {
 
 	srcType := srcValue.Type()
-	for i, srcField := range typeFields(srcType) {
-		if srcField.PkgPath != "" {
-			// The field is not exported so just skip it.
+	plan := typePlan(srcType)
+	src := planValues{root: srcValue}
+
+	// The values of the destination structs of the same type as
+	// srcValue are looked up in the same order.
+	dsts := make([]planValues, len(dstValues))
+	for i, dstValue := range dstValues {
+		dsts[i].root = dstValue
+	}
+
+	for i := range plan.fields {
+		srcPlan := &plan.fields[i]
+		if srcPlan.op == opStruct {
+			// The fields of the struct follow it in the plan.
+			src.field(srcPlan)
+			found := false
+			for j, dstValue := range dstValues {
+				if dstValue.Type() == srcType {
+					dsts[j].field(srcPlan)
+					found = true
+				} else if _, dstPlan, nilInterface := lookupField(dstValue, srcPlan.name); dstPlan != nil ||
+					nilInterface != "" {
+					found = true
+				}
+			}
+			if !found && !srcPlan.mutated {
+				// Report the missing struct instead of each of its fields.
+				return extendPropertyErrorf(prefix+srcPlan.propertyName,
+					"failed to find property to extend")
+			}
 			continue
 		}
-		if HasTag(srcField, "blueprint", "mutated") {
+		if srcPlan.mutated {
 			continue
 		}
 
-		propertyName := prefix + PropertyNameForField(srcField.Name)
-		srcFieldValue := srcValue.Field(i)
+		srcField := srcPlan.field
+		propertyName := prefix + srcPlan.propertyName
+		srcFieldValue := src.field(srcPlan)
 
-		// Step into source interfaces
-		if srcFieldValue.Kind() == reflect.Interface {
+		switch srcPlan.op {
+		case opInterface:
+			// Step into source interfaces
 			if srcFieldValue.IsNil() {
 				continue
 			}
@@ -307,70 +365,85 @@ func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value
 			if srcFieldValue.Kind() != reflect.Ptr {
 				return extendPropertyErrorf(propertyName, "interface not a pointer")
 			}
-		}
-
-		// Step into source pointers to structs
-		if srcFieldValue.Kind() == reflect.Ptr && srcFieldValue.Type().Elem().Kind() == reflect.Struct {
+			switch op := fieldOpForType(srcFieldValue.Type()); op {
+			case opPtrStruct:
+				if srcFieldValue.IsNil() {
+					continue
+				}
+				srcFieldValue = srcFieldValue.Elem()
+			case opPtrOther:
+				return extendPropertyErrorf(propertyName, "pointer is a %s",
+					srcFieldValue.Type().Elem().Kind())
+			}
+		case opPtrStruct:
+			// Step into source pointers to structs
 			if srcFieldValue.IsNil() {
 				continue
 			}
 
 			srcFieldValue = srcFieldValue.Elem()
+		case opBasic, opList, opPtrBasic:
+			// Nothing
+		case opPtrOther:
+			return extendPropertyErrorf(propertyName, "pointer is a %s",
+				srcField.Type.Elem().Kind())
+		default:
+			return extendPropertyErrorf(propertyName, "unsupported kind %s",
+				srcField.Type.Kind())
 		}
 
 		found := false
 		var recurse []reflect.Value
-		for _, dstValue := range dstValues {
-			dstType := dstValue.Type()
-			var dstField reflect.StructField
-
-			dstFields := typeFields(dstType)
-			if dstType == srcType {
-				dstField = dstFields[i]
+		for j, dstValue := range dstValues {
+			dstPlan := srcPlan
+			var dstFieldValue reflect.Value
+			if dstValue.Type() == srcType {
+				dstFieldValue = dsts[j].field(srcPlan)
 			} else {
-				var ok bool
-				for _, field := range dstFields {
-					if field.Name == srcField.Name {
-						dstField = field
-						ok = true
-					}
+				var nilInterface string
+				dstFieldValue, dstPlan, nilInterface = lookupField(dstValue, srcPlan.name)
+				if nilInterface != "" {
+					return extendPropertyErrorf(propertyName, "nilitude mismatch")
 				}
-				if !ok {
+				if dstPlan == nil {
 					continue
 				}
 			}
 
 			found = true
 
-			dstFieldValue := dstValue.FieldByIndex(dstField.Index)
-			origDstFieldValue := dstFieldValue
+			dstField := dstPlan.field
 
-			// Step into destination interfaces
-			if dstFieldValue.Kind() == reflect.Interface {
-				if dstFieldValue.IsNil() {
-					return extendPropertyErrorf(propertyName, "nilitude mismatch")
-				}
+			if srcFieldValue.Kind() == reflect.Struct {
+				origDstFieldValue := dstFieldValue
+				switch dstPlan.op {
+				case opInterface:
+					// Step into destination interfaces
+					if dstFieldValue.IsNil() {
+						return extendPropertyErrorf(propertyName, "nilitude mismatch")
+					}
 
-				dstFieldValue = dstFieldValue.Elem()
+					dstFieldValue = dstFieldValue.Elem()
 
-				if dstFieldValue.Kind() != reflect.Ptr {
-					return extendPropertyErrorf(propertyName, "interface not a pointer")
-				}
-			}
+					if dstFieldValue.Kind() != reflect.Ptr {
+						return extendPropertyErrorf(propertyName, "interface not a pointer")
+					}
+					fallthrough
+				case opPtrStruct:
+					// Step into destination pointers to structs
+					if dstFieldValue.Kind() == reflect.Ptr && dstFieldValue.IsNil() {
+						// Set into origDstFieldValue in case it is an
+						// interface, in which case dstFieldValue is not
+						// settable.
+						dstFieldValue = reflect.New(dstFieldValue.Type().Elem())
+						origDstFieldValue.Set(dstFieldValue)
+					}
 
-			// Step into destination pointers to structs
-			if dstFieldValue.Kind() == reflect.Ptr && dstFieldValue.Type().Elem().Kind() == reflect.Struct {
-				if dstFieldValue.IsNil() {
-					dstFieldValue = reflect.New(dstFieldValue.Type().Elem())
-					origDstFieldValue.Set(dstFieldValue)
+					dstFieldValue = reflect.Indirect(dstFieldValue)
 				}
 
-				dstFieldValue = dstFieldValue.Elem()
-			}
-
-			switch srcFieldValue.Kind() {
-			case reflect.Struct:
-				if sameTypes && dstFieldValue.Type() != srcFieldValue.Type() {
+				if dstFieldValue.Kind() != reflect.Struct ||
+					sameTypes && dstFieldValue.Type() != srcFieldValue.Type() {
 					return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
 						dstFieldValue.Type(), srcFieldValue.Type())
 				}
@@ -378,33 +451,24 @@ func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value
 				// Recursively extend the struct's fields.
 				recurse = append(recurse, dstFieldValue)
 				continue
-			case reflect.Bool, reflect.String, reflect.Slice:
-				if srcFieldValue.Type() != dstFieldValue.Type() {
-					return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
-						dstFieldValue.Type(), srcFieldValue.Type())
-				}
-			case reflect.Ptr:
-				if srcFieldValue.Type() != dstFieldValue.Type() {
-					return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
-						dstFieldValue.Type(), srcFieldValue.Type())
-				}
-				switch ptrKind := srcFieldValue.Type().Elem().Kind(); ptrKind {
-				case reflect.Bool, reflect.Int64, reflect.String, reflect.Struct:
-				// Nothing
-				default:
-					return extendPropertyErrorf(propertyName, "pointer is a %s", ptrKind)
+			}
+
+			if dstPlan.op == opInterface {
+				// Step into destination interfaces
+				if dstFieldValue.IsNil() {
+					return extendPropertyErrorf(propertyName, "nilitude mismatch")
 				}
-			default:
-				return extendPropertyErrorf(propertyName, "unsupported kind %s",
-					srcFieldValue.Kind())
+				dstFieldValue = dstFieldValue.Elem()
 			}
 
-			dstFieldInterface := dstFieldValue.Interface()
-			srcFieldInterface := srcFieldValue.Interface()
+			if dstFieldValue.Type() != srcFieldValue.Type() {
+				return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
+					dstFieldValue.Type(), srcFieldValue.Type())
+			}
 
 			if filter != nil {
 				b, err := filter(propertyName, dstField, srcField,
-					dstFieldInterface, srcFieldInterface)
+					dstFieldValue.Interface(), srcFieldValue.Interface())
 				if err != nil {
 					return &ExtendPropertyError{
 						Property: propertyName,
@@ -416,11 +480,11 @@ func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value
 				}
 			}
 
-			order := Append
+			order := defaultOrder
 			if orderFunc != nil {
 				var err error
 				order, err = orderFunc(propertyName, dstField, srcField,
-					dstFieldInterface, srcFieldInterface)
+					dstFieldValue.Interface(), srcFieldValue.Interface())
 				if err != nil {
 					return &ExtendPropertyError{
 						Property: propertyName,
@@ -429,12 +493,22 @@ func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value
 				}
 			}
 
+			if dstPlan.replace || srcPlan.replace {
+				// Prepending a value to a property that is always replaced
+				// only sets it if it isn't already set, so that defaults
+				// don't replace the values they are prepended to.
+				if order == Prepend && !isZeroValue(dstFieldValue) {
+					continue
+				}
+				order = Replace
+			}
+
 			ExtendBasicType(dstFieldValue, srcFieldValue, order)
 		}
 
 		if len(recurse) > 0 {
 			err := extendPropertiesRecursive(recurse, srcFieldValue,
-				propertyName+".", filter, sameTypes, orderFunc)
+				propertyName+".", filter, sameTypes, defaultOrder, orderFunc)
 			if err != nil {
 				return err
 			}
@@ -446,15 +520,45 @@ func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value
 	return nil
 }
 
+// ExtendBasicType appends or prepends the value of a
+// property that is not a struct to another value of the
+// same type. Slices of any type are concatenated. Maps
+// are merged, with the entries of srcFieldValue
+// replacing those for the same keys in dstFieldValue
+// when appending, and being ignored when prepending.
+// Integers, strings of Enum types and pointers to basic
+// types are overridden: when appending srcFieldValue
+// replaces dstFieldValue, and when prepending it is only
+// used if dstFieldValue is not set. Integers and Enum
+// strings are considered to be set if they are not the
+// zero value. If order is Replace, srcFieldValue
+// replaces dstFieldValue unless it is the zero value.
 func ExtendBasicType(dstFieldValue, srcFieldValue reflect.Value, order Order) {
 	prepend := order == Prepend
 
+	if order == Replace {
+		if !isZeroValue(srcFieldValue) {
+			dstFieldValue.Set(copyValue("", srcFieldValue))
+		}
+		return
+	}
+
 	switch srcFieldValue.Kind() {
 	case reflect.Bool:
 		// Boolean OR
 		dstFieldValue.Set(reflect.ValueOf(srcFieldValue.Bool() || dstFieldValue.Bool()))
+	case reflect.Int32, reflect.Int64, reflect.Uint64:
+		if isZeroValue(srcFieldValue) || prepend && !isZeroValue(dstFieldValue) {
+			break
+		}
+		dstFieldValue.Set(srcFieldValue)
 	case reflect.String:
-		if prepend {
+		if _, ok := EnumValues(srcFieldValue.Type()); ok {
+			if isZeroValue(srcFieldValue) || prepend && !isZeroValue(dstFieldValue) {
+				break
+			}
+			dstFieldValue.Set(srcFieldValue)
+		} else if prepend {
 			dstFieldValue.SetString(srcFieldValue.String() +
 				dstFieldValue.String())
 		} else {
@@ -466,6 +570,14 @@ func ExtendBasicType(dstFieldValue, srcFieldValue reflect.Value, order Order) {
 			break
 		}
 
+		// Copy the elements of slices of structs and pointers so that they
+		// aren't shared with srcFieldValue.
+		switch srcFieldValue.Type().Elem().Kind() {
+		case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String:
+		default:
+			srcFieldValue = copyValue("", srcFieldValue)
+		}
+
 		newSlice := reflect.MakeSlice(srcFieldValue.Type(), 0,
 			dstFieldValue.Len()+srcFieldValue.Len())
 		if prepend {
@@ -476,47 +588,69 @@ func ExtendBasicType(dstFieldValue, srcFieldValue reflect.Value, order Order) {
 			newSlice = reflect.AppendSlice(newSlice, srcFieldValue)
 		}
 		dstFieldValue.Set(newSlice)
+	case reflect.Map:
+		if srcFieldValue.IsNil() {
+			break
+		}
+
+		// Always create a new map so that dstFieldValue doesn't share
+		// entries with srcFieldValue or the original dstFieldValue.
+		newMap := reflect.MakeMapWithSize(srcFieldValue.Type(),
+			dstFieldValue.Len()+srcFieldValue.Len())
+		srcFieldValue = copyValue("", srcFieldValue)
+		first, second := dstFieldValue, srcFieldValue
+		if prepend {
+			first, second = srcFieldValue, dstFieldValue
+		}
+		for _, m := range []reflect.Value{first, second} {
+			for _, key := range m.MapKeys() {
+				newMap.SetMapIndex(key, m.MapIndex(key))
+			}
+		}
+		dstFieldValue.Set(newMap)
 	case reflect.Ptr:
 		if srcFieldValue.IsNil() {
 			break
 		}
 
 		switch ptrKind := srcFieldValue.Type().Elem().Kind(); ptrKind {
-		case reflect.Bool:
-			if prepend {
-				if dstFieldValue.IsNil() {
-					dstFieldValue.Set(reflect.ValueOf(BoolPtr(srcFieldValue.Elem().Bool())))
-				}
-			} else {
-				// For append, replace the original value.
-				dstFieldValue.Set(reflect.ValueOf(BoolPtr(srcFieldValue.Elem().Bool())))
-			}
-		case reflect.Int64:
-			if prepend {
-				if dstFieldValue.IsNil() {
-					// Int() returns Int64
-					dstFieldValue.Set(reflect.ValueOf(Int64Ptr(srcFieldValue.Elem().Int())))
-				}
-			} else {
-				// For append, replace the original value.
-				// Int() returns Int64
-				dstFieldValue.Set(reflect.ValueOf(Int64Ptr(srcFieldValue.Elem().Int())))
-			}
-		case reflect.String:
-			if prepend {
-				if dstFieldValue.IsNil() {
-					dstFieldValue.Set(reflect.ValueOf(StringPtr(srcFieldValue.Elem().String())))
-				}
-			} else {
-				// For append, replace the original value.
-				dstFieldValue.Set(reflect.ValueOf(StringPtr(srcFieldValue.Elem().String())))
+		case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String:
+			if prepend && !dstFieldValue.IsNil() {
+				break
 			}
+			// For append, replace the original value. A new pointer is
+			// allocated, of the named type if there is one, so that the
+			// value isn't shared with srcFieldValue.
+			newValue := reflect.New(srcFieldValue.Type().Elem())
+			newValue.Elem().Set(srcFieldValue.Elem())
+			dstFieldValue.Set(newValue)
 		default:
 			panic(fmt.Errorf("unexpected pointer kind %s", ptrKind))
 		}
 	}
 }
 
+// isZeroValue returns true if value is the zero value
+// of a property that is not a struct. Empty slices and
+// maps that are not nil are not zero values, as they
+// are the result of explicitly setting a property to
+// an empty list or map.
+func isZeroValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint64:
+		return value.Uint() == 0
+	case reflect.String:
+		return value.String() == ""
+	case reflect.Slice, reflect.Map, reflect.Ptr:
+		return value.IsNil()
+	}
+	panic(fmt.Errorf("unexpected kind %s", value.Kind()))
+}
+
 type getStructEmptyError struct{}
 
 func (getStructEmptyError) Error() string { return "interface containing nil pointer" }
@@ -0,0 +1,281 @@
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtendListsAndMaps(t *testing.T) {
+	testCases := []struct {
+		name     string
+		order    Order
+		dst, src *cloneTestProperties
+		expected *cloneTestProperties
+	}{
+		{
+			name:  "append",
+			order: Append,
+			dst: &cloneTestProperties{
+				Elems: []cloneTestElem{{Name: StringPtr("a")}},
+				Ints:  []int64{1},
+				Flags: map[string]string{"a": "dst", "b": "dst"},
+			},
+			src: &cloneTestProperties{
+				Elems: []cloneTestElem{{Name: StringPtr("b")}},
+				Ints:  []int64{2},
+				Flags: map[string]string{"b": "src", "c": "src"},
+				Deps:  map[string][]string{"a": {"x"}},
+			},
+			expected: &cloneTestProperties{
+				Elems: []cloneTestElem{{Name: StringPtr("a")}, {Name: StringPtr("b")}},
+				Ints:  []int64{1, 2},
+				Flags: map[string]string{"a": "dst", "b": "src", "c": "src"},
+				Deps:  map[string][]string{"a": {"x"}},
+			},
+		},
+		{
+			name:  "prepend",
+			order: Prepend,
+			dst: &cloneTestProperties{
+				Elems: []cloneTestElem{{Name: StringPtr("a")}},
+				Ints:  []int64{1},
+				Flags: map[string]string{"a": "dst", "b": "dst"},
+			},
+			src: &cloneTestProperties{
+				Elems: []cloneTestElem{{Name: StringPtr("b")}},
+				Ints:  []int64{2},
+				Flags: map[string]string{"b": "src", "c": "src"},
+			},
+			expected: &cloneTestProperties{
+				Elems: []cloneTestElem{{Name: StringPtr("b")}, {Name: StringPtr("a")}},
+				Ints:  []int64{2, 1},
+				Flags: map[string]string{"a": "dst", "b": "dst", "c": "src"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := ExtendProperties(testCase.dst, testCase.src, nil, func(string,
+				reflect.StructField, reflect.StructField, interface{}, interface{}) (Order, error) {
+				return testCase.order, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(testCase.dst, testCase.expected) {
+				t.Errorf("incorrect result:\n  expected: %#v\n       got: %#v", testCase.expected,
+					testCase.dst)
+			}
+
+			// The result must not share elements with the source.
+			*testCase.src.Elems[0].Name = "changed"
+			for k := range testCase.src.Flags {
+				testCase.src.Flags[k] = "changed"
+			}
+			if !reflect.DeepEqual(testCase.dst, testCase.expected) {
+				t.Errorf("result shares values with the source: %#v", testCase.dst)
+			}
+		})
+	}
+}
+
+type replaceTestProperties struct {
+	Srcs   []string
+	Cflags []string `blueprint:"replace"`
+	Flags  map[string]string
+	Nested struct {
+		Srcs []string
+	}
+}
+
+// orderFunc returns an ExtendPropertyOrderFunc that
+// always returns order.
+func orderFunc(order Order) ExtendPropertyOrderFunc {
+	return func(string, reflect.StructField, reflect.StructField,
+		interface{}, interface{}) (Order, error) {
+		return order, nil
+	}
+}
+
+func TestExtendReplace(t *testing.T) {
+	newDst := func() *replaceTestProperties {
+		dst := &replaceTestProperties{
+			Srcs:   []string{"a.c"},
+			Cflags: []string{"-a"},
+			Flags:  map[string]string{"a": "dst"},
+		}
+		dst.Nested.Srcs = []string{"a.c"}
+		return dst
+	}
+	newSrc := func() *replaceTestProperties {
+		src := &replaceTestProperties{
+			Srcs:   []string{"b.c"},
+			Cflags: []string{"-b"},
+			Flags:  map[string]string{"b": "src"},
+		}
+		src.Nested.Srcs = []string{"b.c"}
+		return src
+	}
+
+	testCases := []struct {
+		name     string
+		src      *replaceTestProperties
+		order    ExtendPropertyOrderFunc
+		expected func(*replaceTestProperties)
+	}{
+		{
+			name:  "append",
+			src:   newSrc(),
+			order: orderFunc(Append),
+			expected: func(p *replaceTestProperties) {
+				p.Srcs = []string{"a.c", "b.c"}
+				p.Cflags = []string{"-b"}
+				p.Flags = map[string]string{"a": "dst", "b": "src"}
+				p.Nested.Srcs = []string{"a.c", "b.c"}
+			},
+		},
+		{
+			name:  "prepend",
+			src:   newSrc(),
+			order: orderFunc(Prepend),
+			expected: func(p *replaceTestProperties) {
+				p.Srcs = []string{"b.c", "a.c"}
+				p.Flags = map[string]string{"a": "dst", "b": "src"}
+				p.Nested.Srcs = []string{"b.c", "a.c"}
+			},
+		},
+		{
+			name:  "replace",
+			src:   newSrc(),
+			order: orderFunc(Replace),
+			expected: func(p *replaceTestProperties) {
+				p.Srcs = []string{"b.c"}
+				p.Cflags = []string{"-b"}
+				p.Flags = map[string]string{"b": "src"}
+				p.Nested.Srcs = []string{"b.c"}
+			},
+		},
+		{
+			name:  "replace with empty list",
+			src:   &replaceTestProperties{Srcs: []string{}},
+			order: orderFunc(Replace),
+			expected: func(p *replaceTestProperties) {
+				p.Srcs = []string{}
+			},
+		},
+		{
+			name: "order replacing",
+			src:  newSrc(),
+			order: OrderReplacing(func(property string) bool {
+				return property == "srcs" || property == "nested.srcs"
+			}, nil),
+			expected: func(p *replaceTestProperties) {
+				p.Srcs = []string{"b.c"}
+				p.Cflags = []string{"-b"}
+				p.Flags = map[string]string{"a": "dst", "b": "src"}
+				p.Nested.Srcs = []string{"b.c"}
+			},
+		},
+		{
+			name: "order replacing prepend",
+			src:  newSrc(),
+			order: OrderReplacing(func(property string) bool {
+				return property == "flags"
+			}, orderFunc(Prepend)),
+			expected: func(p *replaceTestProperties) {
+				p.Srcs = []string{"b.c", "a.c"}
+				p.Flags = map[string]string{"b": "src"}
+				p.Nested.Srcs = []string{"b.c", "a.c"}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dst := newDst()
+			expected := newDst()
+			testCase.expected(expected)
+
+			err := ExtendProperties(dst, testCase.src, nil, testCase.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst, expected) {
+				t.Errorf("incorrect result:\n  expected: %#v\n       got: %#v", expected, dst)
+			}
+		})
+	}
+}
+
+func TestExtendReplaceTagPrependsToZeroValue(t *testing.T) {
+	dst := &replaceTestProperties{}
+	src := &replaceTestProperties{Cflags: []string{"-b"}}
+
+	err := PrependProperties(dst, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(dst.Cflags, []string{"-b"}) {
+		t.Errorf("expected the unset replace property to be set, got %q", dst.Cflags)
+	}
+}
+
+func TestExtendBasicTypeIntegersAndEnums(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dst, src interface{}
+		order    Order
+		expected interface{}
+	}{
+		{name: "int32 append", dst: int32(1), src: int32(2), order: Append, expected: int32(2)},
+		{name: "int32 append zero", dst: int32(1), src: int32(0), order: Append, expected: int32(1)},
+		{name: "int64 prepend", dst: int64(1), src: int64(2), order: Prepend, expected: int64(1)},
+		{name: "int64 prepend unset", dst: int64(0), src: int64(2), order: Prepend, expected: int64(2)},
+		{name: "uint64 append", dst: uint64(1), src: uint64(2), order: Append, expected: uint64(2)},
+		{name: "uint64 replace zero", dst: uint64(1), src: uint64(0), order: Replace, expected: uint64(1)},
+		{name: "enum append", dst: testArch("arm"), src: testArch("x86"), order: Append,
+			expected: testArch("x86")},
+		{name: "enum prepend", dst: testArch("arm"), src: testArch("x86"), order: Prepend,
+			expected: testArch("arm")},
+		{name: "enum prepend unset", dst: testArch(""), src: testArch("x86"), order: Prepend,
+			expected: testArch("x86")},
+		{name: "string append", dst: testPlainString("a"), src: testPlainString("b"), order: Append,
+			expected: testPlainString("ab")},
+		{name: "*int32 append", dst: Int32Ptr(1), src: Int32Ptr(0), order: Append,
+			expected: Int32Ptr(0)},
+		{name: "*uint64 prepend", dst: Uint64Ptr(1), src: Uint64Ptr(2), order: Prepend,
+			expected: Uint64Ptr(1)},
+		{name: "*uint64 prepend unset", dst: (*uint64)(nil), src: Uint64Ptr(2), order: Prepend,
+			expected: Uint64Ptr(2)},
+		{name: "*enum append", dst: (*testArch)(nil), src: func() *testArch {
+			a := testArch("arm")
+			return &a
+		}(), order: Append, expected: func() *testArch {
+			a := testArch("arm")
+			return &a
+		}()},
+		{name: "[]uint64 append", dst: []uint64{1}, src: []uint64{2}, order: Append,
+			expected: []uint64{1, 2}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dst := reflect.New(reflect.TypeOf(testCase.dst)).Elem()
+			dst.Set(reflect.ValueOf(testCase.dst))
+			src := reflect.ValueOf(testCase.src)
+
+			ExtendBasicType(dst, src, testCase.order)
+
+			if !reflect.DeepEqual(dst.Interface(), testCase.expected) {
+				t.Errorf("expected %#v, got %#v", testCase.expected, dst.Interface())
+			}
+			if dst.Kind() == reflect.Ptr && !dst.IsNil() && dst.Pointer() == src.Pointer() {
+				t.Errorf("expected the pointer not to be shared with the source")
+			}
+		})
+	}
+}
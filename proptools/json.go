@@ -0,0 +1,377 @@
+package proptools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarshalProperties returns the properties that are
+// set in the property structs as a JSON object, using
+// the same names as in a Blueprints file. structs must
+// be pointers to structs.
+//
+// Fields are handled the same way as when a Blueprints
+// file is unpacked into the property structs: fields
+// tagged with `blueprint:"mutated"` are skipped, the
+// properties of embedded structs and BlueprintEmbed
+// fields are included in the object of the struct that
+// embeds them, nested structs, pointers to structs and
+// interfaces containing pointers to structs become
+// nested objects, and maps become objects.
+//
+// Properties that are not set, meaning nil pointers,
+// slices and maps, false bools, zero integers and empty
+// strings, are omitted. Pointers to bools, strings and
+// integers are included if they are not nil, even if
+// they point to the zero value. The objects of nested
+// structs that appear in more than one property struct
+// are merged, and any other property that appears in
+// more than one property struct is taken from the first
+// one that sets it.
+func MarshalProperties(structs ...interface{}) ([]byte, error) {
+	obj := make(map[string]interface{})
+	for _, s := range structs {
+		structValue, err := getStruct(s)
+		if err != nil {
+			if _, ok := err.(getStructEmptyError); ok {
+				continue
+			}
+			return nil, err
+		}
+		marshalPropertyStruct(obj, structValue)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(obj); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func marshalPropertyStruct(obj map[string]interface{}, structValue reflect.Value) {
+	for i, field := range typeFields(structValue.Type()) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+		if HasTag(field, "blueprint", "mutated") {
+			continue
+		}
+
+		fieldValue := structValue.Field(i)
+
+		if field.Anonymous || field.Name == "BlueprintEmbed" {
+			if embedded, ok := structFieldValue(fieldValue, false); ok {
+				marshalPropertyStruct(obj, embedded)
+				continue
+			}
+		}
+
+		name := PropertyNameForField(field.Name)
+
+		if nested, ok := structFieldValue(fieldValue, false); ok {
+			// Merge the properties of the nested struct into the
+			// object set by an earlier property struct, if any.
+			nestedObj, isObj := obj[name].(map[string]interface{})
+			if !isObj {
+				if _, exists := obj[name]; exists {
+					continue
+				}
+				nestedObj = make(map[string]interface{})
+			}
+			marshalPropertyStruct(nestedObj, nested)
+			if len(nestedObj) > 0 {
+				obj[name] = nestedObj
+			}
+			continue
+		}
+
+		if _, exists := obj[name]; exists {
+			continue
+		}
+		if value, ok := propertyToJSON(fieldValue, false); ok {
+			obj[name] = value
+		}
+	}
+}
+
+// propertyToJSON converts the value of a property to a
+// value that can be encoded as JSON. It returns false
+// if the property is not set, unless element is true
+// because the value is an element of a slice or map.
+func propertyToJSON(v reflect.Value, element bool) (interface{}, bool) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), v.Bool() || element
+	case reflect.String:
+		return v.String(), v.String() != "" || element
+	case reflect.Int32, reflect.Int64:
+		return v.Int(), v.Int() != 0 || element
+	case reflect.Uint64:
+		return v.Uint(), v.Uint() != 0 || element
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		return propertyToJSON(v.Elem(), element)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, false
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			return propertyToJSON(v.Elem(), element)
+		}
+		value, _ := propertyToJSON(v.Elem(), true)
+		return value, true
+	case reflect.Struct:
+		obj := make(map[string]interface{})
+		marshalPropertyStruct(obj, v)
+		return obj, len(obj) > 0 || element
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, false
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i], _ = propertyToJSON(v.Index(i), true)
+		}
+		return list, true
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, false
+		}
+		obj := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			obj[key.String()], _ = propertyToJSON(v.MapIndex(key), true)
+		}
+		return obj, true
+	}
+
+	panic(fmt.Errorf("unexpected kind %s", v.Kind()))
+}
+
+// UnmarshalProperties sets the properties in the
+// property structs from a JSON object in the format
+// returned by MarshalProperties. Like unpacking a
+// Blueprints file, each property is set in all of the
+// property structs that contain it, nil pointers to
+// structs are allocated as needed, and an error is
+// returned for properties that are not found in any of
+// the property structs or that are tagged with
+// `blueprint:"mutated"`. Unlike unpacking, values
+// replace the existing values of properties instead of
+// being appended to them, and a null value resets a
+// property to its zero value.
+func UnmarshalProperties(data []byte, structs ...interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return err
+	}
+
+	structValues := make([]reflect.Value, 0, len(structs))
+	for _, s := range structs {
+		structValue, err := getOrCreateStruct(s)
+		if err != nil {
+			return err
+		}
+		structValues = append(structValues, structValue)
+	}
+
+	return unmarshalPropertyStructs(structValues, obj, "")
+}
+
+func unmarshalPropertyStructs(structValues []reflect.Value, obj map[string]interface{},
+	prefix string) error {
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyName := prefix + name
+		data := obj[name]
+
+		found := false
+		var nested []reflect.Value
+		for _, structValue := range structValues {
+			fieldValue, field, ok := findPropertyField(structValue, FieldNameForProperty(name), true)
+			if !ok || HasTag(field, "blueprint", "mutated") {
+				continue
+			}
+			found = true
+
+			if data == nil {
+				fieldValue.Set(reflect.Zero(fieldValue.Type()))
+				continue
+			}
+
+			if nestedStruct, ok := structFieldValue(fieldValue, true); ok {
+				nested = append(nested, nestedStruct)
+				continue
+			} else if fieldValue.Kind() == reflect.Interface {
+				return fmt.Errorf("can't set property %q: interface is nil", propertyName)
+			}
+
+			value, err := jsonToProperty(fieldValue.Type(), data, propertyName)
+			if err != nil {
+				return err
+			}
+			fieldValue.Set(value)
+		}
+
+		if !found {
+			return fmt.Errorf("unrecognized property %q", propertyName)
+		}
+
+		if len(nested) > 0 {
+			nestedObj, ok := data.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("can't assign %s value to map property %q",
+					jsonTypeName(data), propertyName)
+			}
+			err := unmarshalPropertyStructs(nested, nestedObj, propertyName+".")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// jsonToProperty converts a decoded JSON value to a
+// value of type typ for the property name.
+func jsonToProperty(typ reflect.Type, data interface{}, name string) (reflect.Value, error) {
+	if data == nil {
+		return reflect.Zero(typ), nil
+	}
+
+	value := reflect.New(typ).Elem()
+
+	typeError := func(kind string) (reflect.Value, error) {
+		return value, fmt.Errorf("can't assign %s value to %s property %q",
+			jsonTypeName(data), kind, name)
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		elem, err := jsonToProperty(typ.Elem(), data, name)
+		if err != nil {
+			return value, err
+		}
+		value.Set(reflect.New(typ.Elem()))
+		value.Elem().Set(elem)
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return typeError("bool")
+		}
+		value.SetBool(b)
+
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return typeError("string")
+		}
+		if values, ok := EnumValues(typ); ok && !containsString(values, s) {
+			return value, fmt.Errorf("invalid value %q for property %q, expected one of %s",
+				s, name, strings.Join(values, ", "))
+		}
+		value.SetString(s)
+
+	case reflect.Int32, reflect.Int64, reflect.Uint64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return typeError(typ.Kind().String())
+		}
+		if typ.Kind() == reflect.Uint64 {
+			u, err := strconv.ParseUint(n.String(), 10, 64)
+			if err != nil {
+				return value, fmt.Errorf("invalid uint64 value %s for property %q", n, name)
+			}
+			value.SetUint(u)
+		} else {
+			i, err := n.Int64()
+			if err != nil || value.OverflowInt(i) {
+				return value, fmt.Errorf("invalid %s value %s for property %q", typ.Kind(), n, name)
+			}
+			value.SetInt(i)
+		}
+
+	case reflect.Slice:
+		list, ok := data.([]interface{})
+		if !ok {
+			return typeError("list")
+		}
+		value.Set(reflect.MakeSlice(typ, len(list), len(list)))
+		for i, elemData := range list {
+			elem, err := jsonToProperty(typ.Elem(), elemData, fmt.Sprintf("%s[%d]", name, i))
+			if err != nil {
+				return value, err
+			}
+			value.Index(i).Set(elem)
+		}
+
+	case reflect.Map:
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError("map")
+		}
+		value.Set(reflect.MakeMapWithSize(typ, len(obj)))
+		for key, elemData := range obj {
+			elem, err := jsonToProperty(typ.Elem(), elemData, name+"."+key)
+			if err != nil {
+				return value, err
+			}
+			keyValue := reflect.New(typ.Key()).Elem()
+			keyValue.SetString(key)
+			value.SetMapIndex(keyValue, elem)
+		}
+
+	case reflect.Struct:
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError("map")
+		}
+		err := unmarshalPropertyStructs([]reflect.Value{value}, obj, name+".")
+		if err != nil {
+			return value, err
+		}
+
+	default:
+		panic(fmt.Errorf("unexpected kind %s for property %q", typ.Kind(), name))
+	}
+
+	return value, nil
+}
+
+func jsonTypeName(data interface{}) string {
+	switch data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", data)
+}
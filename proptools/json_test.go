@@ -0,0 +1,293 @@
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type JSONTestEmbedded struct {
+	Enabled *bool
+}
+
+type jsonTestElem struct {
+	Name *string
+	Srcs []string
+}
+
+type jsonTestProperties struct {
+	JSONTestEmbedded
+	Name     string
+	Count    *int64
+	Cflags   []string
+	Static   bool
+	Mutated  []string `blueprint:"mutated"`
+	Flags    map[string]string
+	Elems    []jsonTestElem
+	Variants map[string]*jsonTestElem
+	Target   *struct {
+		Android struct {
+			Cflags []string
+		}
+	}
+	Arch interface{}
+}
+
+type jsonTestArch struct {
+	Arm struct {
+		Srcs []string
+	}
+}
+
+func TestMarshalProperties(t *testing.T) {
+	props := &jsonTestProperties{
+		Name:     "a",
+		Count:    Int64Ptr(0),
+		Cflags:   []string{"-a", ""},
+		Mutated:  []string{"x"},
+		Flags:    map[string]string{"b": "<x>", "a": ""},
+		Elems:    []jsonTestElem{{Name: StringPtr("e")}, {}},
+		Variants: map[string]*jsonTestElem{"v": {Srcs: []string{"v.c"}}},
+		Arch:     &jsonTestArch{},
+	}
+	props.Enabled = BoolPtr(false)
+	props.Arch.(*jsonTestArch).Arm.Srcs = []string{"arm.c"}
+	other := &struct {
+		Name   string
+		Target struct {
+			Host struct {
+				Cflags []string
+			}
+		}
+		Extra []string
+	}{Name: "b", Extra: []string{}}
+	other.Target.Host.Cflags = []string{"-host"}
+
+	data, err := MarshalProperties(props, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"arch":{"arm":{"srcs":["arm.c"]}},"cflags":["-a",""],"count":0,` +
+		`"elems":[{"name":"e"},{}],"enabled":false,"extra":[],"flags":{"a":"","b":"<x>"},` +
+		`"name":"a","target":{"host":{"cflags":["-host"]}},"variants":{"v":{"srcs":["v.c"]}}}`
+	if string(data) != expected {
+		t.Errorf("incorrect JSON:\n  expected: %s\n       got: %s", expected, data)
+	}
+}
+
+func TestUnmarshalProperties(t *testing.T) {
+	props := &jsonTestProperties{
+		Cflags: []string{"-old"},
+		Arch:   &jsonTestArch{},
+	}
+	props.Target = nil
+
+	data := []byte(`{
+		"name": "a",
+		"enabled": true,
+		"count": 3,
+		"cflags": ["-new"],
+		"flags": {"a": "x"},
+		"elems": [{"name": "e", "srcs": ["e.c"]}],
+		"variants": {"v": {"srcs": ["v.c"]}, "w": null},
+		"target": {"android": {"cflags": ["-android"]}},
+		"arch": {"arm": {"srcs": ["arm.c"]}}
+	}`)
+	other := &struct{ Cflags []string }{}
+	if err := UnmarshalProperties(data, props, other); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &jsonTestProperties{
+		Name:     "a",
+		Count:    Int64Ptr(3),
+		Cflags:   []string{"-new"},
+		Flags:    map[string]string{"a": "x"},
+		Elems:    []jsonTestElem{{Name: StringPtr("e"), Srcs: []string{"e.c"}}},
+		Variants: map[string]*jsonTestElem{"v": {Srcs: []string{"v.c"}}, "w": nil},
+		Arch:     &jsonTestArch{},
+	}
+	expected.Enabled = BoolPtr(true)
+	expected.Target = &struct {
+		Android struct {
+			Cflags []string
+		}
+	}{}
+	expected.Target.Android.Cflags = []string{"-android"}
+	expected.Arch.(*jsonTestArch).Arm.Srcs = []string{"arm.c"}
+	if !reflect.DeepEqual(props, expected) {
+		t.Errorf("incorrect result:\n  expected: %#v\n       got: %#v", expected, props)
+	}
+	if !reflect.DeepEqual(other.Cflags, []string{"-new"}) {
+		t.Errorf("expected cflags to be set in every struct, got %q", other.Cflags)
+	}
+
+	// null resets a property.
+	if err := UnmarshalProperties([]byte(`{"cflags": null, "target": null}`), props); err != nil {
+		t.Fatal(err)
+	}
+	if props.Cflags != nil || props.Target != nil {
+		t.Errorf("expected null to reset properties, got %q and %#v", props.Cflags, props.Target)
+	}
+}
+
+func TestMarshalPropertiesRoundTrip(t *testing.T) {
+	props := &jsonTestProperties{
+		Name:   "a",
+		Count:  Int64Ptr(-1),
+		Static: true,
+		Cflags: []string{"-a"},
+		Elems:  []jsonTestElem{{Srcs: []string{"a.c"}}},
+		Arch:   &jsonTestArch{},
+	}
+	props.Arch.(*jsonTestArch).Arm.Srcs = []string{"arm.c"}
+
+	data, err := MarshalProperties(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := &jsonTestProperties{Arch: &jsonTestArch{}}
+	if err := UnmarshalProperties(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, props) {
+		t.Errorf("incorrect round trip through %s:\n  expected: %#v\n       got: %#v", data,
+			props, got)
+	}
+}
+
+func TestUnmarshalPropertiesErrors(t *testing.T) {
+	testCases := []struct {
+		data string
+		err  string
+	}{
+		{
+			data: `{"missing": 1}`,
+			err:  `unrecognized property "missing"`,
+		},
+		{
+			data: `{"mutated": ["x"]}`,
+			err:  `unrecognized property "mutated"`,
+		},
+		{
+			data: `{"target": {"android": {"missing": 1}}}`,
+			err:  `unrecognized property "target.android.missing"`,
+		},
+		{
+			data: `{"name": 1}`,
+			err:  `can't assign number value to string property "name"`,
+		},
+		{
+			data: `{"count": 1.5}`,
+			err:  `invalid int64 value 1.5 for property "count"`,
+		},
+		{
+			data: `{"cflags": ["a", true]}`,
+			err:  `can't assign bool value to string property "cflags[1]"`,
+		},
+		{
+			data: `{"target": []}`,
+			err:  `can't assign list value to map property "target"`,
+		},
+		{
+			data: `{"arch": {"arm": {}}}`,
+			err:  `can't set property "arch": interface is nil`,
+		},
+		{
+			data: `[]`,
+			err:  `json: cannot unmarshal array into Go value of type map[string]interface {}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.data, func(t *testing.T) {
+			err := UnmarshalProperties([]byte(testCase.data), &jsonTestProperties{})
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("expected error %q, got %v", testCase.err, err)
+			}
+		})
+	}
+}
+
+type jsonTestIntegerProperties struct {
+	Small    int32
+	Size     *uint64
+	Arch     testArch
+	Arches   []testArch
+	Optional *testArch
+}
+
+func TestMarshalPropertiesIntegersAndEnums(t *testing.T) {
+	arch := testArch("arm")
+	props := &jsonTestIntegerProperties{
+		Small:    -3,
+		Size:     Uint64Ptr(0),
+		Arches:   []testArch{"x86"},
+		Optional: &arch,
+	}
+
+	data, err := MarshalProperties(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"arches":["x86"],"optional":"arm","size":0,"small":-3}`
+	if string(data) != expected {
+		t.Errorf("incorrect JSON:\n  expected: %s\n       got: %s", expected, data)
+	}
+
+	got := &jsonTestIntegerProperties{}
+	if err := UnmarshalProperties(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, props) {
+		t.Errorf("incorrect round trip through %s:\n  expected: %#v\n       got: %#v", data,
+			props, got)
+	}
+
+	got = &jsonTestIntegerProperties{}
+	err = UnmarshalProperties([]byte(`{"size": 18446744073709551615}`), got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Size == nil || *got.Size != 1<<64-1 {
+		t.Errorf("expected the largest uint64, got %v", got.Size)
+	}
+}
+
+func TestUnmarshalPropertiesIntegerAndEnumErrors(t *testing.T) {
+	testCases := []struct {
+		data string
+		err  string
+	}{
+		{
+			data: `{"small": 2147483648}`,
+			err:  `invalid int32 value 2147483648 for property "small"`,
+		},
+		{
+			data: `{"small": "1"}`,
+			err:  `can't assign string value to int32 property "small"`,
+		},
+		{
+			data: `{"size": -1}`,
+			err:  `invalid uint64 value -1 for property "size"`,
+		},
+		{
+			data: `{"arch": "mips"}`,
+			err:  `invalid value "mips" for property "arch", expected one of arm, x86`,
+		},
+		{
+			data: `{"arches": ["arm", "mips"]}`,
+			err:  `invalid value "mips" for property "arches[1]", expected one of arm, x86`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.data, func(t *testing.T) {
+			err := UnmarshalProperties([]byte(testCase.data), &jsonTestIntegerProperties{})
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("expected error %q, got %v", testCase.err, err)
+			}
+		})
+	}
+}
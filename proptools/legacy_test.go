@@ -0,0 +1,509 @@
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// This file contains the implementations of
+// CopyProperties, ZeroProperties, CloneEmptyProperties
+// and the extend functions from before they used
+// property plans, to check that the plans don't change
+// their results and to benchmark the plans against.
+
+func legacyCloneProperties(structValue reflect.Value) reflect.Value {
+	result := reflect.New(structValue.Type())
+	legacyCopyProperties(result.Elem(), structValue)
+	return result
+}
+
+func legacyCopyProperties(dstValue, srcValue reflect.Value) {
+	typ := dstValue.Type()
+	if srcValue.Type() != typ {
+		panic(fmt.Errorf("can't copy mismatching types (%s <- %s)",
+			dstValue.Kind(), srcValue.Kind()))
+	}
+
+	for i, field := range typeFields(typ) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+
+		srcFieldValue := srcValue.Field(i)
+		dstFieldValue := dstValue.Field(i)
+		dstFieldInterfaceValue := reflect.Value{}
+		origDstFieldValue := dstFieldValue
+
+		switch srcFieldValue.Kind() {
+		case reflect.Bool, reflect.String, reflect.Int, reflect.Uint:
+			dstFieldValue.Set(srcFieldValue)
+		case reflect.Struct:
+			legacyCopyProperties(dstFieldValue, srcFieldValue)
+		case reflect.Slice, reflect.Map:
+			if !srcFieldValue.IsNil() {
+				if srcFieldValue != dstFieldValue {
+					dstFieldValue.Set(legacyCopyValue(field.Name, srcFieldValue))
+				}
+			} else {
+				dstFieldValue.Set(srcFieldValue)
+			}
+		case reflect.Interface:
+			if srcFieldValue.IsNil() {
+				dstFieldValue.Set(srcFieldValue)
+				break
+			}
+
+			srcFieldValue = srcFieldValue.Elem()
+
+			if srcFieldValue.Kind() != reflect.Ptr {
+				panic(fmt.Errorf("can't clone field %q: interface refers to a non-pointer",
+					field.Name))
+			}
+			if srcFieldValue.Type().Elem().Kind() != reflect.Struct {
+				panic(fmt.Errorf("can't clone field %q: interface points to a non-struct",
+					field.Name))
+			}
+
+			if dstFieldValue.IsNil() || dstFieldValue.Elem().Type() != srcFieldValue.Type() {
+				// We can't use the existing destination allocation, so
+				// clone a new one.
+				newValue := reflect.New(srcFieldValue.Type()).Elem()
+				dstFieldValue.Set(newValue)
+				dstFieldInterfaceValue = dstFieldValue
+				dstFieldValue = newValue
+			} else {
+				dstFieldValue = dstFieldValue.Elem()
+			}
+			fallthrough
+		case reflect.Ptr:
+			if srcFieldValue.IsNil() {
+				origDstFieldValue.Set(srcFieldValue)
+				break
+			}
+
+			srcFieldValue := srcFieldValue.Elem()
+
+			switch srcFieldValue.Kind() {
+			case reflect.Struct:
+				if !dstFieldValue.IsNil() {
+					// Re-use the existing allocation.
+					legacyCopyProperties(dstFieldValue.Elem(), srcFieldValue)
+					break
+				} else {
+					newValue := legacyCloneProperties(srcFieldValue)
+					if dstFieldInterfaceValue.IsValid() {
+						dstFieldInterfaceValue.Set(newValue)
+					} else {
+						origDstFieldValue.Set(newValue)
+					}
+				}
+			case reflect.Bool, reflect.Int64, reflect.String:
+				newValue := reflect.New(srcFieldValue.Type())
+				newValue.Elem().Set(srcFieldValue)
+				origDstFieldValue.Set(newValue)
+			default:
+				panic(fmt.Errorf("can't clone field %q: points to a %s",
+					field.Name, srcFieldValue.Kind()))
+			}
+		default:
+			panic(fmt.Errorf("unexpected kind for property struct field %q: %s",
+				field.Name, srcFieldValue.Kind()))
+		}
+	}
+}
+
+// legacyCopyValue returns a deep copy of the value of a slice
+// or map property, or of one of its elements.
+func legacyCopyValue(fieldName string, value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Bool, reflect.Int64, reflect.String:
+		return value
+	case reflect.Struct:
+		return legacyCloneProperties(value).Elem()
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		switch value.Type().Elem().Kind() {
+		case reflect.Struct:
+			return legacyCloneProperties(value.Elem())
+		case reflect.Bool, reflect.Int64, reflect.String:
+			newValue := reflect.New(value.Type().Elem())
+			newValue.Elem().Set(value.Elem())
+			return newValue
+		}
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		newSlice := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		switch value.Type().Elem().Kind() {
+		case reflect.Bool, reflect.Int64, reflect.String:
+			reflect.Copy(newSlice, value)
+		default:
+			for i := 0; i < value.Len(); i++ {
+				newSlice.Index(i).Set(legacyCopyValue(fieldName, value.Index(i)))
+			}
+		}
+		return newSlice
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		newMap := reflect.MakeMapWithSize(value.Type(), value.Len())
+		for _, key := range value.MapKeys() {
+			newMap.SetMapIndex(key, legacyCopyValue(fieldName, value.MapIndex(key)))
+		}
+		return newMap
+	}
+
+	panic(fmt.Errorf("can't copy field %q: contains a %s", fieldName, value.Type()))
+}
+
+func legacyZeroProperties(structValue reflect.Value) {
+	typ := structValue.Type()
+
+	for i, field := range typeFields(typ) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+
+		fieldValue := structValue.Field(i)
+
+		switch fieldValue.Kind() {
+		case reflect.Bool, reflect.String, reflect.Slice, reflect.Map, reflect.Int, reflect.Uint:
+			fieldValue.Set(reflect.Zero(fieldValue.Type()))
+		case reflect.Interface:
+			if fieldValue.IsNil() {
+				break
+			}
+
+			// We leave the pointer intact and zero out the struct that's
+			// pointed to.
+			fieldValue = fieldValue.Elem()
+			if fieldValue.Kind() != reflect.Ptr {
+				panic(fmt.Errorf("can't zero field %q: interface refers to a non-pointer",
+					field.Name))
+			}
+			if fieldValue.Type().Elem().Kind() != reflect.Struct {
+				panic(fmt.Errorf("can't zero field %q: interface points to a non-struct",
+					field.Name))
+			}
+			fallthrough
+		case reflect.Ptr:
+			switch fieldValue.Type().Elem().Kind() {
+			case reflect.Struct:
+				if fieldValue.IsNil() {
+					break
+				}
+				legacyZeroProperties(fieldValue.Elem())
+			case reflect.Bool, reflect.Int64, reflect.String:
+				fieldValue.Set(reflect.Zero(fieldValue.Type()))
+			default:
+				panic(fmt.Errorf("can't zero field %q: points to a %s",
+					field.Name, fieldValue.Elem().Kind()))
+			}
+		case reflect.Struct:
+			legacyZeroProperties(fieldValue)
+		default:
+			panic(fmt.Errorf("unexpected kind for property struct field %q: %s",
+				field.Name, fieldValue.Kind()))
+		}
+	}
+}
+
+func legacyCloneEmptyProperties(structValue reflect.Value) reflect.Value {
+	result := reflect.New(structValue.Type())
+	legacyCloneEmpty(result.Elem(), structValue)
+	return result
+}
+
+func legacyCloneEmpty(dstValue, srcValue reflect.Value) {
+	typ := srcValue.Type()
+	for i, field := range typeFields(typ) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+
+		srcFieldValue := srcValue.Field(i)
+		dstFieldValue := dstValue.Field(i)
+		dstFieldInterfaceValue := reflect.Value{}
+
+		switch srcFieldValue.Kind() {
+		case reflect.Bool, reflect.String, reflect.Slice, reflect.Map, reflect.Int, reflect.Uint:
+			// Nothing
+		case reflect.Struct:
+			legacyCloneEmpty(dstFieldValue, srcFieldValue)
+		case reflect.Interface:
+			if srcFieldValue.IsNil() {
+				break
+			}
+
+			srcFieldValue = srcFieldValue.Elem()
+			if srcFieldValue.Kind() != reflect.Ptr {
+				panic(fmt.Errorf("can't clone empty field %q: interface refers to a non-pointer",
+					field.Name))
+			}
+			if srcFieldValue.Type().Elem().Kind() != reflect.Struct {
+				panic(fmt.Errorf("can't clone empty field %q: interface points to a non-struct",
+					field.Name))
+			}
+
+			newValue := reflect.New(srcFieldValue.Type()).Elem()
+			dstFieldValue.Set(newValue)
+			dstFieldInterfaceValue = dstFieldValue
+			dstFieldValue = newValue
+			fallthrough
+		case reflect.Ptr:
+			switch srcFieldValue.Type().Elem().Kind() {
+			case reflect.Struct:
+				if srcFieldValue.IsNil() {
+					break
+				}
+				newValue := legacyCloneEmptyProperties(srcFieldValue.Elem())
+				if dstFieldInterfaceValue.IsValid() {
+					dstFieldInterfaceValue.Set(newValue)
+				} else {
+					dstFieldValue.Set(newValue)
+				}
+			case reflect.Bool, reflect.Int64, reflect.String:
+				// Nothing
+			default:
+				panic(fmt.Errorf("can't clone empty field %q: points to a %s",
+					field.Name, srcFieldValue.Elem().Kind()))
+			}
+
+		default:
+			panic(fmt.Errorf("unexpected kind for property struct field %q: %s",
+				field.Name, srcFieldValue.Kind()))
+		}
+	}
+}
+
+func legacyExtendProperties(dst interface{}, src interface{}, filter ExtendPropertyFilterFunc,
+	order ExtendPropertyOrderFunc) error {
+
+	srcValue, err := getStruct(src)
+	if err != nil {
+		if _, ok := err.(getStructEmptyError); ok {
+			return nil
+		}
+		return err
+	}
+
+	dstValue, err := getOrCreateStruct(dst)
+	if err != nil {
+		return err
+	}
+
+	if dstValue.Type() != srcValue.Type() {
+		return fmt.Errorf("expected matching types for dst and src, got %T and %T", dst, src)
+	}
+
+	dstValues := []reflect.Value{dstValue}
+
+	return legacyExtendPropertiesRecursive(dstValues, srcValue, "", filter, true, order)
+}
+
+func legacyExtendMatchingProperties(dst []interface{}, src interface{}, filter ExtendPropertyFilterFunc,
+	order ExtendPropertyOrderFunc) error {
+
+	srcValue, err := getStruct(src)
+	if err != nil {
+		if _, ok := err.(getStructEmptyError); ok {
+			return nil
+		}
+		return err
+	}
+
+	dstValues := make([]reflect.Value, len(dst))
+	for i := range dst {
+		var err error
+		dstValues[i], err = getOrCreateStruct(dst[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return legacyExtendPropertiesRecursive(dstValues, srcValue, "", filter, false, order)
+}
+
+func legacyExtendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value,
+	prefix string, filter ExtendPropertyFilterFunc, sameTypes bool,
+	orderFunc ExtendPropertyOrderFunc) error {
+
+	srcType := srcValue.Type()
+	for i, srcField := range typeFields(srcType) {
+		if srcField.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+		if HasTag(srcField, "blueprint", "mutated") {
+			continue
+		}
+
+		propertyName := prefix + PropertyNameForField(srcField.Name)
+		srcFieldValue := srcValue.Field(i)
+
+		// Step into source interfaces
+		if srcFieldValue.Kind() == reflect.Interface {
+			if srcFieldValue.IsNil() {
+				continue
+			}
+
+			srcFieldValue = srcFieldValue.Elem()
+
+			if srcFieldValue.Kind() != reflect.Ptr {
+				return extendPropertyErrorf(propertyName, "interface not a pointer")
+			}
+		}
+
+		// Step into source pointers to structs
+		if srcFieldValue.Kind() == reflect.Ptr && srcFieldValue.Type().Elem().Kind() == reflect.Struct {
+			if srcFieldValue.IsNil() {
+				continue
+			}
+
+			srcFieldValue = srcFieldValue.Elem()
+		}
+
+		found := false
+		var recurse []reflect.Value
+		for _, dstValue := range dstValues {
+			dstType := dstValue.Type()
+			var dstField reflect.StructField
+
+			dstFields := typeFields(dstType)
+			if dstType == srcType {
+				dstField = dstFields[i]
+			} else {
+				var ok bool
+				for _, field := range dstFields {
+					if field.Name == srcField.Name {
+						dstField = field
+						ok = true
+					}
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			found = true
+
+			dstFieldValue := dstValue.FieldByIndex(dstField.Index)
+			origDstFieldValue := dstFieldValue
+
+			// Step into destination interfaces
+			if dstFieldValue.Kind() == reflect.Interface {
+				if dstFieldValue.IsNil() {
+					return extendPropertyErrorf(propertyName, "nilitude mismatch")
+				}
+
+				dstFieldValue = dstFieldValue.Elem()
+
+				if dstFieldValue.Kind() != reflect.Ptr {
+					return extendPropertyErrorf(propertyName, "interface not a pointer")
+				}
+			}
+
+			// Step into destination pointers to structs
+			if dstFieldValue.Kind() == reflect.Ptr && dstFieldValue.Type().Elem().Kind() == reflect.Struct {
+				if dstFieldValue.IsNil() {
+					dstFieldValue = reflect.New(dstFieldValue.Type().Elem())
+					origDstFieldValue.Set(dstFieldValue)
+				}
+
+				dstFieldValue = dstFieldValue.Elem()
+			}
+
+			switch srcFieldValue.Kind() {
+			case reflect.Struct:
+				if sameTypes && dstFieldValue.Type() != srcFieldValue.Type() {
+					return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
+						dstFieldValue.Type(), srcFieldValue.Type())
+				}
+
+				// Recursively extend the struct's fields.
+				recurse = append(recurse, dstFieldValue)
+				continue
+			case reflect.Bool, reflect.String, reflect.Slice, reflect.Map:
+				if srcFieldValue.Type() != dstFieldValue.Type() {
+					return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
+						dstFieldValue.Type(), srcFieldValue.Type())
+				}
+			case reflect.Ptr:
+				if srcFieldValue.Type() != dstFieldValue.Type() {
+					return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
+						dstFieldValue.Type(), srcFieldValue.Type())
+				}
+				switch ptrKind := srcFieldValue.Type().Elem().Kind(); ptrKind {
+				case reflect.Bool, reflect.Int64, reflect.String, reflect.Struct:
+				// Nothing
+				default:
+					return extendPropertyErrorf(propertyName, "pointer is a %s", ptrKind)
+				}
+			default:
+				return extendPropertyErrorf(propertyName, "unsupported kind %s",
+					srcFieldValue.Kind())
+			}
+
+			dstFieldInterface := dstFieldValue.Interface()
+			srcFieldInterface := srcFieldValue.Interface()
+
+			if filter != nil {
+				b, err := filter(propertyName, dstField, srcField,
+					dstFieldInterface, srcFieldInterface)
+				if err != nil {
+					return &ExtendPropertyError{
+						Property: propertyName,
+						Err:      err,
+					}
+				}
+				if !b {
+					continue
+				}
+			}
+
+			order := Append
+			if orderFunc != nil {
+				var err error
+				order, err = orderFunc(propertyName, dstField, srcField,
+					dstFieldInterface, srcFieldInterface)
+				if err != nil {
+					return &ExtendPropertyError{
+						Property: propertyName,
+						Err:      err,
+					}
+				}
+			}
+
+			if HasTag(dstField, "blueprint", "replace") || HasTag(srcField, "blueprint", "replace") {
+				// Prepending a value to a property that is always replaced
+				// only sets it if it isn't already set, so that defaults
+				// don't replace the values they are prepended to.
+				if order == Prepend && !isZeroValue(dstFieldValue) {
+					continue
+				}
+				order = Replace
+			}
+
+			ExtendBasicType(dstFieldValue, srcFieldValue, order)
+		}
+
+		if len(recurse) > 0 {
+			err := legacyExtendPropertiesRecursive(recurse, srcFieldValue,
+				propertyName+".", filter, sameTypes, orderFunc)
+			if err != nil {
+				return err
+			}
+		} else if !found {
+			return extendPropertyErrorf(propertyName, "failed to find property to extend")
+		}
+	}
+
+	return nil
+}
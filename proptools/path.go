@@ -0,0 +1,242 @@
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PropertyNotFoundError is returned by GetProperty and
+// SetProperty when none of the property structs contain
+// a property with the given name.
+type PropertyNotFoundError struct {
+	Property string
+}
+
+func (e *PropertyNotFoundError) Error() string {
+	return fmt.Sprintf("property %q not found", e.Property)
+}
+
+// PropertyTypeError is returned by SetProperty when the
+// value can't be assigned to the property.
+type PropertyTypeError struct {
+	Property  string
+	Type      reflect.Type // The type of the property.
+	ValueType reflect.Type // The type of the value, or nil for an untyped nil.
+}
+
+func (e *PropertyTypeError) Error() string {
+	return fmt.Sprintf("can't assign %v value to property %q of type %s",
+		e.ValueType, e.Property, e.Type)
+}
+
+// GetProperty returns the value of the property with
+// the given dotted Blueprints name, for example
+// "target.android.cflags", in the first of the property
+// structs that contains it. structs must contain
+// pointers to structs. Names are looked up the same way
+// as when unpacking a Blueprints file, stepping into
+// embedded structs, pointers to structs and interfaces
+// containing pointers to structs. If a struct that
+// contains the property is nil the zero value of the
+// property is returned.
+//
+// The returned value is not a copy, so slices and
+// pointers in it are shared with the property struct.
+// If no property struct contains the property a
+// *PropertyNotFoundError is returned.
+func GetProperty(structs []interface{}, name string) (interface{}, error) {
+	for _, s := range structs {
+		fieldValue, ok := propertyFieldValue(s, name, false)
+		if ok {
+			return fieldValue.Interface(), nil
+		}
+	}
+
+	return nil, &PropertyNotFoundError{Property: name}
+}
+
+// SetProperty sets the property with the given dotted
+// Blueprints name in each of the property structs that
+// contains it, allocating any nil pointers to structs
+// on the way to it. A value can also be set into a
+// pointer property by passing the value it should
+// point to.
+//
+// If no property struct contains the property a
+// *PropertyNotFoundError is returned, and if the value
+// can't be assigned to the property a
+// *PropertyTypeError is returned. No property struct
+// is modified if an error is returned.
+func SetProperty(structs []interface{}, name string, value interface{}) error {
+	// Find all the properties and check the value before allocating or
+	// setting any of them.
+	var found []interface{}
+	var values []reflect.Value
+	for _, s := range structs {
+		fieldValue, ok := propertyFieldValue(s, name, false)
+		if !ok {
+			continue
+		}
+
+		v, err := assignableValue(name, fieldValue.Type(), value)
+		if err != nil {
+			return err
+		}
+		found = append(found, s)
+		values = append(values, v)
+	}
+
+	if len(found) == 0 {
+		return &PropertyNotFoundError{Property: name}
+	}
+
+	for i, s := range found {
+		// Look the property up again, allocating any nil pointers to
+		// structs that contain it.
+		fieldValue, _ := propertyFieldValue(s, name, true)
+		fieldValue.Set(values[i])
+	}
+
+	return nil
+}
+
+// propertyFieldValue returns the field of the property
+// struct s for the property with the given dotted name.
+// If create is false, nil pointers to structs on the
+// way to the field are not allocated, and the zero value
+// of the field is returned instead.
+func propertyFieldValue(s interface{}, name string, create bool) (reflect.Value, bool) {
+	structValue := reflect.ValueOf(s)
+	if structValue.Kind() != reflect.Ptr || structValue.Type().Elem().Kind() != reflect.Struct {
+		panic(fmt.Errorf("expected pointer to struct, got %T", s))
+	}
+	structValue, ok := structFieldValue(structValue, create)
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		fieldValue, _, ok := findPropertyField(structValue, FieldNameForProperty(part), create)
+		if !ok {
+			return reflect.Value{}, false
+		}
+
+		if i == len(parts)-1 {
+			return fieldValue, true
+		}
+
+		structValue, ok = structFieldValue(fieldValue, create)
+		if !ok {
+			return reflect.Value{}, false
+		}
+	}
+
+	panic("unreachable")
+}
+
+// findPropertyField returns the field with the given
+// name in structValue or in the structs embedded in it.
+func findPropertyField(structValue reflect.Value, fieldName string,
+	create bool) (reflect.Value, reflect.StructField, bool) {
+
+	for i, field := range typeFields(structValue.Type()) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+
+		fieldValue := structValue.Field(i)
+
+		// Runtime-created structs can't have exported anonymous fields,
+		// so "BlueprintEmbed" is treated as one, as in unpackStructValue.
+		if field.Anonymous || field.Name == "BlueprintEmbed" {
+			if embedded, ok := structFieldValue(fieldValue, false); ok {
+				if found, foundField, ok := findPropertyField(embedded, fieldName, false); ok {
+					if create {
+						// Only allocate the embedded structs that contain
+						// the property.
+						embedded, _ = structFieldValue(fieldValue, true)
+						found, _, _ = findPropertyField(embedded, fieldName, true)
+					}
+					return found, foundField, true
+				}
+				continue
+			}
+		}
+
+		if field.Name == fieldName {
+			return fieldValue, field, true
+		}
+	}
+
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+// structFieldValue returns the struct that fieldValue
+// is, points to, or contains a pointer to. Nil pointers
+// are allocated if create is true, otherwise a zero
+// struct that is not part of the property struct is
+// returned.
+func structFieldValue(fieldValue reflect.Value, create bool) (reflect.Value, bool) {
+	origFieldValue := fieldValue
+
+	if fieldValue.Kind() == reflect.Interface {
+		if fieldValue.IsNil() {
+			return reflect.Value{}, false
+		}
+		fieldValue = fieldValue.Elem()
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Struct:
+		return fieldValue, true
+	case reflect.Ptr:
+		if fieldValue.Type().Elem().Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		if fieldValue.IsNil() {
+			newValue := reflect.New(fieldValue.Type().Elem())
+			if create {
+				// Set into origFieldValue in case it was an interface, in
+				// which case fieldValue is not settable.
+				origFieldValue.Set(newValue)
+			}
+			return newValue.Elem(), true
+		}
+		return fieldValue.Elem(), true
+	}
+
+	return reflect.Value{}, false
+}
+
+// assignableValue returns value as a reflect.Value that
+// can be assigned to a property of type typ.
+func assignableValue(name string, typ reflect.Type, value interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+
+	switch {
+	case !v.IsValid():
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return reflect.Zero(typ), nil
+		}
+	case v.Type().AssignableTo(typ):
+		return v, nil
+	case typ.Kind() == reflect.Ptr && v.Type().AssignableTo(typ.Elem()):
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	}
+
+	var valueType reflect.Type
+	if v.IsValid() {
+		valueType = v.Type()
+	}
+	return reflect.Value{}, &PropertyTypeError{
+		Property:  name,
+		Type:      typ,
+		ValueType: valueType,
+	}
+}
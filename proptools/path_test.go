@@ -0,0 +1,161 @@
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type PathTestEmbedded struct {
+	Enabled *bool
+}
+
+type pathTestProperties struct {
+	PathTestEmbedded
+	Name   *string
+	Cflags []string
+	Target struct {
+		Android *struct {
+			Cflags []string
+		}
+	}
+	Arch interface{}
+}
+
+type pathTestArch struct {
+	Arm struct {
+		Srcs []string
+	}
+}
+
+func TestGetProperty(t *testing.T) {
+	props := &pathTestProperties{
+		Name:   StringPtr("a"),
+		Cflags: []string{"-a"},
+		Arch:   &pathTestArch{},
+	}
+	props.Enabled = BoolPtr(true)
+	props.Arch.(*pathTestArch).Arm.Srcs = []string{"arm.c"}
+	other := &struct{ Other string }{Other: "b"}
+
+	testCases := []struct {
+		name     string
+		expected interface{}
+	}{
+		{name: "name", expected: StringPtr("a")},
+		{name: "cflags", expected: []string{"-a"}},
+		{name: "enabled", expected: BoolPtr(true)},
+		{name: "target.android.cflags", expected: []string(nil)},
+		{name: "arch.arm.srcs", expected: []string{"arm.c"}},
+		{name: "other", expected: "b"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			value, err := GetProperty([]interface{}{props, other}, testCase.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(value, testCase.expected) {
+				t.Errorf("expected %#v, got %#v", testCase.expected, value)
+			}
+		})
+	}
+
+	if props.Target.Android != nil {
+		t.Errorf("expected GetProperty not to allocate nil structs")
+	}
+
+	for _, name := range []string{"missing", "name.missing", "target.missing", "arch.x86.srcs"} {
+		_, err := GetProperty([]interface{}{props, other}, name)
+		if _, ok := err.(*PropertyNotFoundError); !ok {
+			t.Errorf("expected a *PropertyNotFoundError for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestSetProperty(t *testing.T) {
+	props := &pathTestProperties{}
+	other := &struct{ Cflags []string }{}
+	structs := []interface{}{props, other}
+
+	if err := SetProperty(structs, "cflags", []string{"-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(props.Cflags, []string{"-a"}) || !reflect.DeepEqual(other.Cflags, []string{"-a"}) {
+		t.Errorf("expected cflags to be set in both structs, got %q and %q", props.Cflags,
+			other.Cflags)
+	}
+
+	if err := SetProperty(structs, "name", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if props.Name == nil || *props.Name != "a" {
+		t.Errorf("expected name to be set through its pointer, got %v", props.Name)
+	}
+
+	if err := SetProperty(structs, "enabled", BoolPtr(false)); err != nil {
+		t.Fatal(err)
+	}
+	if props.Enabled == nil || *props.Enabled {
+		t.Errorf("expected the embedded enabled to be set, got %v", props.Enabled)
+	}
+
+	if err := SetProperty(structs, "target.android.cflags", []string{"-android"}); err != nil {
+		t.Fatal(err)
+	}
+	if props.Target.Android == nil || !reflect.DeepEqual(props.Target.Android.Cflags, []string{"-android"}) {
+		t.Errorf("expected target.android to be allocated and set, got %#v", props.Target.Android)
+	}
+
+	if err := SetProperty(structs, "cflags", nil); err != nil {
+		t.Fatal(err)
+	}
+	if props.Cflags != nil {
+		t.Errorf("expected nil to clear cflags, got %q", props.Cflags)
+	}
+
+	err := SetProperty(structs, "missing", "a")
+	if _, ok := err.(*PropertyNotFoundError); !ok {
+		t.Errorf("expected a *PropertyNotFoundError, got %v", err)
+	}
+
+	// A nil interface can't be stepped into.
+	err = SetProperty(structs, "arch.arm.srcs", []string{"arm.c"})
+	if _, ok := err.(*PropertyNotFoundError); !ok {
+		t.Errorf("expected a *PropertyNotFoundError, got %v", err)
+	}
+}
+
+func TestSetPropertyTypeError(t *testing.T) {
+	props := &pathTestProperties{}
+	other := &struct{ Cflags string }{}
+
+	err := SetProperty([]interface{}{props, other}, "cflags", []string{"-a"})
+	typeErr, ok := err.(*PropertyTypeError)
+	if !ok {
+		t.Fatalf("expected a *PropertyTypeError, got %v", err)
+	}
+	if typeErr.Property != "cflags" || typeErr.Type != reflect.TypeOf("") {
+		t.Errorf("incorrect error %#v", typeErr)
+	}
+	if props.Cflags != nil {
+		t.Errorf("expected no struct to be modified, got %q", props.Cflags)
+	}
+
+	err = SetProperty([]interface{}{props}, "target.android.cflags", 1)
+	if _, ok := err.(*PropertyTypeError); !ok {
+		t.Fatalf("expected a *PropertyTypeError, got %v", err)
+	}
+	if props.Target.Android != nil {
+		t.Errorf("expected target.android not to be allocated")
+	}
+
+	err = SetProperty([]interface{}{props}, "name", nil)
+	if err != nil {
+		t.Errorf("expected nil to be assignable to a pointer property, got %v", err)
+	}
+	err = SetProperty([]interface{}{other}, "cflags", nil)
+	if _, ok := err.(*PropertyTypeError); !ok {
+		t.Errorf("expected nil not to be assignable to a string property, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package proptools
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// propertyPlan describes the exported fields of a
+// property struct type. Nested structs that are not
+// behind a pointer or an interface are flattened into
+// the plan of the struct that contains them, so
+// CopyProperties, ZeroProperties, CloneEmptyProperties
+// and ExtendProperties can handle a property struct in
+// a single loop over precomputed field indices instead
+// of inspecting the fields and tags of every nested type
+// on every call, which matters when modules are cloned
+// for every variant. They only recurse into structs
+// behind pointers and interfaces, whose values are only
+// known at run time.
+type propertyPlan struct {
+	// The fields, with each nested struct followed by its fields.
+	fields []fieldPlan
+
+	// The fields by the names of their Go fields and of the nested
+	// structs containing them joined with ".", for example
+	// "Arch.Arm.Cflags".
+	byName map[string]*fieldPlan
+}
+
+// fieldOp is the operation used to handle a field,
+// precomputed from its kind and the kind it points to.
+type fieldOp int
+
+const (
+	opBasic     fieldOp = iota // A bool, string or integer property.
+	opInt                      // An int or uint, only allowed for mutated fields.
+	opList                     // A slice or map property.
+	opPtrBasic                 // A pointer to a bool, string or integer.
+	opPtrStruct                // A pointer to a struct.
+	opPtrOther                 // A pointer to an unsupported kind.
+	opInterface                // An interface containing a pointer to a struct.
+	opStruct                   // A nested struct, followed by its fields in the plan.
+	opInvalid                  // An unsupported kind.
+)
+
+type fieldPlan struct {
+	index        []int // The index sequence of the field from the planned struct.
+	field        reflect.StructField
+	op           fieldOp
+	name         string // The key of the field in propertyPlan.byName.
+	propertyName string // The name of the property relative to the planned struct.
+	mutated      bool   // The field or a struct containing it is tagged with `blueprint:"mutated"`.
+	replace      bool   // The field is tagged with `blueprint:"replace"`.
+}
+
+// Plans are cached the same way as the fields returned
+// by typeFields.
+type typePlanMap map[reflect.Type]*propertyPlan
+
+var (
+	// Stores an atomic pointer to map caching Type to its propertyPlan
+	typePlanCache atomic.Value
+	// Lock used by slow path updating the cache pointer
+	typePlanCacheWriterLock sync.Mutex
+)
+
+func init() {
+	typePlanCache.Store(make(typePlanMap))
+}
+
+// typePlan returns the plan for the struct type typ,
+// compiling it on first use.
+func typePlan(typ reflect.Type) *propertyPlan {
+	// Fast path
+	cache := typePlanCache.Load().(typePlanMap)
+	if plan, ok := cache[typ]; ok {
+		return plan
+	}
+
+	// Slow path
+	plan := compilePlan(typ)
+
+	typePlanCacheWriterLock.Lock()
+	defer typePlanCacheWriterLock.Unlock()
+
+	old := typePlanCache.Load().(typePlanMap)
+	cache = make(typePlanMap, len(old)+1)
+	for k, v := range old {
+		cache[k] = v
+	}
+
+	cache[typ] = plan
+
+	typePlanCache.Store(cache)
+
+	return plan
+}
+
+func compilePlan(typ reflect.Type) *propertyPlan {
+	plan := &propertyPlan{}
+	compileFields(plan, typ, nil, "", "", false)
+
+	plan.byName = make(map[string]*fieldPlan, len(plan.fields))
+	for i := range plan.fields {
+		plan.byName[plan.fields[i].name] = &plan.fields[i]
+	}
+
+	return plan
+}
+
+// compileFields adds the fields of the struct type typ,
+// found at the index sequence index in the planned
+// struct, to plan.
+func compileFields(plan *propertyPlan, typ reflect.Type, index []int,
+	namePrefix, propertyPrefix string, mutated bool) {
+
+	for i, field := range typeFields(typ) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+
+		f := fieldPlan{
+			index:        append(index[:len(index):len(index)], i),
+			field:        field,
+			op:           fieldOpForType(field.Type),
+			name:         namePrefix + field.Name,
+			propertyName: propertyPrefix + PropertyNameForField(field.Name),
+			mutated:      mutated || HasTag(field, "blueprint", "mutated"),
+			replace:      HasTag(field, "blueprint", "replace"),
+		}
+
+		plan.fields = append(plan.fields, f)
+
+		if f.op == opStruct {
+			compileFields(plan, field.Type, f.index, f.name+".", f.propertyName+".", f.mutated)
+		}
+	}
+}
+
+// maxPlanDepth is the depth of nested structs up to
+// which planValues remembers the values of the structs
+// containing the fields.
+const maxPlanDepth = 8
+
+// planValues looks up the values of the fields of a
+// struct in the order of the fields of its plan. The
+// values of the nested structs are remembered so that
+// each of their fields is only a single step away.
+type planValues struct {
+	root    reflect.Value
+	structs [maxPlanDepth]reflect.Value
+}
+
+// field returns the value of the field f. It must be
+// called for the fields of the plan in order, including
+// nested structs, unless the fields of a nested struct
+// are skipped entirely.
+func (p *planValues) field(f *fieldPlan) reflect.Value {
+	depth := len(f.index) - 1
+
+	var v reflect.Value
+	switch {
+	case depth == 0:
+		v = p.root.Field(f.index[0])
+	case depth <= maxPlanDepth:
+		v = p.structs[depth-1].Field(f.index[depth])
+	default:
+		v = p.root.FieldByIndex(f.index)
+	}
+
+	if f.op == opStruct && depth < maxPlanDepth {
+		p.structs[depth] = v
+	}
+
+	return v
+}
+
+func fieldOpForType(typ reflect.Type) fieldOp {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int32, reflect.Int64, reflect.Uint64:
+		return opBasic
+	case reflect.Int, reflect.Uint:
+		return opInt
+	case reflect.Slice, reflect.Map:
+		return opList
+	case reflect.Interface:
+		return opInterface
+	case reflect.Struct:
+		return opStruct
+	case reflect.Ptr:
+		switch typ.Elem().Kind() {
+		case reflect.Bool, reflect.String, reflect.Int32, reflect.Int64, reflect.Uint64:
+			return opPtrBasic
+		case reflect.Struct:
+			return opPtrStruct
+		}
+		return opPtrOther
+	}
+	return opInvalid
+}
+
+// lookupField returns the field of the struct
+// structValue with the given name, a key of
+// propertyPlan.byName. If the field is not in the plan
+// of structValue because it is behind a pointer or an
+// interface in it, they are stepped into, allocating
+// nil pointers to structs. nil is returned if there is
+// no field with the given name, and the name of the
+// interface is returned if it is nil.
+func lookupField(structValue reflect.Value, name string) (reflect.Value, *fieldPlan, string) {
+	plan := typePlan(structValue.Type())
+	if f := plan.byName[name]; f != nil {
+		return structValue.FieldByIndex(f.index), f, ""
+	}
+
+	for i := strings.IndexByte(name, '.'); i >= 0; i = nextDot(name, i) {
+		f := plan.byName[name[:i]]
+		if f == nil || f.op == opStruct {
+			continue
+		}
+
+		fieldValue := structValue.FieldByIndex(f.index)
+		switch f.op {
+		case opInterface:
+			if fieldValue.IsNil() {
+				return reflect.Value{}, nil, name[:i]
+			}
+			fieldValue = fieldValue.Elem()
+			if fieldValue.Kind() != reflect.Ptr || fieldValue.Type().Elem().Kind() != reflect.Struct {
+				return reflect.Value{}, nil, ""
+			}
+		case opPtrStruct:
+			if fieldValue.IsNil() {
+				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+			}
+		default:
+			return reflect.Value{}, nil, ""
+		}
+
+		return lookupField(fieldValue.Elem(), name[i+1:])
+	}
+
+	return reflect.Value{}, nil, ""
+}
+
+func nextDot(s string, i int) int {
+	j := strings.IndexByte(s[i+1:], '.')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
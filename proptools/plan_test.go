@@ -0,0 +1,385 @@
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type benchmarkLeafProperties struct {
+	Srcs    []string
+	Cflags  []string
+	Enabled *bool
+	Stem    *string
+	Static  struct {
+		Whole_static_libs []string
+		Shared_libs       []string
+	}
+}
+
+type benchmarkProperties struct {
+	Name string
+	benchmarkLeafProperties
+	Arch struct {
+		Arm, Arm64, X86, X86_64 benchmarkLeafProperties
+	}
+	Target struct {
+		Android, Host, Linux, Darwin, Windows benchmarkLeafProperties
+	}
+	Multilib struct {
+		Lib32, Lib64 benchmarkLeafProperties
+	}
+	Mutated_flag bool `blueprint:"mutated"`
+}
+
+func newBenchmarkProperties() *benchmarkProperties {
+	p := &benchmarkProperties{Name: "foo"}
+	p.Srcs = []string{"a.c", "b.c"}
+	p.Arch.Arm.Cflags = []string{"-marm"}
+	p.Arch.X86.Static.Shared_libs = []string{"libx86"}
+	p.Target.Android.Enabled = BoolPtr(true)
+	p.Multilib.Lib64.Stem = StringPtr("foo64")
+	return p
+}
+
+func BenchmarkCloneProperties(b *testing.B) {
+	src := reflect.ValueOf(newBenchmarkProperties()).Elem()
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			legacyCloneProperties(src)
+		}
+	})
+
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			CloneProperties(src)
+		}
+	})
+}
+
+func BenchmarkZeroProperties(b *testing.B) {
+	src := reflect.ValueOf(newBenchmarkProperties()).Elem()
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			legacyZeroProperties(legacyCloneProperties(src).Elem())
+		}
+	})
+
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ZeroProperties(legacyCloneProperties(src).Elem())
+		}
+	})
+}
+
+func BenchmarkCloneEmptyProperties(b *testing.B) {
+	src := reflect.ValueOf(newBenchmarkProperties()).Elem()
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			legacyCloneEmptyProperties(src)
+		}
+	})
+
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			CloneEmptyProperties(src)
+		}
+	})
+}
+
+func BenchmarkAppendProperties(b *testing.B) {
+	src := newBenchmarkProperties()
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dst := &benchmarkProperties{}
+			if err := legacyExtendProperties(dst, src, nil, orderFunc(Append)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dst := &benchmarkProperties{}
+			if err := AppendProperties(dst, src, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+type PlanTestEmbedded struct {
+	Embedded_srcs []string
+	Embedded_ptr  *bool
+}
+
+type planTestElem struct {
+	Name *string
+	Srcs []string
+}
+
+type planTestNested struct {
+	Cflags []string
+	Inner  struct {
+		Ldflags []string
+		Stem    *string
+	}
+}
+
+type planTestArch struct {
+	Arm, X86 planTestNested
+}
+
+type planTestProperties struct {
+	PlanTestEmbedded
+	Name          string
+	Enabled       *bool
+	Count         *int64
+	Nested        planTestNested
+	Ptr           *planTestNested
+	Nil_ptr       *planTestNested
+	Arch          interface{}
+	Flags         map[string]string
+	Deps          map[string][]string
+	Elems         []planTestElem
+	Elem_ptrs     []*planTestElem
+	Replaced      []string `blueprint:"replace"`
+	Mutated_count int      `blueprint:"mutated"`
+}
+
+// newPlanTestProperties returns property structs with
+// all their properties set to values containing v.
+func newPlanTestProperties(v string) *planTestProperties {
+	nested := func() planTestNested {
+		n := planTestNested{Cflags: []string{"-" + v}}
+		n.Inner.Ldflags = []string{"-l" + v}
+		n.Inner.Stem = StringPtr(v)
+		return n
+	}
+
+	p := &planTestProperties{
+		Name:          v,
+		Enabled:       BoolPtr(v == "a"),
+		Count:         Int64Ptr(int64(len(v))),
+		Nested:        nested(),
+		Arch:          &planTestArch{Arm: nested()},
+		Flags:         map[string]string{v: v, "common": v},
+		Deps:          map[string][]string{"common": {v}},
+		Elems:         []planTestElem{{Name: StringPtr(v), Srcs: []string{v + ".c"}}},
+		Elem_ptrs:     []*planTestElem{{Name: StringPtr(v)}, nil},
+		Replaced:      []string{v},
+		Mutated_count: len(v),
+	}
+	p.Embedded_srcs = []string{v + ".c"}
+	p.Embedded_ptr = BoolPtr(true)
+	ptr := nested()
+	p.Ptr = &ptr
+	return p
+}
+
+// newPlanTestDeepProperties returns property structs
+// with structs nested depth levels deep, deeper than
+// maxPlanDepth, each with a srcs property containing v.
+func newPlanTestDeepProperties(depth int, v string) interface{} {
+	typ := reflect.TypeOf(struct{ Srcs []string }{})
+	for i := 0; i < depth; i++ {
+		typ = reflect.StructOf([]reflect.StructField{
+			{Name: "Srcs", Type: reflect.TypeOf([]string{})},
+			{Name: "Stem", Type: reflect.TypeOf((*string)(nil))},
+			{Name: "Nested", Type: typ},
+		})
+	}
+
+	value := reflect.New(typ)
+	for s, i := value.Elem(), 0; ; s, i = s.FieldByName("Nested"), i+1 {
+		s.FieldByName("Srcs").Set(reflect.ValueOf([]string{fmt.Sprintf("%s%d.c", v, i)}))
+		if i == depth {
+			break
+		}
+		s.FieldByName("Stem").Set(reflect.ValueOf(StringPtr(v)))
+	}
+	return value.Interface()
+}
+
+// planTestInputs returns the property structs that the
+// implementations using plans are compared with the
+// legacy implementations on. Each call returns new
+// values so that they can be modified.
+func planTestInputs(v string) map[string]interface{} {
+	allNil := &planTestProperties{}
+	allNil.Arch = (*planTestArch)(nil)
+
+	emptyArch := newPlanTestProperties(v)
+	emptyArch.Arch = &planTestArch{}
+
+	return map[string]interface{}{
+		"all set":    newPlanTestProperties(v),
+		"nil":        allNil,
+		"empty arch": emptyArch,
+		"nil arch":   &planTestProperties{Name: v},
+		"deep":       newPlanTestDeepProperties(maxPlanDepth+3, v),
+	}
+}
+
+func TestPlanCopyPropertiesMatchesLegacy(t *testing.T) {
+	for name, src := range planTestInputs("a") {
+		t.Run(name, func(t *testing.T) {
+			srcValue := reflect.ValueOf(src).Elem()
+
+			expected := legacyCloneProperties(srcValue).Interface()
+			got := CloneProperties(srcValue).Interface()
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("CloneProperties:\n  expected: %#v\n       got: %#v", expected, got)
+			}
+
+			// Copy into values that already have pointers to structs
+			// and interfaces allocated, which are reused.
+			expectedDst := planTestInputs("b")[name]
+			gotDst := planTestInputs("b")[name]
+			legacyCopyProperties(reflect.ValueOf(expectedDst).Elem(), srcValue)
+			CopyProperties(reflect.ValueOf(gotDst).Elem(), srcValue)
+			if !reflect.DeepEqual(gotDst, expectedDst) {
+				t.Errorf("CopyProperties:\n  expected: %#v\n       got: %#v", expectedDst, gotDst)
+			}
+		})
+	}
+}
+
+func TestPlanCopyPropertiesReusesAllocations(t *testing.T) {
+	src := newPlanTestProperties("a")
+
+	dst := newPlanTestProperties("b")
+	ptr, arch := dst.Ptr, dst.Arch
+	CopyProperties(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+
+	legacyDst := newPlanTestProperties("b")
+	legacyPtr, legacyArch := legacyDst.Ptr, legacyDst.Arch
+	legacyCopyProperties(reflect.ValueOf(legacyDst).Elem(), reflect.ValueOf(src).Elem())
+
+	if (dst.Ptr == ptr) != (legacyDst.Ptr == legacyPtr) {
+		t.Errorf("expected the pointer to be reused as before: %v", legacyDst.Ptr == legacyPtr)
+	}
+	if (dst.Arch == arch) != (legacyDst.Arch == legacyArch) {
+		t.Errorf("expected the interface to be reused as before: %v", legacyDst.Arch == legacyArch)
+	}
+	if dst.Ptr == src.Ptr || dst.Arch == src.Arch {
+		t.Errorf("expected the copy not to share structs with the source")
+	}
+}
+
+func TestPlanZeroPropertiesMatchesLegacy(t *testing.T) {
+	expectedInputs := planTestInputs("a")
+	for name, got := range planTestInputs("a") {
+		t.Run(name, func(t *testing.T) {
+			expected := expectedInputs[name]
+			legacyZeroProperties(reflect.ValueOf(expected).Elem())
+			ZeroProperties(reflect.ValueOf(got).Elem())
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("ZeroProperties:\n  expected: %#v\n       got: %#v", expected, got)
+			}
+		})
+	}
+}
+
+func TestPlanCloneEmptyPropertiesMatchesLegacy(t *testing.T) {
+	for name, src := range planTestInputs("a") {
+		t.Run(name, func(t *testing.T) {
+			srcValue := reflect.ValueOf(src).Elem()
+			expected := legacyCloneEmptyProperties(srcValue).Interface()
+			got := CloneEmptyProperties(srcValue).Interface()
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("CloneEmptyProperties:\n  expected: %#v\n       got: %#v", expected, got)
+			}
+		})
+	}
+}
+
+func TestPlanExtendPropertiesMatchesLegacy(t *testing.T) {
+	filters := map[string]ExtendPropertyFilterFunc{
+		"no filter": nil,
+		"filter": func(property string, dstField, srcField reflect.StructField,
+			dstValue, srcValue interface{}) (bool, error) {
+			return property != "nested.cflags" && property != "arch.arm.inner.stem", nil
+		},
+	}
+
+	for _, order := range []Order{Append, Prepend, Replace} {
+		for filterName, filter := range filters {
+			for srcName := range planTestInputs("a") {
+				for dstName := range planTestInputs("b") {
+					if (srcName == "deep") != (dstName == "deep") {
+						continue
+					}
+					name := fmt.Sprintf("%d/%s/%s onto %s", order, filterName, srcName, dstName)
+					t.Run(name, func(t *testing.T) {
+						src := planTestInputs("a")[srcName]
+						expected, got := planTestInputs("b")[dstName], planTestInputs("b")[dstName]
+
+						expectedErr := legacyExtendProperties(expected, src, filter,
+							orderFunc(order))
+						gotErr := ExtendProperties(got, src, filter, orderFunc(order))
+
+						if fmt.Sprint(gotErr) != fmt.Sprint(expectedErr) {
+							t.Fatalf("incorrect error:\n  expected: %v\n       got: %v",
+								expectedErr, gotErr)
+						}
+						if !reflect.DeepEqual(got, expected) {
+							t.Errorf("ExtendProperties:\n  expected: %#v\n       got: %#v",
+								expected, got)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestPlanExtendMatchingPropertiesMatchesLegacy(t *testing.T) {
+	newDst := func() []interface{} {
+		other := &struct {
+			Name   string
+			Nested planTestNested
+			Flags  map[string]string
+			Arch   interface{}
+		}{Name: "c", Arch: &planTestArch{}}
+		other.Nested.Cflags = []string{"-c"}
+		return []interface{}{newPlanTestProperties("b"), other}
+	}
+
+	for _, order := range []Order{Append, Prepend, Replace} {
+		t.Run(fmt.Sprint(order), func(t *testing.T) {
+			expected, got := newDst(), newDst()
+			expectedErr := legacyExtendMatchingProperties(expected, newPlanTestProperties("a"), nil,
+				orderFunc(order))
+			gotErr := ExtendMatchingProperties(got, newPlanTestProperties("a"), nil, orderFunc(order))
+
+			if fmt.Sprint(gotErr) != fmt.Sprint(expectedErr) {
+				t.Fatalf("incorrect error:\n  expected: %v\n       got: %v", expectedErr, gotErr)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("ExtendMatchingProperties:\n  expected: %#v\n       got: %#v", expected, got)
+			}
+		})
+	}
+
+	// A property that isn't in any of the destination structs.
+	dst := []interface{}{&struct{ Name string }{}}
+	expectedErr := legacyExtendMatchingProperties(dst, newPlanTestProperties("a"), nil,
+		orderFunc(Append))
+	gotErr := ExtendMatchingProperties(dst, newPlanTestProperties("a"), nil, orderFunc(Append))
+	if gotErr == nil || fmt.Sprint(gotErr) != fmt.Sprint(expectedErr) {
+		t.Errorf("incorrect error:\n  expected: %v\n       got: %v", expectedErr, gotErr)
+	}
+}
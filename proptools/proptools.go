@@ -36,6 +36,44 @@ func HasTag(field reflect.StructField, name, value string) bool {
 	return false
 }
 
+// Enum is implemented by named string types whose
+// property values are limited to a fixed set, for
+// example:
+//
+//   type Arch string
+//
+//   func (Arch) Enum() []string {
+//       return []string{"arm", "arm64", "x86", "x86_64"}
+//   }
+//
+// Values in Blueprints files that are not returned by
+// Enum are rejected when properties are unpacked, and
+// extending an Enum property replaces its value instead
+// of concatenating the strings.
+type Enum interface {
+	Enum() []string
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// EnumValues returns the values allowed for typ if it
+// is a string type that implements Enum.
+func EnumValues(typ reflect.Type) ([]string, bool) {
+	if typ.Kind() != reflect.String || !typ.Implements(enumType) {
+		return nil, false
+	}
+	return reflect.Zero(typ).Interface().(Enum).Enum(), true
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 // BoolPtr returns a pointer to a new bool containing
 // the given value.
 func BoolPtr(b bool) *bool {
@@ -49,6 +87,18 @@ func Int64Ptr(i int64) *int64 {
 	return &(b)
 }
 
+// Int32Ptr returns a pointer to a new int32 containing
+// the given value.
+func Int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// Uint64Ptr returns a pointer to a new uint64
+// containing the given value.
+func Uint64Ptr(i uint64) *uint64 {
+	return &i
+}
+
 // StringPtr returns a pointer to a new string
 // containing the given value.
 func StringPtr(s string) *string {
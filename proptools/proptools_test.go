@@ -0,0 +1,32 @@
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testArch string
+
+func (testArch) Enum() []string {
+	return []string{"arm", "x86"}
+}
+
+type testPlainString string
+
+func TestEnumValues(t *testing.T) {
+	values, ok := EnumValues(reflect.TypeOf(testArch("")))
+	if !ok || !reflect.DeepEqual(values, []string{"arm", "x86"}) {
+		t.Errorf("expected the values of testArch, got %q, %v", values, ok)
+	}
+
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(""),
+		reflect.TypeOf(testPlainString("")),
+		reflect.TypeOf((*testArch)(nil)),
+		reflect.TypeOf([]testArch(nil)),
+	} {
+		if values, ok := EnumValues(typ); ok {
+			t.Errorf("expected %s not to be an Enum, got %q", typ, values)
+		}
+	}
+}
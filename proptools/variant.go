@@ -0,0 +1,234 @@
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// VariantPropertiesType returns a struct type for
+// properties that can be set differently for each of
+// the given variants, for example in an
+// `arch: { arm: {...}, x86: {...} }` block. The struct
+// has a field for each variant, named after it, whose
+// type contains only the fields of propertiesType, a
+// property struct type or a pointer to one, that are
+// tagged with `blueprint:"variant"` or
+// `blueprint:"variant_prepend"`, along with the nested
+// structs that contain them. All the fields of a nested
+// struct that is tagged are included. Embedded structs
+// are flattened into the struct that embeds them, so a
+// property that is defined by several of them with the
+// same type is only included once. nil is returned if
+// there are no tagged fields, and an error is returned
+// if two of the included fields or two of the variants
+// have the same name but different types.
+//
+// A module can add a pointer to a new value of the
+// returned type to its property structs through an
+// interface{} field, and call SquashVariantProperties
+// or the SquashVariantProperties method of a mutator
+// context to apply the properties of its variant.
+func VariantPropertiesType(propertiesType reflect.Type, variants []string) (reflect.Type, error) {
+	if propertiesType.Kind() == reflect.Ptr {
+		propertiesType = propertiesType.Elem()
+	}
+	if propertiesType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected struct type, got %s", propertiesType)
+	}
+
+	filtered, err := variantPropertiesStruct(propertiesType, false, "")
+	if filtered == nil || err != nil {
+		return nil, err
+	}
+
+	fields := make([]reflect.StructField, 0, len(variants))
+	names := make(map[string]bool)
+	for _, variant := range variants {
+		name := FieldNameForProperty(variant)
+		if names[name] {
+			return nil, fmt.Errorf("variant %q is defined more than once", variant)
+		}
+		names[name] = true
+
+		fields = append(fields, reflect.StructField{
+			Name: name,
+			Type: filtered,
+		})
+	}
+
+	return reflect.StructOf(fields), nil
+}
+
+// variantPropertiesStruct returns a struct type with
+// the variant fields of typ, or all of its fields if
+// all is true. prefix is prepended to the names of the
+// properties in errors.
+func variantPropertiesStruct(typ reflect.Type, all bool,
+	prefix string) (reflect.Type, error) {
+
+	var fields []reflect.StructField
+	fieldIndex := make(map[string]int)
+
+	// Embedded structs are flattened, so the same property can be
+	// defined more than once.
+	addField := func(field reflect.StructField) error {
+		if i, ok := fieldIndex[field.Name]; ok {
+			if fields[i].Type != field.Type {
+				return fmt.Errorf("property %q is defined with types %s and %s",
+					prefix+PropertyNameForField(field.Name), fields[i].Type, field.Type)
+			}
+			return nil
+		}
+		fieldIndex[field.Name] = len(fields)
+		fields = append(fields, field)
+		return nil
+	}
+
+	for _, field := range typeFields(typ) {
+		if field.PkgPath != "" {
+			// The field is not exported so just skip it.
+			continue
+		}
+		if HasTag(field, "blueprint", "mutated") {
+			continue
+		}
+
+		variant := all || HasTag(field, "blueprint", "variant") ||
+			HasTag(field, "blueprint", "variant_prepend")
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct {
+			fieldType = fieldType.Elem()
+		}
+
+		nestedPrefix := prefix + PropertyNameForField(field.Name) + "."
+		if field.Anonymous {
+			nestedPrefix = prefix
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Struct:
+			nested, err := variantPropertiesStruct(fieldType, variant, nestedPrefix)
+			if err != nil {
+				return nil, err
+			}
+			if nested == nil {
+				continue
+			}
+			if field.Anonymous {
+				for i := 0; i < nested.NumField(); i++ {
+					if err := addField(nested.Field(i)); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			field.Type = nested
+		case reflect.Interface:
+			// The type of the value isn't known until the property
+			// struct is created.
+			continue
+		default:
+			if !variant {
+				continue
+			}
+		}
+
+		if err := addField(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	for i := range fields {
+		fields[i].Anonymous = false
+		fields[i].Index = nil
+		fields[i].Offset = 0
+	}
+
+	return reflect.StructOf(fields), nil
+}
+
+// SquashVariantProperties extends the property structs
+// in dst with the properties in src, a pointer to the
+// struct for a single variant in a value of a type
+// returned by VariantPropertiesType. Properties are
+// matched by their Blueprints names, and are appended,
+// or prepended if their fields are tagged with
+// `blueprint:"variant_prepend"`. Properties tagged
+// with `blueprint:"replace"` are replaced as described
+// for ExtendProperties. Properties that are not set in
+// src are left unchanged.
+//
+// An error returned by SquashVariantProperties that
+// applies to a specific property will be an
+// *ExtendPropertyError.
+func SquashVariantProperties(dst []interface{}, src interface{}) error {
+	srcValue, err := getStruct(src)
+	if err != nil {
+		if _, ok := err.(getStructEmptyError); ok {
+			return nil
+		}
+		return err
+	}
+
+	return squashVariantProperties(dst, srcValue, "")
+}
+
+func squashVariantProperties(dst []interface{}, srcValue reflect.Value, prefix string) error {
+	for i, srcField := range typeFields(srcValue.Type()) {
+		srcFieldValue := srcValue.Field(i)
+
+		if srcFieldValue.Kind() == reflect.Struct {
+			nestedPrefix := prefix + PropertyNameForField(srcField.Name) + "."
+			if err := squashVariantProperties(dst, srcFieldValue, nestedPrefix); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isZeroValue(srcFieldValue) {
+			continue
+		}
+
+		propertyName := prefix + PropertyNameForField(srcField.Name)
+		found := false
+
+		for _, d := range dst {
+			if _, ok := propertyFieldValue(d, propertyName, false); !ok {
+				continue
+			}
+			found = true
+
+			// Look the property up again, allocating any nil pointers
+			// to structs that contain it.
+			dstFieldValue, _ := propertyFieldValue(d, propertyName, true)
+			if dstFieldValue.Type() != srcFieldValue.Type() {
+				return extendPropertyErrorf(propertyName, "mismatched types %s and %s",
+					dstFieldValue.Type(), srcFieldValue.Type())
+			}
+
+			order := Append
+			if HasTag(srcField, "blueprint", "variant_prepend") {
+				order = Prepend
+			}
+			if HasTag(srcField, "blueprint", "replace") {
+				if order == Prepend && !isZeroValue(dstFieldValue) {
+					continue
+				}
+				order = Replace
+			}
+
+			ExtendBasicType(dstFieldValue, srcFieldValue, order)
+		}
+
+		if !found {
+			return extendPropertyErrorf(propertyName, "failed to find property to extend")
+		}
+	}
+
+	return nil
+}
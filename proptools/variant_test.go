@@ -0,0 +1,188 @@
+package proptools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type VariantTestEmbedded struct {
+	Srcs    []string `blueprint:"variant"`
+	Enabled *bool    `blueprint:"variant"`
+}
+
+type variantTestProperties struct {
+	VariantTestEmbedded
+	Name    *string
+	Cflags  []string `blueprint:"variant_prepend"`
+	Linker  *string  `blueprint:"variant,replace"`
+	Exclude []string `blueprint:"variant,replace"`
+	Target  struct {
+		Android *struct {
+			Cflags []string
+			Static *bool
+		} `blueprint:"variant"`
+		Host struct {
+			Cflags []string
+		}
+	}
+	Other interface{}
+}
+
+func TestVariantPropertiesType(t *testing.T) {
+	typ, err := VariantPropertiesType(reflect.TypeOf(&variantTestProperties{}),
+		[]string{"arm", "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		names = append(names, typ.Field(i).Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Arm", "X86_64"}) {
+		t.Errorf("incorrect variant fields %q", names)
+	}
+
+	variantType := typ.Field(0).Type
+	if typ.Field(1).Type != variantType {
+		t.Errorf("expected all the variants to have the same type")
+	}
+
+	var fields []string
+	var walk func(prefix string, typ reflect.Type)
+	walk = func(prefix string, typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(prefix+field.Name+".", field.Type)
+				continue
+			}
+			fields = append(fields, prefix+field.Name+" "+field.Type.String())
+		}
+	}
+	walk("", variantType)
+
+	expected := []string{
+		"Srcs []string",
+		"Enabled *bool",
+		"Cflags []string",
+		"Linker *string",
+		"Exclude []string",
+		"Target.Android.Cflags []string",
+		"Target.Android.Static *bool",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("incorrect variant properties:\n  expected: %q\n       got: %q", expected,
+			fields)
+	}
+
+	typ, err = VariantPropertiesType(reflect.TypeOf(struct{ Name *string }{}), []string{"arm"})
+	if typ != nil || err != nil {
+		t.Errorf("expected no type without variant properties, got %v, %v", typ, err)
+	}
+}
+
+type VariantTestConflict struct {
+	Srcs *string `blueprint:"variant"`
+}
+
+func TestVariantPropertiesTypeErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		typ      reflect.Type
+		variants []string
+		err      string
+	}{
+		{
+			name:     "not a struct",
+			typ:      reflect.TypeOf(""),
+			variants: []string{"arm"},
+			err:      "expected struct type, got string",
+		},
+		{
+			name:     "duplicate variant",
+			typ:      reflect.TypeOf(variantTestProperties{}),
+			variants: []string{"arm", "arm"},
+			err:      `variant "arm" is defined more than once`,
+		},
+		{
+			name: "conflicting types",
+			typ: reflect.TypeOf(struct {
+				VariantTestEmbedded
+				VariantTestConflict
+			}{}),
+			variants: []string{"arm"},
+			err:      `property "srcs" is defined with types []string and *string`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := VariantPropertiesType(testCase.typ, testCase.variants)
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("expected error %q, got %v", testCase.err, err)
+			}
+		})
+	}
+}
+
+func TestSquashVariantProperties(t *testing.T) {
+	typ, err := VariantPropertiesType(reflect.TypeOf(variantTestProperties{}), []string{"arm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props := &variantTestProperties{
+		Name:    StringPtr("a"),
+		Cflags:  []string{"-a"},
+		Linker:  StringPtr("ld"),
+		Exclude: []string{"a.c"},
+	}
+	props.Srcs = []string{"a.c"}
+	other := &struct{ Cflags []string }{Cflags: []string{"-o"}}
+
+	variants := reflect.New(typ)
+	arm := variants.Elem().Field(0)
+	armProperties := map[string]interface{}{
+		"arm.srcs":                  []string{"arm.c"},
+		"arm.cflags":                []string{"-arm"},
+		"arm.linker":                "gold",
+		"arm.target.android.static": true,
+	}
+	for name, value := range armProperties {
+		if err := SetProperty([]interface{}{variants.Interface()}, name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = SquashVariantProperties([]interface{}{props, other}, arm.Addr().Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &variantTestProperties{
+		Name:    StringPtr("a"),
+		Cflags:  []string{"-arm", "-a"},
+		Linker:  StringPtr("gold"),
+		Exclude: []string{"a.c"},
+	}
+	expected.Srcs = []string{"a.c", "arm.c"}
+	expected.Target.Android = &struct {
+		Cflags []string
+		Static *bool
+	}{Static: BoolPtr(true)}
+	if !reflect.DeepEqual(props, expected) {
+		t.Errorf("incorrect result:\n  expected: %#v\n       got: %#v", expected, props)
+	}
+	if !reflect.DeepEqual(other.Cflags, []string{"-arm", "-o"}) {
+		t.Errorf("expected cflags to be prepended in every struct, got %q", other.Cflags)
+	}
+
+	err = SquashVariantProperties([]interface{}{other}, arm.Addr().Interface())
+	extendErr, ok := err.(*ExtendPropertyError)
+	if !ok || extendErr.Property != "srcs" ||
+		!strings.Contains(extendErr.Err.Error(), "failed to find property to extend") {
+		t.Errorf("expected a missing property error, got %v", err)
+	}
+}
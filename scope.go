@@ -2,6 +2,8 @@ package blueprint
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -115,21 +117,114 @@ func (s *basicScope) LookupVariable(name string) (Variable, error) {
 
 		v, ok := importedScope.variables[varName]
 		if !ok {
-			return nil, fmt.Errorf("package %q does not contain variable %q",
-				pkgName, varName)
+			var exported []string
+			for candidate := range importedScope.variables {
+				first, _ := utf8.DecodeRuneInString(candidate)
+				if unicode.IsUpper(first) {
+					exported = append(exported, candidate)
+				}
+			}
+			return nil, fmt.Errorf("package %q does not contain variable %q%s",
+				pkgName, varName, didYouMean(varName, exported))
 		}
 
 		return v, nil
 	} else {
 		// The variable name has no package part; just "var"
+
+		// A variable can shadow one with the same name in a parent scope,
+		// only suggest each name once.
+		var candidates []string
+		seen := make(map[string]bool)
 		for ; s != nil; s = s.parent {
 			v, ok := s.variables[name]
 			if ok {
 				return v, nil
 			}
+			for candidate := range s.variables {
+				if !seen[candidate] {
+					seen[candidate] = true
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+		return nil, fmt.Errorf("undefined variable %q%s", name,
+			didYouMean(name, candidates))
+	}
+}
+
+// didYouMean returns a suggestion of the names in
+// candidates that are closest to name, for use in an
+// error message, or an empty string if none of them are
+// close.
+func didYouMean(name string, candidates []string) string {
+	// Allow roughly one typo for every three characters of the name.
+	maxDistance := len(name) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	bestDistance := maxDistance + 1
+	var best []string
+	for _, candidate := range candidates {
+		d := editDistance(name, candidate)
+		switch {
+		case d < bestDistance:
+			bestDistance = d
+			best = []string{candidate}
+		case d == bestDistance:
+			best = append(best, candidate)
+		}
+	}
+
+	if len(best) == 0 {
+		return ""
+	}
+
+	sort.Strings(best)
+	const maxSuggestions = 3
+	if len(best) > maxSuggestions {
+		best = best[:maxSuggestions]
+	}
+	for i := range best {
+		best[i] = strconv.Quote(best[i])
+	}
+
+	if len(best) == 1 {
+		return fmt.Sprintf(" (did you mean %s?)", best[0])
+	}
+	return fmt.Sprintf(" (did you mean %s or %s?)", strings.Join(best[:len(best)-1], ", "),
+		best[len(best)-1])
+}
+
+// editDistance returns the Levenshtein distance between
+// a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
 		}
-		return nil, fmt.Errorf("undefined variable %q", name)
+		prev, cur = cur, prev
 	}
+
+	return prev[len(b)]
 }
 
 func (s *basicScope) IsRuleVisible(rule Rule) bool {
@@ -370,6 +465,7 @@ type localRule struct {
 	def_       *ruleDef
 	argNames   map[string]bool
 	scope_     *basicScope
+	checked    bool // set if the defining package called EnableRuleChecks
 }
 
 func (l *localRule) packageContext() *packageContext {
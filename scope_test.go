@@ -0,0 +1,115 @@
+package blueprint
+
+import (
+	"testing"
+)
+
+func TestDidYouMean(t *testing.T) {
+	testCases := []struct {
+		name       string
+		candidates []string
+		expected   string
+	}{
+		{
+			name:       "cflags",
+			candidates: []string{"cflag", "ldflags", "srcs"},
+			expected:   ` (did you mean "cflag"?)`,
+		},
+		{
+			name:       "cflags",
+			candidates: []string{"ldflags", "asflags", "cflag", "cflagz"},
+			expected:   ` (did you mean "cflag" or "cflagz"?)`,
+		},
+		{
+			name:       "ab",
+			candidates: []string{"ad", "ac", "xb", "ab_", "zz"},
+			expected:   ` (did you mean "ab_", "ac" or "ad"?)`,
+		},
+		{
+			name:       "out",
+			candidates: []string{"in", "depfile"},
+			expected:   "",
+		},
+		{
+			name:     "out",
+			expected: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		got := didYouMean(testCase.name, testCase.candidates)
+		if got != testCase.expected {
+			t.Errorf("%q in %q: expected %q, got %q", testCase.name, testCase.candidates,
+				testCase.expected, got)
+		}
+	}
+}
+
+func TestLookupVariableSuggestions(t *testing.T) {
+	imported := newScope(nil)
+	parent := newScope(nil)
+	child := newScope(parent)
+
+	add := func(s *basicScope, names ...string) {
+		for _, name := range names {
+			err := s.AddVariable(&localVariable{name_: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	add(imported, "Cflags", "cflags_")
+	add(parent, "flags", "ldflags")
+	// Shadows the flags variable of the parent scope.
+	add(child, "flags")
+
+	if err := child.AddImport("pkg", imported); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		err  string
+	}{
+		{
+			name: "flag",
+			err:  `undefined variable "flag" (did you mean "flags"?)`,
+		},
+		{
+			name: "ldflag",
+			err:  `undefined variable "ldflag" (did you mean "ldflags"?)`,
+		},
+		{
+			name: "pkg.Cflag",
+			err:  `package "pkg" does not contain variable "Cflag" (did you mean "Cflags"?)`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := child.LookupVariable(testCase.name)
+		if err == nil || err.Error() != testCase.err {
+			t.Errorf("%q: expected error %q, got %v", testCase.name, testCase.err, err)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"flags", "flgas", 2},
+	}
+
+	for _, testCase := range testCases {
+		if got := editDistance(testCase.a, testCase.b); got != testCase.distance {
+			t.Errorf("editDistance(%q, %q): expected %d, got %d", testCase.a, testCase.b,
+				testCase.distance, got)
+		}
+	}
+}
@@ -28,6 +28,16 @@ type SingletonContext interface {
 	Build(pctx PackageContext, params BuildParams)
 	RequireNinjaVersion(major, minor, micro int)
 
+	// AddValidations attaches validation targets to
+	// the build statement that produces output, which
+	// may have been created by any module or
+	// singleton. The validations are built whenever
+	// output is built, but they do not block
+	// dependents of output. Pre-singletons can't add
+	// validations, as their build actions are not
+	// written to the Ninja file.
+	AddValidations(pctx PackageContext, output string, validations ...string)
+
 	// SetNinjaBuildDir sets the value of the
 	// top-level "builddir" Ninja variable that
 	// controls where Ninja stores its build log
@@ -148,6 +158,7 @@ func (s *singletonContext) Rule(pctx PackageContext, name string,
 	if err != nil {
 		panic(err)
 	}
+	r.checked = pctx.ruleChecksEnabled()
 
 	s.actionDefs.rules = append(s.actionDefs.rules, r)
 
@@ -165,6 +176,19 @@ func (s *singletonContext) Build(pctx PackageContext, params BuildParams) {
 	s.actionDefs.buildDefs = append(s.actionDefs.buildDefs, def)
 }
 
+func (s *singletonContext) AddValidations(pctx PackageContext, output string,
+	validations ...string) {
+
+	s.scope.ReparentTo(pctx)
+
+	def, err := parseValidationParams(s.scope, output, validations)
+	if err != nil {
+		panic(err)
+	}
+
+	s.actionDefs.validations = append(s.actionDefs.validations, def)
+}
+
 func (s *singletonContext) Eval(pctx PackageContext, str string) (string, error) {
 	s.scope.ReparentTo(pctx)
 
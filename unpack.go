@@ -3,27 +3,55 @@ package blueprint
 import (
 	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/scanner"
 
 	"github.com/google/blueprint/parser"
 	"github.com/google/blueprint/proptools"
 )
 
 type packedProperty struct {
-	property *parser.Property
-	unpacked bool
+	property   *parser.Property
+	unpacked   bool
+	deprecated bool // The use of a deprecated property has been recorded.
+}
+
+// DeprecatedProperty describes a use in a Blueprints
+// file of a property whose field is tagged with
+// `blueprint:"deprecated"`. A property that has been
+// renamed is tagged with
+// `blueprint:"deprecated,renamed_to=new_name"`, and
+// its value is also unpacked into the field for the
+// property new_name in the same struct.
+type DeprecatedProperty struct {
+	Module    string // The name of the module that uses the property.
+	Property  string // The full name of the deprecated property.
+	RenamedTo string // The full name of the property that replaces it, if any.
+	Pos       scanner.Position
+}
+
+func (d DeprecatedProperty) message() string {
+	if d.RenamedTo != "" {
+		return fmt.Sprintf("deprecated property, use %q instead", d.RenamedTo)
+	}
+	return "deprecated property"
 }
 
 func unpackProperties(propertyDefs []*parser.Property,
-	propertiesStructs ...interface{}) (map[string]*parser.Property, []error) {
+	propertiesStructs ...interface{}) (map[string]*parser.Property, []DeprecatedProperty, []error) {
 
 	propertyMap := make(map[string]*packedProperty)
 	errs := buildPropertyMap("", propertyDefs, propertyMap)
 	if len(errs) > 0 {
-		return nil, errs
+		return nil, nil, errs
 	}
 
+	var deprecated []DeprecatedProperty
+
 	for _, properties := range propertiesStructs {
 		propertiesValue := reflect.ValueOf(properties)
 		if propertiesValue.Kind() != reflect.Ptr {
@@ -35,11 +63,11 @@ func unpackProperties(propertyDefs []*parser.Property,
 			panic("properties must be a pointer to a struct")
 		}
 
-		newErrs := unpackStructValue("", propertiesValue, propertyMap, "", "")
+		newErrs := unpackStructValue("", propertiesValue, propertyMap, "", "", &deprecated)
 		errs = append(errs, newErrs...)
 
 		if len(errs) >= maxErrors {
-			return nil, errs
+			return nil, nil, errs
 		}
 	}
 
@@ -58,10 +86,10 @@ func unpackProperties(propertyDefs []*parser.Property,
 	}
 
 	if len(errs) > 0 {
-		return nil, errs
+		return nil, nil, errs
 	}
 
-	return result, nil
+	return result, deprecated, nil
 }
 
 func buildPropertyMap(namePrefix string, propertyDefs []*parser.Property,
@@ -105,7 +133,8 @@ func buildPropertyMap(namePrefix string, propertyDefs []*parser.Property,
 }
 
 func unpackStructValue(namePrefix string, structValue reflect.Value,
-	propertyMap map[string]*packedProperty, filterKey, filterValue string) []error {
+	propertyMap map[string]*packedProperty, filterKey, filterValue string,
+	deprecated *[]DeprecatedProperty) []error {
 
 	structType := structValue.Type()
 
@@ -140,12 +169,18 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 		origFieldValue := fieldValue
 
 		switch kind := fieldValue.Kind(); kind {
-		case reflect.Bool, reflect.String, reflect.Struct:
+		case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String,
+			reflect.Struct:
 			// Do nothing
 		case reflect.Slice:
-			elemType := field.Type.Elem()
-			if elemType.Kind() != reflect.String {
-				panic(fmt.Errorf("field %s is a non-string slice", propertyName))
+			if !unpackableElemType(field.Type.Elem(), false) {
+				panic(fmt.Errorf("field %s is a slice of %s", propertyName, field.Type.Elem()))
+			}
+		case reflect.Map:
+			if field.Type.Key().Kind() != reflect.String ||
+				!unpackableElemType(field.Type.Elem(), true) {
+				panic(fmt.Errorf("field %s is a map of %s to %s", propertyName,
+					field.Type.Key(), field.Type.Elem()))
 			}
 		case reflect.Interface:
 			if fieldValue.IsNil() {
@@ -168,7 +203,7 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 					origFieldValue.Set(fieldValue)
 				}
 				fieldValue = fieldValue.Elem()
-			case reflect.Bool, reflect.Int64, reflect.String:
+			case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String:
 				// Nothing
 			default:
 				panic(fmt.Errorf("field %s contains a pointer to %s", propertyName, ptrKind))
@@ -184,7 +219,8 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 		}
 
 		if field.Anonymous && fieldValue.Kind() == reflect.Struct {
-			newErrs := unpackStructValue(namePrefix, fieldValue, propertyMap, filterKey, filterValue)
+			newErrs := unpackStructValue(namePrefix, fieldValue, propertyMap, filterKey, filterValue,
+				deprecated)
 			errs = append(errs, newErrs...)
 			continue
 		}
@@ -220,6 +256,40 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 			continue
 		}
 
+		// The value of a renamed property is also unpacked into the field
+		// for its new name.
+		var renamedValue reflect.Value
+		if proptools.HasTag(field, "blueprint", "deprecated") {
+			renamedTo := renamedPropertyName(field)
+			if renamedTo != "" {
+				var err error
+				renamedValue, err = renamedFieldValue(structValue, field, renamedTo)
+				renamedTo = namePrefix + renamedTo
+				if err == nil {
+					if _, ok := propertyMap[renamedTo]; ok {
+						err = fmt.Errorf("can't be set together with %q, which replaces it",
+							renamedTo)
+					}
+				}
+				if err != nil {
+					errs = append(errs, propertyErrorf(propertyName,
+						packedProperty.property.ColonPos, "%s", err))
+					if len(errs) >= maxErrors {
+						return errs
+					}
+					continue
+				}
+			}
+			if !packedProperty.deprecated {
+				packedProperty.deprecated = true
+				*deprecated = append(*deprecated, DeprecatedProperty{
+					Property:  propertyName,
+					RenamedTo: renamedTo,
+					Pos:       packedProperty.property.ColonPos,
+				})
+			}
+		}
+
 		var newErrs []error
 
 		if fieldValue.Kind() == reflect.Struct {
@@ -241,7 +311,7 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 				}
 			}
 			newErrs = unpackStruct(propertyName+".", fieldValue,
-				packedProperty.property, propertyMap, localFilterKey, localFilterValue)
+				packedProperty.property, propertyMap, localFilterKey, localFilterValue, deprecated)
 
 			errs = append(errs, newErrs...)
 			if len(errs) >= maxErrors {
@@ -251,91 +321,262 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 			continue
 		}
 
-		// Handle basic types and pointers to basic types
+		// Handle basic types, pointers to basic types, slices and maps
 
-		propertyValue, err := propertyToValue(fieldValue.Type(), packedProperty.property)
-		if err != nil {
-			errs = append(errs, err)
+		propertyValue, newErrs := propertyToValue(fieldValue.Type(),
+			packedProperty.property.Value, propertyName, deprecated)
+		if len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
 			if len(errs) >= maxErrors {
 				return errs
 			}
+			continue
+		}
+
+		if err := checkPropertyConstraints(field, propertyName, propertyValue); err != nil {
+			errs = append(errs, propertyErrorf(propertyName,
+				packedProperty.property.ColonPos, "%s", err))
+			if len(errs) >= maxErrors {
+				return errs
+			}
+			continue
 		}
 
 		proptools.ExtendBasicType(fieldValue, propertyValue, proptools.Append)
+		if renamedValue.IsValid() {
+			proptools.ExtendBasicType(renamedValue, propertyValue, proptools.Append)
+		}
 	}
 
 	return errs
 }
 
-func propertyToValue(typ reflect.Type, property *parser.Property) (reflect.Value, error) {
+// renamedPropertyName returns the name from the
+// renamed_to=name entry of the blueprint tag of field,
+// or "" if there is none.
+func renamedPropertyName(field reflect.StructField) string {
+	for _, entry := range strings.Split(field.Tag.Get("blueprint"), ",") {
+		if strings.HasPrefix(entry, "renamed_to=") {
+			return strings.TrimPrefix(entry, "renamed_to=")
+		}
+	}
+	return ""
+}
+
+// renamedFieldValue returns the field of structValue for
+// the property renamedTo that replaces the deprecated
+// property in field, or an error if there is no such
+// field with the same type, or if field is a struct.
+func renamedFieldValue(structValue reflect.Value, field reflect.StructField,
+	renamedTo string) (reflect.Value, error) {
+
+	if field.Type.Kind() == reflect.Struct ||
+		field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("renaming a struct property is not supported")
+	}
+	renamedField, ok := structValue.Type().FieldByName(proptools.FieldNameForProperty(renamedTo))
+	if !ok || len(renamedField.Index) != 1 {
+		return reflect.Value{}, fmt.Errorf("renamed to %q, which is not a property of the same struct",
+			renamedTo)
+	}
+	if renamedField.Type != field.Type {
+		return reflect.Value{}, fmt.Errorf("renamed to %q, which has type %s instead of %s",
+			renamedTo, renamedField.Type, field.Type)
+	}
+
+	return structValue.Field(renamedField.Index[0]), nil
+}
+
+// unpackableElemType returns true if values of type typ
+// can be unpacked as the elements of a slice, or as the
+// values of a map if allowSlice is true.
+func unpackableElemType(typ reflect.Type, allowSlice bool) bool {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String,
+		reflect.Struct:
+		return true
+	case reflect.Ptr:
+		switch typ.Elem().Kind() {
+		case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint64, reflect.String,
+			reflect.Struct:
+			return true
+		}
+	case reflect.Slice:
+		return allowSlice && unpackableElemType(typ.Elem(), false)
+	}
+	return false
+}
+
+// propertyToValue converts the value of the property or
+// element name to a value of type typ. Errors are
+// reported at the position of the innermost value that
+// could not be converted.
+func propertyToValue(typ reflect.Type, expr parser.Expression, name string,
+	deprecated *[]DeprecatedProperty) (reflect.Value, []error) {
 	var value reflect.Value
 
-	var ptr bool
 	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
-		ptr = true
+		elemValue, errs := propertyToValue(typ.Elem(), expr, name, deprecated)
+		if len(errs) > 0 {
+			return value, errs
+		}
+		value = reflect.New(typ.Elem())
+		value.Elem().Set(elemValue)
+		return value, nil
 	}
 
+	value = reflect.New(typ).Elem()
+
 	switch kind := typ.Kind(); kind {
 	case reflect.Bool:
-		b, ok := property.Value.Eval().(*parser.Bool)
+		b, ok := expr.Eval().(*parser.Bool)
 		if !ok {
-			return value, fmt.Errorf("%s: can't assign %s value to bool property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name)
+			return value, []error{fmt.Errorf("%s: can't assign %s value to bool property %q",
+				expr.Pos(), expr.Type(), name)}
 		}
-		value = reflect.ValueOf(b.Value)
+		value.SetBool(b.Value)
 
-	case reflect.Int64:
-		b, ok := property.Value.Eval().(*parser.Int64)
+	case reflect.Int32, reflect.Int64, reflect.Uint64:
+		i, ok := expr.Eval().(*parser.Int64)
 		if !ok {
-			return value, fmt.Errorf("%s: can't assign %s value to int64 property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name)
+			return value, []error{fmt.Errorf("%s: can't assign %s value to %s property %q",
+				expr.Pos(), expr.Type(), kind, name)}
+		}
+		if kind == reflect.Uint64 {
+			if i.Value < 0 {
+				return value, []error{fmt.Errorf("%s: value %d is out of range for %s property %q",
+					expr.Pos(), i.Value, kind, name)}
+			}
+			value.SetUint(uint64(i.Value))
+		} else {
+			if value.OverflowInt(i.Value) {
+				return value, []error{fmt.Errorf("%s: value %d is out of range for %s property %q",
+					expr.Pos(), i.Value, kind, name)}
+			}
+			value.SetInt(i.Value)
 		}
-		value = reflect.ValueOf(b.Value)
 
 	case reflect.String:
-		s, ok := property.Value.Eval().(*parser.String)
+		s, ok := expr.Eval().(*parser.String)
 		if !ok {
-			return value, fmt.Errorf("%s: can't assign %s value to string property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name)
+			return value, []error{fmt.Errorf("%s: can't assign %s value to string property %q",
+				expr.Pos(), expr.Type(), name)}
+		}
+		if values, ok := proptools.EnumValues(typ); ok && !inStringLists(s.Value, values) {
+			return value, []error{fmt.Errorf("%s: invalid value %q for property %q, expected one of %s",
+				expr.Pos(), s.Value, name, strings.Join(values, ", "))}
 		}
-		value = reflect.ValueOf(s.Value)
+		value.SetString(s.Value)
 
 	case reflect.Slice:
-		l, ok := property.Value.Eval().(*parser.List)
+		l, ok := expr.Eval().(*parser.List)
+		if !ok {
+			return value, []error{fmt.Errorf("%s: can't assign %s value to list property %q",
+				expr.Pos(), expr.Type(), name)}
+		}
+
+		var errs []error
+		value.Set(reflect.MakeSlice(typ, len(l.Values), len(l.Values)))
+		for i, elem := range l.Values {
+			elemValue, newErrs := propertyToValue(typ.Elem(), elem, fmt.Sprintf("%s[%d]", name, i),
+				deprecated)
+			if len(newErrs) > 0 {
+				errs = append(errs, newErrs...)
+				if len(errs) >= maxErrors {
+					return value, errs
+				}
+				continue
+			}
+			value.Index(i).Set(elemValue)
+		}
+		if len(errs) > 0 {
+			return value, errs
+		}
+
+	case reflect.Map:
+		m, ok := expr.Eval().(*parser.Map)
+		if !ok {
+			return value, []error{fmt.Errorf("%s: can't assign %s value to map property %q",
+				expr.Pos(), expr.Type(), name)}
+		}
+
+		var errs []error
+		value.Set(reflect.MakeMapWithSize(typ, len(m.Properties)))
+		for _, property := range m.Properties {
+			key := reflect.New(typ.Key()).Elem()
+			key.SetString(property.Name)
+			if value.MapIndex(key).IsValid() {
+				errs = append(errs, &BlueprintError{
+					Err: fmt.Errorf("property %q already defined", name+"."+property.Name),
+					Pos: property.ColonPos,
+				})
+				continue
+			}
+
+			elemValue, newErrs := propertyToValue(typ.Elem(), property.Value,
+				name+"."+property.Name, deprecated)
+			if len(newErrs) > 0 {
+				errs = append(errs, newErrs...)
+				if len(errs) >= maxErrors {
+					return value, errs
+				}
+				continue
+			}
+			value.SetMapIndex(key, elemValue)
+		}
+		if len(errs) > 0 {
+			return value, errs
+		}
+
+	case reflect.Struct:
+		// Structs in lists and maps are unpacked with their own property map,
+		// as the same property names can appear in each of them.
+		m, ok := expr.Eval().(*parser.Map)
 		if !ok {
-			return value, fmt.Errorf("%s: can't assign %s value to list property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name)
+			return value, []error{fmt.Errorf("%s: can't assign %s value to map property %q",
+				expr.Pos(), expr.Type(), name)}
+		}
+
+		propertyMap := make(map[string]*packedProperty)
+		errs := buildPropertyMap(name+".", m.Properties, propertyMap)
+		if len(errs) > 0 {
+			return value, errs
 		}
 
-		list := make([]string, len(l.Values))
-		for i, value := range l.Values {
-			s, ok := value.Eval().(*parser.String)
-			if !ok {
-				// The parser should not produce this.
-				panic(fmt.Errorf("non-string value %q found in list", value))
+		errs = unpackStructValue(name+".", value, propertyMap, "", "", deprecated)
+		for _, err := range errs {
+			if propertyErr, ok := err.(*PropertyError); ok && !propertyErr.Pos.IsValid() {
+				propertyErr.Pos = expr.Pos()
 			}
-			list[i] = s.Value
 		}
 
-		value = reflect.ValueOf(list)
+		names := make([]string, 0, len(propertyMap))
+		for name := range propertyMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if packed := propertyMap[name]; !packed.unpacked {
+				errs = append(errs, &BlueprintError{
+					Err: fmt.Errorf("unrecognized property %q", name),
+					Pos: packed.property.ColonPos,
+				})
+			}
+		}
+		if len(errs) > 0 {
+			return value, errs
+		}
 
 	default:
 		panic(fmt.Errorf("unexpected kind %s", kind))
 	}
 
-	if ptr {
-		ptrValue := reflect.New(value.Type())
-		ptrValue.Elem().Set(value)
-		value = ptrValue
-	}
-
 	return value, nil
 }
 
 func unpackStruct(namePrefix string, structValue reflect.Value,
 	property *parser.Property, propertyMap map[string]*packedProperty,
-	filterKey, filterValue string) []error {
+	filterKey, filterValue string, deprecated *[]DeprecatedProperty) []error {
 
 	m, ok := property.Value.Eval().(*parser.Map)
 	if !ok {
@@ -350,7 +591,8 @@ func unpackStruct(namePrefix string, structValue reflect.Value,
 		return errs
 	}
 
-	return unpackStructValue(namePrefix, structValue, propertyMap, filterKey, filterValue)
+	return unpackStructValue(namePrefix, structValue, propertyMap, filterKey, filterValue,
+		deprecated)
 }
 
 func HasFilter(field reflect.StructTag) (k, v string, err error) {
@@ -378,3 +620,288 @@ func HasFilter(field reflect.StructTag) (k, v string, err error) {
 
 	return "", "", nil
 }
+
+// propertyErrorf returns a PropertyError for a property
+// of a module that is being unpacked. The module is
+// filled in by the caller of unpackProperties, and so
+// is the position if pos is not valid.
+func propertyErrorf(property string, pos scanner.Position,
+	format string, args ...interface{}) *PropertyError {
+
+	return &PropertyError{
+		ModuleError: ModuleError{
+			BlueprintError: BlueprintError{
+				Err: fmt.Errorf(format, args...),
+				Pos: pos,
+			},
+		},
+		property: property,
+	}
+}
+
+// setDeprecatedProperties returns the uses of the
+// properties tagged with `blueprint:"deprecated"` that
+// are set to a non-zero value in property structs that
+// were not unpacked from a Blueprints file, reported at
+// pos. The values of renamed properties are also set
+// into the properties they were renamed to, as when
+// unpacking a Blueprints file, and errors are returned
+// for the renamed properties that are set along with
+// the properties that replace them.
+func setDeprecatedProperties(propertyStructs []interface{},
+	pos scanner.Position) ([]DeprecatedProperty, []error) {
+
+	var deprecated []DeprecatedProperty
+	var errs []error
+
+	var walk func(prefix string, structValue reflect.Value)
+	walk = func(prefix string, structValue reflect.Value) {
+		structType := structValue.Type()
+		for i := 0; i < structValue.NumField(); i++ {
+			field := structType.Field(i)
+			if field.PkgPath != "" {
+				// This is an unexported field, so just skip it.
+				continue
+			}
+
+			fieldValue := structValue.Field(i)
+			if fieldValue.IsZero() {
+				continue
+			}
+
+			propertyName := prefix + proptools.PropertyNameForField(field.Name)
+			nestedPrefix := propertyName + "."
+			if field.Anonymous || field.Name == "BlueprintEmbed" {
+				nestedPrefix = prefix
+			}
+
+			if proptools.HasTag(field, "blueprint", "deprecated") {
+				d := DeprecatedProperty{Property: propertyName, Pos: pos}
+				if renamedTo := renamedPropertyName(field); renamedTo != "" {
+					renamedValue, err := renamedFieldValue(structValue, field, renamedTo)
+					if err == nil && !renamedValue.IsZero() {
+						err = fmt.Errorf("can't be set together with %q, which replaces it",
+							prefix+renamedTo)
+					}
+					if err != nil {
+						errs = append(errs, propertyErrorf(propertyName, pos, "%s", err))
+						continue
+					}
+					proptools.ExtendBasicType(renamedValue, fieldValue, proptools.Append)
+					d.RenamedTo = prefix + renamedTo
+				}
+				deprecated = append(deprecated, d)
+				continue
+			}
+
+			for (fieldValue.Kind() == reflect.Interface || fieldValue.Kind() == reflect.Ptr) &&
+				!fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				walk(nestedPrefix, fieldValue)
+			}
+		}
+	}
+
+	for _, properties := range propertyStructs {
+		walk("", reflect.ValueOf(properties).Elem())
+	}
+
+	return deprecated, errs
+}
+
+// requiredProperties returns the names of the
+// properties of the property structs that are tagged
+// with `blueprint:"required"` and are not set to a
+// non-zero value. The properties of a nested struct are
+// only checked if it has a property that is set.
+func requiredProperties(propertyStructs []interface{}) []string {
+	var missing []string
+
+	var walk func(prefix string, structValue reflect.Value)
+	walk = func(prefix string, structValue reflect.Value) {
+		structType := structValue.Type()
+		for i := 0; i < structValue.NumField(); i++ {
+			field := structType.Field(i)
+			if field.PkgPath != "" {
+				// This is an unexported field, so just skip it.
+				continue
+			}
+
+			fieldValue := structValue.Field(i)
+			propertyName := prefix + proptools.PropertyNameForField(field.Name)
+			nestedPrefix := propertyName + "."
+			if field.Anonymous || field.Name == "BlueprintEmbed" {
+				nestedPrefix = prefix
+			}
+
+			if proptools.HasTag(field, "blueprint", "required") && fieldValue.IsZero() {
+				missing = append(missing, propertyName)
+				continue
+			}
+
+			for (fieldValue.Kind() == reflect.Interface || fieldValue.Kind() == reflect.Ptr) &&
+				!fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct && !fieldValue.IsZero() {
+				walk(nestedPrefix, fieldValue)
+			}
+		}
+	}
+
+	for _, properties := range propertyStructs {
+		walk("", reflect.ValueOf(properties).Elem())
+	}
+
+	return missing
+}
+
+// Compiled regular expressions from pattern tags, by
+// pattern.
+var propertyPatterns sync.Map
+
+// checkPropertyConstraints returns an error if the value
+// of a property, or any element of it, doesn't satisfy
+// the enum, range or pattern tags of its field:
+//
+//   enum:"a,b,c"   the value must be one of a, b or c
+//   range:"0,64"   the value must be between 0 and 64,
+//                  inclusive; either bound may be empty
+//   pattern:"re"   the value must match the regular
+//                  expression re in its entirety
+//
+// enum and pattern apply to strings and range applies
+// to int32s, int64s and uint64s, including pointers to
+// them and slices and maps of them.
+func checkPropertyConstraints(field reflect.StructField, propertyName string,
+	value reflect.Value) error {
+
+	enum, hasEnum := field.Tag.Lookup("enum")
+	bounds, hasRange := field.Tag.Lookup("range")
+	pattern, hasPattern := field.Tag.Lookup("pattern")
+	if !hasEnum && !hasRange && !hasPattern {
+		return nil
+	}
+
+	elemType := field.Type
+	for elemType.Kind() == reflect.Ptr || elemType.Kind() == reflect.Slice ||
+		elemType.Kind() == reflect.Map {
+		elemType = elemType.Elem()
+	}
+	if (hasEnum || hasPattern) && elemType.Kind() != reflect.String {
+		panic(fmt.Errorf("field %s has an enum or pattern tag but is not a string", propertyName))
+	}
+	if hasRange {
+		switch elemType.Kind() {
+		case reflect.Int32, reflect.Int64, reflect.Uint64:
+		default:
+			panic(fmt.Errorf("field %s has a range tag but is not an integer", propertyName))
+		}
+	}
+
+	var enumValues []string
+	if hasEnum {
+		for _, s := range strings.Split(enum, ",") {
+			enumValues = append(enumValues, strings.TrimSpace(s))
+		}
+	}
+
+	var check func(value reflect.Value) error
+	check = func(value reflect.Value) error {
+		switch value.Kind() {
+		case reflect.Ptr:
+			if !value.IsNil() {
+				return check(value.Elem())
+			}
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				if err := check(value.Index(i)); err != nil {
+					return err
+				}
+			}
+		case reflect.Map:
+			keys := value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, key := range keys {
+				if err := check(value.MapIndex(key)); err != nil {
+					return err
+				}
+			}
+		case reflect.String:
+			s := value.String()
+			if hasEnum && !inStringLists(s, enumValues) {
+				return fmt.Errorf("invalid value %q, expected one of %s", s,
+					strings.Join(enumValues, ", "))
+			}
+			if hasPattern && !propertyPattern(propertyName, pattern).MatchString(s) {
+				return fmt.Errorf("value %q does not match pattern %q", s, pattern)
+			}
+		case reflect.Int32, reflect.Int64, reflect.Uint64:
+			min, max, err := parseRange(bounds)
+			if err != nil {
+				panic(fmt.Errorf("field %s has an invalid range tag: %s", propertyName, err))
+			}
+			var i int64
+			if value.Kind() == reflect.Uint64 {
+				// Unpacked uint64 values always fit in an int64, as they
+				// come from int64 values in the Blueprints file.
+				i = int64(value.Uint())
+			} else {
+				i = value.Int()
+			}
+			if (min != nil && i < *min) || (max != nil && i > *max) {
+				return fmt.Errorf("value %d is out of range %s", i, formatRange(min, max))
+			}
+		}
+		return nil
+	}
+
+	return check(value)
+}
+
+func propertyPattern(propertyName, pattern string) *regexp.Regexp {
+	if re, ok := propertyPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		panic(fmt.Errorf("field %s has an invalid pattern tag: %s", propertyName, err))
+	}
+	propertyPatterns.Store(pattern, re)
+	return re
+}
+
+// parseRange parses the value of a range tag, returning
+// nil for bounds that are empty.
+func parseRange(bounds string) (min, max *int64, err error) {
+	parts := strings.Split(bounds, ",")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("expected min,max, got %q", bounds)
+	}
+
+	for i, dest := range []**int64{&min, &max} {
+		if s := strings.TrimSpace(parts[i]); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, nil, err
+			}
+			*dest = &n
+		}
+	}
+
+	return min, max, nil
+}
+
+func formatRange(min, max *int64) string {
+	switch {
+	case min == nil:
+		return fmt.Sprintf("<= %d", *max)
+	case max == nil:
+		return fmt.Sprintf(">= %d", *min)
+	default:
+		return fmt.Sprintf("[%d, %d]", *min, *max)
+	}
+}
@@ -0,0 +1,530 @@
+package blueprint
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+	"github.com/google/blueprint/proptools"
+)
+
+// unpackTestModule parses a Blueprints file containing a
+// single module and unpacks its properties into
+// propertiesStructs.
+func unpackTestModule(t *testing.T, bp string, propertiesStructs ...interface{}) []error {
+	file, errs := parser.ParseAndEval("Blueprints", bytes.NewBufferString(bp), parser.NewScope(nil))
+	if len(errs) > 0 {
+		return errs
+	}
+
+	module := file.Defs[0].(*parser.Module)
+	_, _, errs = unpackProperties(module.Properties, propertiesStructs...)
+	return errs
+}
+
+type unpackTestLib struct {
+	Name   string
+	Srcs   []string
+	Static *bool
+}
+
+type unpackTestProperties struct {
+	Libs   []unpackTestLib
+	Ptrs   []*unpackTestLib
+	Ints   []int64
+	Bools  []*bool
+	Flags  map[string]string
+	Deps   map[string][]string
+	Opts   map[string]*unpackTestLib
+	Counts map[string]int64
+}
+
+func TestUnpackListsAndMaps(t *testing.T) {
+	properties := &unpackTestProperties{}
+	errs := unpackTestModule(t, `
+		m {
+			libs: [
+				{
+					name: "a",
+					srcs: ["a.c"],
+				},
+				{
+					name: "b",
+					static: true,
+				},
+			],
+			ptrs: [{name: "c"}],
+			ints: [1, 2],
+			bools: [true, false],
+			flags: {
+				arm: "-march",
+				x86: "-m32",
+			},
+			deps: {a: ["x", "y"]},
+			opts: {p: {name: "p"}},
+			counts: {a: 3},
+		}
+	`, properties)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	expected := &unpackTestProperties{
+		Libs: []unpackTestLib{
+			{Name: "a", Srcs: []string{"a.c"}},
+			{Name: "b", Static: boolPtr(true)},
+		},
+		Ptrs:   []*unpackTestLib{{Name: "c"}},
+		Ints:   []int64{1, 2},
+		Bools:  []*bool{boolPtr(true), boolPtr(false)},
+		Flags:  map[string]string{"arm": "-march", "x86": "-m32"},
+		Deps:   map[string][]string{"a": {"x", "y"}},
+		Opts:   map[string]*unpackTestLib{"p": {Name: "p"}},
+		Counts: map[string]int64{"a": 3},
+	}
+	if !reflect.DeepEqual(properties, expected) {
+		t.Errorf("incorrect properties:\n  expected: %#v\n       got: %#v", expected, properties)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestUnpackListsAndMapsErrors(t *testing.T) {
+	testCases := []struct {
+		bp  string
+		err string
+	}{
+		{
+			bp:  `m { libs: [{name: "a", bad: "b"}] }`,
+			err: `Blueprints:1:27: unrecognized property "libs[0].bad"`,
+		},
+		{
+			bp:  `m { ints: ["a"] }`,
+			err: `Blueprints:1:12: can't assign string value to int64 property "ints[0]"`,
+		},
+		{
+			bp:  `m { libs: ["a"] }`,
+			err: `Blueprints:1:12: can't assign string value to map property "libs[0]"`,
+		},
+		{
+			bp:  `m { flags: ["a"] }`,
+			err: `Blueprints:1:12: can't assign list value to map property "flags"`,
+		},
+		{
+			bp:  `m { deps: {a: "x"} }`,
+			err: `Blueprints:1:15: can't assign string value to list property "deps.a"`,
+		},
+		{
+			bp:  `m { ints: [1, "a"] }`,
+			err: `Expected int64 in list, found string`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		errs := unpackTestModule(t, testCase.bp, &unpackTestProperties{})
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+			t.Errorf("%s: expected error %q, got %q", testCase.bp, testCase.err, errs)
+		}
+	}
+}
+
+func TestNonStringBuildList(t *testing.T) {
+	ctx := NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`build = ["a", 1]`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		t.Errorf("expected an error for a list of strings containing an integer")
+	}
+
+	ctx = NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`build = [{a: "b"}]`),
+	})
+
+	_, errs = ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `"build" must be a list of strings`) {
+		t.Errorf("expected a list of strings error, got %q", errs)
+	}
+}
+
+type constraintsTestModule struct {
+	SimpleName
+	properties struct {
+		Kind    string   `enum:"static, shared"`
+		Level   *int64   `range:"0,10"`
+		Min     []int64  `range:"1,"`
+		Size    *uint64  `range:"1,4"`
+		Stem    *string  `pattern:"[a-z_]+"`
+		Arches  []string `enum:"arm,x86"`
+		Src     *string  `blueprint:"required"`
+		Install struct {
+			Dir  string `blueprint:"required"`
+			Mode string
+		}
+	}
+}
+
+func newConstraintsTestModule() (Module, []interface{}) {
+	m := &constraintsTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *constraintsTestModule) GenerateBuildActions(ModuleContext) {}
+
+func TestPropertyConstraints(t *testing.T) {
+	testCases := []struct {
+		name string
+		bp   string
+		errs []string
+	}{
+		{
+			name: "valid",
+			bp: `
+				m {
+					name: "m",
+					kind: "shared",
+					level: 10,
+					min: [1, 5],
+					size: 4,
+					stem: "lib_m",
+					arches: ["arm"],
+					src: "m.c",
+				}
+			`,
+		},
+		{
+			name: "invalid values",
+			bp: `
+				m {
+					name: "m",
+					kind: "dynamic",
+					level: 11,
+					min: [1, 0],
+					size: 5,
+					stem: "libM",
+					arches: ["arm", "mips"],
+					src: "m.c",
+				}
+			`,
+			errs: []string{
+				`Blueprints:4:10: module "m": kind: invalid value "dynamic", expected one of static, shared`,
+				`Blueprints:5:11: module "m": level: value 11 is out of range [0, 10]`,
+				`Blueprints:6:9: module "m": min: value 0 is out of range >= 1`,
+				`Blueprints:7:10: module "m": size: value 5 is out of range [1, 4]`,
+				`Blueprints:8:10: module "m": stem: value "libM" does not match pattern "[a-z_]+"`,
+				`Blueprints:9:12: module "m": arches: invalid value "mips", expected one of arm, x86`,
+			},
+		},
+		{
+			name: "missing required",
+			bp: `
+				m {
+					name: "m",
+					install: {
+						mode: "0644",
+					},
+				}
+			`,
+			errs: []string{
+				`Blueprints:2:5: module "m": src: missing required property`,
+				`Blueprints:4:13: module "m": install.dir: missing required property`,
+			},
+		},
+		{
+			name: "required set by a mutator",
+			bp: `
+				m {
+					name: "defaults",
+				}
+			`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterModuleType("m", newConstraintsTestModule)
+			ctx.RegisterBottomUpMutator("defaults", func(ctx BottomUpMutatorContext) {
+				if m, ok := ctx.Module().(*constraintsTestModule); ok && ctx.ModuleName() == "defaults" {
+					m.properties.Src = proptools.StringPtr("default.c")
+				}
+			})
+			ctx.MockFileSystem(map[string][]byte{"Blueprints": []byte(testCase.bp)})
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) == 0 {
+				_, errs = ctx.ResolveDependencies(nil)
+			}
+
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, testCase.errs) {
+				t.Errorf("incorrect errors:\n  expected: %q\n       got: %q", testCase.errs, got)
+			}
+		})
+	}
+}
+
+// propertyErrorString formats a *PropertyError that
+// isn't attached to a module yet with its property name.
+func propertyErrorString(err error) string {
+	propertyErr := err.(*PropertyError)
+	return fmt.Sprintf("%s: %s: %s", propertyErr.Pos, propertyErr.property, propertyErr.Err)
+}
+
+type deprecatedTestProperties struct {
+	Srcs     []string
+	Old_srcs []string `blueprint:"deprecated,renamed_to=srcs"`
+	Unused   *bool    `blueprint:"deprecated"`
+	Target   struct {
+		Cflags     []string
+		Old_cflags []string `blueprint:"deprecated,renamed_to=cflags"`
+	}
+}
+
+func TestUnpackDeprecatedProperties(t *testing.T) {
+	file, errs := parser.ParseAndEval("Blueprints", bytes.NewBufferString(`
+		m {
+			old_srcs: ["a.c"],
+			unused: true,
+			target: {
+				old_cflags: ["-a"],
+			},
+		}
+	`), parser.NewScope(nil))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors:\n%s", joinErrors(errs))
+	}
+
+	props := &deprecatedTestProperties{}
+	_, deprecated, errs := unpackProperties(file.Defs[0].(*parser.Module).Properties, props)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	var got []string
+	for _, d := range deprecated {
+		got = append(got, d.Pos.String()+": "+d.Property+": "+d.message())
+	}
+	expected := []string{
+		`Blueprints:3:12: old_srcs: deprecated property, use "srcs" instead`,
+		`Blueprints:4:10: unused: deprecated property`,
+		`Blueprints:6:15: target.old_cflags: deprecated property, use "target.cflags" instead`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect deprecated properties:\n  expected: %q\n       got: %q", expected, got)
+	}
+
+	if !reflect.DeepEqual(props.Srcs, []string{"a.c"}) ||
+		!reflect.DeepEqual(props.Target.Cflags, []string{"-a"}) {
+		t.Errorf("expected renamed properties to be set, got %q and %q", props.Srcs,
+			props.Target.Cflags)
+	}
+}
+
+func TestUnpackRenamedPropertyErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		bp    string
+		props interface{}
+		err   string
+	}{
+		{
+			name:  "both names set",
+			bp:    `m { srcs: ["a.c"], old_srcs: ["b.c"] }`,
+			props: &deprecatedTestProperties{},
+			err: `Blueprints:1:28: old_srcs: can't be set together with "srcs", ` +
+				`which replaces it`,
+		},
+		{
+			name:  "both nested names set",
+			bp:    `m { target: { cflags: ["-a"], old_cflags: ["-b"] } }`,
+			props: &deprecatedTestProperties{},
+			err: `Blueprints:1:41: target.old_cflags: can't be set together with ` +
+				`"target.cflags", which replaces it`,
+		},
+		{
+			name: "missing target",
+			bp:   `m { old: "a" }`,
+			props: &struct {
+				Old *string `blueprint:"deprecated,renamed_to=new"`
+			}{},
+			err: `Blueprints:1:8: old: renamed to "new", which is not a property of the same struct`,
+		},
+		{
+			name: "nested target",
+			bp:   `m { old: "a" }`,
+			props: &struct {
+				Old    *string `blueprint:"deprecated,renamed_to=nested.new"`
+				Nested struct {
+					New *string
+				}
+			}{},
+			err: `Blueprints:1:8: old: renamed to "nested.new", which is not a property ` +
+				`of the same struct`,
+		},
+		{
+			name: "different type",
+			bp:   `m { old: "a" }`,
+			props: &struct {
+				Old *string `blueprint:"deprecated,renamed_to=new"`
+				New []string
+			}{},
+			err: `Blueprints:1:8: old: renamed to "new", which has type []string instead of *string`,
+		},
+		{
+			name: "struct",
+			bp:   `m { old: { a: "a" } }`,
+			props: &struct {
+				Old struct{ A *string } `blueprint:"deprecated,renamed_to=new"`
+				New struct{ A *string }
+			}{},
+			err: `Blueprints:1:8: old: renaming a struct property is not supported`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			errs := unpackTestModule(t, testCase.bp, testCase.props)
+			var got []string
+			for _, err := range errs {
+				got = append(got, propertyErrorString(err))
+			}
+			if !reflect.DeepEqual(got, []string{testCase.err}) {
+				t.Errorf("incorrect errors:\n  expected: %q\n       got: %q", testCase.err, got)
+			}
+		})
+	}
+}
+
+func TestSetDeprecatedProperties(t *testing.T) {
+	pos := scanner.Position{Filename: "Blueprints", Line: 1, Column: 1}
+
+	props := &deprecatedTestProperties{Old_srcs: []string{"a.c"}}
+	deprecated, errs := setDeprecatedProperties([]interface{}{props}, pos)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+	expected := []DeprecatedProperty{{Property: "old_srcs", RenamedTo: "srcs", Pos: pos}}
+	if !reflect.DeepEqual(deprecated, expected) {
+		t.Errorf("incorrect deprecated properties:\n  expected: %#v\n       got: %#v", expected,
+			deprecated)
+	}
+	if !reflect.DeepEqual(props.Srcs, []string{"a.c"}) {
+		t.Errorf("expected srcs to be set, got %q", props.Srcs)
+	}
+
+	props = &deprecatedTestProperties{Srcs: []string{"a.c"}, Old_srcs: []string{"b.c"}}
+	_, errs = setDeprecatedProperties([]interface{}{props}, pos)
+	if len(errs) != 1 || propertyErrorString(errs[0]) !=
+		`Blueprints:1:1: old_srcs: can't be set together with "srcs", which replaces it` {
+		t.Errorf("incorrect errors:\n%s", joinErrors(errs))
+	}
+	if !reflect.DeepEqual(props.Srcs, []string{"a.c"}) {
+		t.Errorf("expected srcs not to be merged, got %q", props.Srcs)
+	}
+}
+
+type unpackTestArch string
+
+func (unpackTestArch) Enum() []string {
+	return []string{"arm", "x86"}
+}
+
+type unpackIntegerTestProperties struct {
+	Small  int32
+	Big    int64
+	Level  *int32
+	Size   *uint64
+	Sizes  []uint64
+	Arch   unpackTestArch
+	Arches []unpackTestArch
+}
+
+func TestUnpackIntegersAndEnums(t *testing.T) {
+	properties := &unpackIntegerTestProperties{}
+	errs := unpackTestModule(t, `
+		m {
+			small: -2147483648,
+			big: 4294967296,
+			level: 0,
+			size: 9223372036854775807,
+			sizes: [0, 1],
+			arch: "x86",
+			arches: ["arm", "x86"],
+		}
+	`, properties)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", joinErrors(errs))
+	}
+
+	level := int32(0)
+	size := uint64(1<<63 - 1)
+	expected := &unpackIntegerTestProperties{
+		Small:  -1 << 31,
+		Big:    1 << 32,
+		Level:  &level,
+		Size:   &size,
+		Sizes:  []uint64{0, 1},
+		Arch:   "x86",
+		Arches: []unpackTestArch{"arm", "x86"},
+	}
+	if !reflect.DeepEqual(properties, expected) {
+		t.Errorf("incorrect properties:\n  expected: %#v\n       got: %#v", expected, properties)
+	}
+}
+
+func TestUnpackIntegersAndEnumsErrors(t *testing.T) {
+	testCases := []struct {
+		bp  string
+		err string
+	}{
+		{
+			bp:  `m { small: 2147483648 }`,
+			err: `Blueprints:1:12: value 2147483648 is out of range for int32 property "small"`,
+		},
+		{
+			bp:  `m { level: -2147483649 }`,
+			err: `Blueprints:1:12: value -2147483649 is out of range for int32 property "level"`,
+		},
+		{
+			bp:  `m { size: -1 }`,
+			err: `Blueprints:1:11: value -1 is out of range for uint64 property "size"`,
+		},
+		{
+			bp:  `m { sizes: [1, -1] }`,
+			err: `Blueprints:1:16: value -1 is out of range for uint64 property "sizes[1]"`,
+		},
+		{
+			bp:  `m { small: "1" }`,
+			err: `Blueprints:1:12: can't assign string value to int32 property "small"`,
+		},
+		{
+			bp:  `m { arch: "mips" }`,
+			err: `Blueprints:1:11: invalid value "mips" for property "arch", expected one of arm, x86`,
+		},
+		{
+			bp: `m { arches: ["arm", "mips"] }`,
+			err: `Blueprints:1:21: invalid value "mips" for property "arches[1]", ` +
+				`expected one of arm, x86`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		errs := unpackTestModule(t, testCase.bp, &unpackIntegerTestProperties{})
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+			t.Errorf("%s: expected error %q, got %q", testCase.bp, testCase.err, errs)
+		}
+	}
+}